@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	_ "github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	"github.com/erazr/ecommerce-microservices/internal/common/proxy"
+	"github.com/erazr/ecommerce-microservices/internal/common/ratelimit"
 	"github.com/erazr/ecommerce-microservices/internal/common/router"
 	"github.com/erazr/ecommerce-microservices/internal/common/server"
-	"github.com/go-chi/chi/v5"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/go-chi/cors"
 
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -26,16 +35,94 @@ import (
 //	@schemes		http
 //	@consumes		json
 
+//	@securityDefinitions.apikey	BearerAuth
+//	@in							header
+//	@name						Authorization
+//	@description				"Bearer" followed by an access token from /auth/login
+
 func main() {
-	r := router.New()
+	// Clients set X-Real-IP and X-Forwarded-For to whatever they like, so
+	// the gateway keeps the address of the connection
+	r := router.New(router.WithoutRealIP())
 
 	r.Use(cors.AllowAll().Handler)
 
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	limits := rateLimitStore(background)
+	proxies := trustedProxies()
+	failClosed := os.Getenv("RATE_LIMIT_FAIL_CLOSED") == "true"
+
+	// Addresses are limited before authenticating, so floods don't cost a
+	// token verification each
+	r.Use(ratelimit.Middleware(limits,
+		ratelimit.Rule{Name: "ip", Key: ratelimit.ByIP(proxies), Limit: rateLimit("RATE_LIMIT_IP"), FailClosed: failClosed},
+	))
+
+	keys := auth.NewRemoteKeySet("http://" + os.Getenv("USER_HOST") + ":" + os.Getenv("USER_PORT") + "/auth/jwks.json")
+	verifier := auth.NewVerifier(keys, auth.WithExpectedIssuer(os.Getenv("JWT_ISSUER")))
+
+	r.Use(auth.Authenticate(verifier,
+		auth.Route{Prefix: os.Getenv("AUTH_PATH") + "/"},
+		auth.Route{Method: http.MethodGet, Prefix: "/swagger/"},
+		auth.Route{Method: http.MethodGet, Prefix: os.Getenv("PRODUCT_PATH")},
+		auth.Route{Method: http.MethodGet, Prefix: os.Getenv("CATEGORY_PATH")},
+		// Webhooks are signed by the payment provider instead
+		auth.Route{Method: http.MethodPost, Prefix: os.Getenv("PAYMENT_PATH") + "/webhooks/"},
+	))
+
+	r.Use(ratelimit.Middleware(limits,
+		ratelimit.Rule{
+			Name:       "orders",
+			Method:     http.MethodPost,
+			Path:       os.Getenv("ORDER_PATH"),
+			Key:        ratelimit.ByUserOrIP(proxies),
+			Limit:      rateLimit("RATE_LIMIT_ORDERS"),
+			FailClosed: failClosed,
+		},
+		ratelimit.Rule{
+			Name:       "payments",
+			Method:     http.MethodPost,
+			Path:       os.Getenv("PAYMENT_PATH"),
+			Key:        ratelimit.ByUserOrIP(proxies),
+			Limit:      rateLimit("RATE_LIMIT_PAYMENTS"),
+			FailClosed: failClosed,
+		},
+		ratelimit.Rule{Name: "user", Key: ratelimit.ByUser, Limit: rateLimit("RATE_LIMIT_USER"), FailClosed: failClosed},
+	))
+
+	routesFile := os.Getenv("GATEWAY_ROUTES")
+	if routesFile == "" {
+		routesFile = "routes.json"
+	}
+
+	routes, err := proxy.LoadConfig(routesFile)
+	if err != nil {
+		panic(err)
+	}
+
+	gateway, err := proxy.New(routes)
+	if err != nil {
+		panic(err)
+	}
+	defer gateway.Close()
+
+	go gateway.Watch(background, routesFile, 5*time.Second)
+
+	var spec atomic.Pointer[openapi.Document]
+
+	go mergeSpecs(background, gateway, &spec)
+
+	r.Get("/swagger/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		response.OK(w, r, spec.Load())
+	})
+
 	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), //The url pointing to API definition
+		httpSwagger.URL("/swagger/openapi.json"), //The url pointing to API definition
 	))
 
-	mountServices(r)
+	r.Handle("/*", gateway)
 
 	server, err := server.New(server.WithHTTPServer(r, os.Getenv("GATEWAY_PORT")))
 	if err != nil {
@@ -52,6 +139,8 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -63,42 +152,136 @@ func main() {
 
 }
 
-func mountServices(r *chi.Mux) {
-	services := []struct {
-		Host string
-		Port string
-		Path string
-	}{
-		{
-			Host: os.Getenv("USER_HOST"),
-			Port: os.Getenv("USER_PORT"),
-			Path: os.Getenv("USER_PATH"),
-		},
-		{
-			Host: os.Getenv("PRODUCT_HOST"),
-			Port: os.Getenv("PRODUCT_PORT"),
-			Path: os.Getenv("PRODUCT_PATH"),
-		},
-		{
-			Host: os.Getenv("ORDER_HOST"),
-			Port: os.Getenv("ORDER_PORT"),
-			Path: os.Getenv("ORDER_PATH"),
-		},
-		{
-			Host: os.Getenv("PAYMENT_HOST"),
-			Port: os.Getenv("PAYMENT_PORT"),
-			Path: os.Getenv("PAYMENT_PATH"),
-		},
+// mergeSpecs merges the OpenAPI documents of the services into the
+// gateway's, again every few seconds while some of them can't be fetched,
+// as the services may still be starting.
+func mergeSpecs(ctx context.Context, gateway *proxy.Gateway, spec *atomic.Pointer[openapi.Document]) {
+	for {
+		doc, err := mergeSpec(ctx, gateway)
+		if doc != nil {
+			spec.Store(doc)
+		}
+
+		if err == nil {
+			fmt.Println("Merged the OpenAPI documents of the services")
+			return
+		}
+
+		fmt.Printf("Merging OpenAPI documents: %v\n", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
 	}
+}
+
+// mergeSpec builds the gateway's document, with the paths of every service
+// the route table sends to it. The document holds the services that could
+// be merged even when others couldn't.
+func mergeSpec(ctx context.Context, gateway *proxy.Gateway) (*openapi.Document, error) {
+	doc, err := openapi.Parse(docs.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	services := gateway.Config().Services
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+
+	for _, name := range names {
+		if services[name].Spec == "" {
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		data, err := gateway.Spec(fetchCtx, name)
+		cancel()
+
+		var service *openapi.Document
+		if err == nil {
+			service, err = openapi.Parse(data)
+		}
+
+		if err == nil {
+			err = doc.Merge(name, service, func(path string) bool {
+				route, ok := gateway.Match(path)
+				return ok && route.Service == name
+			})
+		}
 
-	for _, service := range services {
-		url, err := url.Parse("http://" + service.Host + ":" + service.Port)
 		if err != nil {
-			panic(err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
 		}
+	}
 
-		fmt.Println("Mounting service ", service.Path, "on", url)
+	return doc, errors.Join(errs...)
+}
 
-		r.Mount(service.Path, server.ProxyRequestHandler(url))
+// rateLimitStore keeps the buckets in Postgres when RATE_LIMIT_STORE is
+// postgres, so they are shared by every gateway replica, and in memory
+// otherwise. Expired buckets are purged until ctx is cancelled.
+func rateLimitStore(ctx context.Context) ratelimit.Store {
+	if os.Getenv("RATE_LIMIT_STORE") != "postgres" {
+		return ratelimit.NewMemoryStore()
 	}
+
+	db, err := store.New(os.Getenv("DB_URL"))
+	if err != nil {
+		panic(err)
+	}
+
+	limits := ratelimit.NewPostgresStore(db.Client)
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := limits.Purge(ctx); err != nil {
+				fmt.Printf("Purging rate limit buckets failed: %v\n", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return limits
+}
+
+// trustedProxies reads RATE_LIMIT_TRUSTED_PROXIES, the number of proxies in
+// front of the gateway that append to X-Forwarded-For, unset is none.
+func trustedProxies() int {
+	s := os.Getenv("RATE_LIMIT_TRUSTED_PROXIES")
+	if s == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		panic(fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES: invalid number of proxies %q", s))
+	}
+
+	return n
+}
+
+// rateLimit reads the limit in the environment variable, unset disables it.
+func rateLimit(name string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(os.Getenv(name))
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", name, err))
+	}
+
+	return limit
 }
@@ -0,0 +1,86 @@
+// Package auth issues and verifies the JWT access tokens of the platform.
+// Tokens are signed with RS256 by the user service, which publishes its
+// public keys as a JWKS, and checked by the API gateway before a request is
+// forwarded.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Headers the gateway sets on forwarded requests. They are trusted by the
+// services behind the gateway, which must not be reachable otherwise.
+const (
+	UserIDHeader   = "X-User-ID"
+	UserRoleHeader = "X-User-Role"
+)
+
+var (
+	ErrMissingToken = &AuthError{"missing access token"}
+	ErrInvalidToken = &AuthError{"invalid access token"}
+	ErrExpiredToken = &AuthError{"access token expired"}
+	ErrUnknownKey   = &AuthError{"unknown signing key"}
+)
+
+type AuthError struct {
+	message string
+}
+
+func (e *AuthError) Error() string {
+	return e.message
+}
+
+func (e *AuthError) Is(err error) bool {
+	return e == err
+}
+
+// Claims are the claims of an access token.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ID        string `json:"jti,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// Valid checks the time based claims, allowing for clocks that are off by
+// up to leeway.
+func (c Claims) Valid(now time.Time, leeway time.Duration) error {
+	if c.Subject == "" {
+		return ErrInvalidToken
+	}
+
+	if now.Add(-leeway).Unix() >= c.ExpiresAt {
+		return ErrExpiredToken
+	}
+
+	if c.NotBefore != 0 && now.Add(leeway).Unix() < c.NotBefore {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+type contextKey struct{}
+
+// WithClaims returns a context carrying the claims of the caller.
+func WithClaims(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the claims stored by WithClaims.
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(Claims)
+	return c, ok
+}
+
+// UserID returns the caller the gateway verified, empty for anonymous
+// requests.
+func UserID(r *http.Request) string {
+	return r.Header.Get(UserIDHeader)
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+)
+
+const algorithm = "RS256"
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Signer issues access tokens.
+type Signer struct {
+	key   *rsa.PrivateKey
+	keyID string
+
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+func NewSigner(key *rsa.PrivateKey, configs ...func(*Signer)) *Signer {
+	if key == nil {
+		panic("key is required")
+	}
+
+	s := &Signer{
+		key:   key,
+		keyID: KeyID(&key.PublicKey),
+		ttl:   15 * time.Minute,
+	}
+
+	for _, cfg := range configs {
+		cfg(s)
+	}
+
+	return s
+}
+
+func WithIssuer(issuer string) func(*Signer) {
+	return func(s *Signer) {
+		s.issuer = issuer
+	}
+}
+
+func WithAudience(audience string) func(*Signer) {
+	return func(s *Signer) {
+		s.audience = audience
+	}
+}
+
+func WithTTL(ttl time.Duration) func(*Signer) {
+	return func(s *Signer) {
+		s.ttl = ttl
+	}
+}
+
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign issues a token for the user, the claims besides the subject and the
+// role are filled in by the signer.
+func (s *Signer) Sign(userID, role string) (string, error) {
+	now := time.Now()
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	claims := Claims{
+		Issuer:    s.issuer,
+		Subject:   userID,
+		Audience:  s.audience,
+		ExpiresAt: now.Add(s.ttl).Unix(),
+		IssuedAt:  now.Unix(),
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Role:      role,
+	}
+
+	return s.SignClaims(claims)
+}
+
+// SignClaims signs arbitrary claims, for tokens other than access tokens.
+func (s *Signer) SignClaims(claims any) (string, error) {
+	h, err := json.Marshal(header{Algorithm: algorithm, Type: "JWT", KeyID: s.keyID})
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// JWKS returns the public key set to verify the tokens of the signer.
+func (s *Signer) JWKS() JWKS {
+	return JWKS{Keys: []JWK{PublicJWK(s.keyID, &s.key.PublicKey)}}
+}
+
+// KeySet finds the public key a token was signed with.
+type KeySet interface {
+	Key(ctx context.Context, keyID string) (*rsa.PublicKey, error)
+}
+
+// Verifier checks access tokens.
+type Verifier struct {
+	keys KeySet
+
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+func NewVerifier(keys KeySet, configs ...func(*Verifier)) *Verifier {
+	if keys == nil {
+		panic("key set is required")
+	}
+
+	v := &Verifier{
+		keys:   keys,
+		leeway: 30 * time.Second,
+	}
+
+	for _, cfg := range configs {
+		cfg(v)
+	}
+
+	return v
+}
+
+// WithExpectedIssuer rejects tokens of other issuers.
+func WithExpectedIssuer(issuer string) func(*Verifier) {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithExpectedAudience rejects tokens meant for someone else.
+func WithExpectedAudience(audience string) func(*Verifier) {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// Verify checks the signature and the claims of a token and returns them.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	claims := Claims{}
+	if err := ParseSigned(ctx, v.keys, token, &claims); err != nil {
+		return Claims{}, err
+	}
+
+	if err := claims.Valid(time.Now(), v.leeway); err != nil {
+		return Claims{}, err
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if v.audience != "" && claims.Audience != v.audience {
+		return Claims{}, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// ParseSigned checks the RS256 signature of a token against keys and
+// decodes its claims into v. The claims themselves aren't validated.
+func ParseSigned(ctx context.Context, keys KeySet, token string, v any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	h := header{}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return ErrInvalidToken
+	}
+
+	// Only the one algorithm is accepted, whatever the token claims
+	if h.Algorithm != algorithm {
+		return ErrInvalidToken
+	}
+
+	key, err := keys.Key(ctx, h.KeyID)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return ErrInvalidToken
+	}
+
+	if err := decodeSegment(parts[1], v); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// ParsePrivateKey reads a PEM encoded PKCS #1 or PKCS #8 RSA key.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+
+	return rsaKey, nil
+}
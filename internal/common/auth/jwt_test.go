@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// serveJWKS publishes the keys of signer, counting the fetches.
+func serveJWKS(t *testing.T, signer *Signer, fetches *atomic.Int32) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(signer.JWKS())
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func TestVerify(t *testing.T) {
+	key := newKey(t)
+	signer := NewSigner(key, WithIssuer("users"), WithAudience("api"))
+
+	var fetches atomic.Int32
+	verifier := NewVerifier(NewRemoteKeySet(serveJWKS(t, signer, &fetches)), WithExpectedIssuer("users"), WithExpectedAudience("api"))
+
+	token, err := signer.Sign("user1", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "user1" || claims.Role != "client" {
+		t.Errorf("got claims %+v", claims)
+	}
+
+	sign := func(s *Signer) string {
+		token, err := s.Sign("user1", "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	// Claims the role of an admin under the signature of a client token
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(Claims{Issuer: "users", Subject: "user1", Audience: "api", ExpiresAt: time.Now().Add(time.Hour).Unix(), Role: "admin"})
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+
+	none, _ := json.Marshal(header{Algorithm: "none", Type: "JWT", KeyID: KeyID(&key.PublicKey)})
+	unsigned := base64.RawURLEncoding.EncodeToString(none) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"other issuer", sign(NewSigner(key, WithIssuer("someone"), WithAudience("api"))), ErrInvalidToken},
+		{"other audience", sign(NewSigner(key, WithIssuer("users"), WithAudience("billing"))), ErrInvalidToken},
+		{"expired", sign(NewSigner(key, WithIssuer("users"), WithAudience("api"), WithTTL(-time.Minute))), ErrExpiredToken},
+		{"tampered", tampered, ErrInvalidToken},
+		{"alg none", unsigned, ErrInvalidToken},
+		{"unknown key", sign(NewSigner(newKey(t), WithIssuer("users"), WithAudience("api"))), ErrUnknownKey},
+		{"not a token", "token", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), tt.token); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// Unknown keys don't make every request fetch the set again
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times, want once", n)
+	}
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	old := NewSigner(newKey(t))
+	rotated := NewSigner(newKey(t))
+
+	var fetches atomic.Int32
+	keys := NewRemoteKeySet(serveJWKS(t, rotated, &fetches))
+
+	// Refreshed a while ago with only the old key
+	keys.keys = map[string]*rsa.PublicKey{old.keyID: &old.key.PublicKey}
+	keys.fetchedAt = time.Now().Add(-time.Hour)
+
+	if _, err := keys.Key(context.Background(), old.keyID); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches.Load() != 0 {
+		t.Error("fetched the key set for a known key")
+	}
+
+	if _, err := keys.Key(context.Background(), rotated.keyID); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("fetched the key set %d times, want once", fetches.Load())
+	}
+}
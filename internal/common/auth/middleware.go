@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+)
+
+// Route matches requests by method and path prefix, an empty method
+// matches every method. A route without a prefix matches nothing.
+type Route struct {
+	Method string
+	Prefix string
+}
+
+func (rt Route) Match(r *http.Request) bool {
+	return rt.Prefix != "" && (rt.Method == "" || rt.Method == r.Method) && strings.HasPrefix(r.URL.Path, rt.Prefix)
+}
+
+// Authenticate verifies the bearer token of a request and passes the caller
+// on in the UserIDHeader and UserRoleHeader headers. Whatever a client sent
+// in those headers is dropped first. Requests to public routes may come
+// without a token, a token they do carry is still verified.
+func Authenticate(verifier *Verifier, public ...Route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del(UserIDHeader)
+			r.Header.Del(UserRoleHeader)
+
+			token, err := bearerToken(r)
+			if errors.Is(err, ErrMissingToken) && isPublic(r, public) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var claims Claims
+			if err == nil {
+				claims, err = verifier.Verify(r.Context(), token)
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				response.Unauthorized(w, r, err)
+				return
+			}
+
+			r.Header.Set(UserIDHeader, claims.Subject)
+			r.Header.Set(UserRoleHeader, claims.Role)
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	value := r.Header.Get("Authorization")
+	if value == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", ErrInvalidToken
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+func isPublic(r *http.Request, public []Route) bool {
+	for _, rt := range public {
+		if rt.Match(r) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,171 @@
+// Package authz decides what a caller may do. Services learn the caller
+// from the headers the API gateway sets after verifying the access token,
+// and guard their routes with policies built from the caller's role and
+// ownership of the requested resource.
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleClient = "client"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("not allowed")
+)
+
+// Principal is the caller of a request, the zero value is an anonymous
+// caller.
+type Principal struct {
+	UserID string
+	Role   string
+}
+
+func (p Principal) Authenticated() bool {
+	return p.UserID != ""
+}
+
+func (p Principal) IsAdmin() bool {
+	return p.Authenticated() && p.Role == RoleAdmin
+}
+
+// Owns reports whether the caller is the owner, admins own everything.
+func (p Principal) Owns(ownerID string) bool {
+	return p.IsAdmin() || (p.Authenticated() && p.UserID == ownerID)
+}
+
+// OnBehalfOf returns the user the caller acts for, which is the caller
+// unless an admin names someone else. Naming another user as a non-admin
+// is forbidden.
+func (p Principal) OnBehalfOf(userID string) (string, error) {
+	if userID == "" || userID == p.UserID {
+		return p.UserID, nil
+	}
+
+	if !p.IsAdmin() {
+		return "", ErrForbidden
+	}
+
+	return userID, nil
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+func FromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(contextKey{}).(Principal)
+	return p
+}
+
+// Identify stores the caller named by the gateway headers in the request
+// context.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := Principal{
+			UserID: r.Header.Get(auth.UserIDHeader),
+			Role:   r.Header.Get(auth.UserRoleHeader),
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Policy decides whether the caller may make the request. Returning an
+// error other than ErrForbidden fails the request, e.g. when the resource
+// couldn't be loaded.
+type Policy func(r *http.Request, p Principal) error
+
+// Require only lets requests through that satisfy the policy. Anonymous
+// callers get 401 and everyone else the policy rejects 403.
+func Require(policy Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := FromContext(r.Context())
+
+			if !p.Authenticated() {
+				response.Unauthorized(w, r, ErrUnauthenticated)
+				return
+			}
+
+			if err := policy(r, p); err != nil {
+				Deny(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deny writes the response for an error of a policy.
+func Deny(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		response.Unauthorized(w, r, err)
+	case errors.Is(err, ErrForbidden):
+		response.Forbidden(w, r, err)
+	default:
+		response.InternalServerError(w, r, err)
+	}
+}
+
+// Authenticated allows every caller that is signed in.
+func Authenticated(r *http.Request, p Principal) error {
+	return nil
+}
+
+// Admin allows admins only.
+func Admin(r *http.Request, p Principal) error {
+	if !p.IsAdmin() {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// Self allows the user named by the URL parameter, and admins.
+func Self(param string) Policy {
+	return func(r *http.Request, p Principal) error {
+		if !p.Owns(chi.URLParam(r, param)) {
+			return ErrForbidden
+		}
+
+		return nil
+	}
+}
+
+// Owner allows the owner of the requested resource, and admins. owner looks
+// up who owns it and should report a resource that doesn't exist with an
+// empty owner, so callers can't probe which of other users' resources
+// exist.
+func Owner(owner func(r *http.Request) (string, error)) Policy {
+	return func(r *http.Request, p Principal) error {
+		if p.IsAdmin() {
+			return nil
+		}
+
+		ownerID, err := owner(r)
+		if err != nil {
+			return err
+		}
+
+		if !p.Owns(ownerID) {
+			return ErrForbidden
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,86 @@
+package authz
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+)
+
+func TestRequire(t *testing.T) {
+	// order1 belongs to user1, other orders don't exist
+	owner := Owner(func(r *http.Request) (string, error) {
+		if r.URL.Query().Get("id") == "order1" {
+			return "user1", nil
+		}
+
+		return "", nil
+	})
+
+	failing := Owner(func(r *http.Request) (string, error) {
+		return "", errors.New("database is down")
+	})
+
+	tests := []struct {
+		name   string
+		policy Policy
+		userID string
+		role   string
+		target string
+		status int
+	}{
+		{"anonymous", Authenticated, "", "", "/", http.StatusUnauthorized},
+		{"signed in", Authenticated, "user1", RoleClient, "/", http.StatusOK},
+		{"admin only as client", Admin, "user1", RoleClient, "/", http.StatusForbidden},
+		{"admin only as admin", Admin, "admin1", RoleAdmin, "/", http.StatusOK},
+		{"role without user", Admin, "", RoleAdmin, "/", http.StatusUnauthorized},
+		{"owner", owner, "user1", RoleClient, "/?id=order1", http.StatusOK},
+		{"other user", owner, "user2", RoleClient, "/?id=order1", http.StatusForbidden},
+		{"missing resource", owner, "user2", RoleClient, "/?id=missing", http.StatusForbidden},
+		{"admin of other's resource", owner, "admin1", RoleAdmin, "/?id=order1", http.StatusOK},
+		{"failed lookup", failing, "user1", RoleClient, "/?id=order1", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Identify(Require(tt.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set(auth.UserIDHeader, tt.userID)
+			req.Header.Set(auth.UserRoleHeader, tt.role)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("got status %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestOnBehalfOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller Principal
+		userID string
+		want   string
+		err    error
+	}{
+		{"self by default", Principal{UserID: "user1", Role: RoleClient}, "", "user1", nil},
+		{"self named", Principal{UserID: "user1", Role: RoleClient}, "user1", "user1", nil},
+		{"client for someone else", Principal{UserID: "user1", Role: RoleClient}, "user2", "", ErrForbidden},
+		{"admin for someone else", Principal{UserID: "admin1", Role: RoleAdmin}, "user2", "user2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.caller.OnBehalfOf(tt.userID)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("got %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
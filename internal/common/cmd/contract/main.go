@@ -0,0 +1,156 @@
+// Command contract checks the live API against the gateway's OpenAPI
+// document. It calls every GET operation whose parameters it has values
+// for, and reports the responses with an undocumented status or a body not
+// matching the documented schema. The services' tests check every operation
+// of their handlers the same way, see openapi.Contract.
+//
+//	go run ./cmd/contract -url http://localhost:8080 -token $TOKEN -param id=42
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+)
+
+func main() {
+	base := flag.String("url", "http://localhost:8080", "gateway URL")
+	specPath := flag.String("spec", "/swagger/openapi.json", "path of the OpenAPI document")
+	token := flag.String("token", "", "access token sent as bearer")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+
+	params := make(map[string]string)
+	flag.Func("param", "name=value of a parameter, repeatable", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("%q is not name=value", s)
+		}
+
+		params[name] = value
+		return nil
+	})
+
+	flag.Parse()
+
+	client := &http.Client{Timeout: *timeout}
+
+	res, err := client.Get(*base + *specPath)
+	if err != nil {
+		panic(err)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	doc, err := openapi.Parse(data)
+	if err != nil {
+		panic(err)
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	failed := 0
+
+	for _, path := range paths {
+		op, ok := doc.Paths[path]["get"]
+		if !ok {
+			continue
+		}
+
+		target, err := resolve(path, op, params)
+		if err != nil {
+			fmt.Printf("SKIP GET %s: %v\n", path, err)
+			continue
+		}
+
+		if err := check(client, doc, *base, target, *token); err != nil {
+			fmt.Printf("FAIL GET %s: %v\n", target, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("OK   GET %s\n", target)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d operations broke the contract\n", failed)
+		os.Exit(1)
+	}
+}
+
+// resolve fills the path parameters and required query parameters of an
+// operation from params.
+func resolve(path string, op *openapi.Operation, params map[string]string) (string, error) {
+	query := url.Values{}
+
+	for _, param := range op.Parameters {
+		value, ok := params[param.Name]
+
+		switch param.In {
+		case "path":
+			if !ok {
+				return "", fmt.Errorf("no value for path parameter %s", param.Name)
+			}
+
+			path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(value))
+		case "query":
+			if ok {
+				query.Set(param.Name, value)
+			} else if param.Required {
+				return "", fmt.Errorf("no value for query parameter %s", param.Name)
+			}
+		}
+	}
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	return path, nil
+}
+
+func check(client *http.Client, doc *openapi.Document, base, target, token string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, base+target, nil)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	path, _, _ := strings.Cut(target, "?")
+
+	if err := doc.ValidateResponse(http.MethodGet, path, res.StatusCode, res.Header, body); err != nil {
+		return fmt.Errorf("%s: %w", res.Status, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+// Command grpccerts issues the certificates the services authenticate each
+// other with over gRPC. It creates a CA in the output directory, or reuses
+// the one already there, and a certificate per service named after it and
+// valid for the service's host name.
+//
+//	go run ./cmd/grpccerts -out ../../certs product order payment
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	out := flag.String("out", "certs", "output directory")
+	validity := flag.Duration("validity", 365*24*time.Hour, "how long the service certificates are valid")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Println("usage: grpccerts [-out dir] [-validity duration] service...")
+		os.Exit(2)
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		panic(err)
+	}
+
+	ca, caKey, err := loadCA(*out)
+	if errors.Is(err, os.ErrNotExist) {
+		ca, caKey, err = createCA(*out)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	for _, service := range flag.Args() {
+		if err := issue(*out, service, ca, caKey, *validity); err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Issued certificate for %s\n", service)
+	}
+}
+
+func createCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "ecommerce-microservices CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := write(dir, "ca", der, key); err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+
+	return ca, key, err
+}
+
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid CA in " + dir)
+	}
+
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ca, key, nil
+}
+
+// issue creates a certificate that both serves as the service and
+// identifies it when calling other services.
+func issue(dir, service string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, validity time.Duration) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: service},
+		DNSNames:     []string{service, "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	return write(dir, service, der, key)
+}
+
+func write(dir, name string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), cert, 0o644); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return os.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0o600)
+}
+
+func serialNumber() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
@@ -0,0 +1,64 @@
+// Command swagdocs generates the OpenAPI 3 document of a service from the
+// swag annotations of its main file and handlers, and fails on annotations
+// that don't match their routes.
+//
+//	go run ./cmd/swagdocs -dir ../order
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	"github.com/swaggo/swag"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the service")
+	mainFile := flag.String("main", "main.go", "file of the general API annotations, relative to dir")
+	out := flag.String("out", "", "output file, docs/openapi.json in dir by default")
+	flag.Parse()
+
+	if *out == "" {
+		*out = filepath.Join(*dir, "docs", "openapi.json")
+	}
+
+	parser := swag.New(swag.SetParseDependency(1), swag.ParseUsingGoList(true))
+
+	if err := parser.ParseAPIMultiSearchDir([]string{*dir}, *mainFile, 100); err != nil {
+		panic(err)
+	}
+
+	spec, err := json.Marshal(parser.GetSwagger())
+	if err != nil {
+		panic(err)
+	}
+
+	doc, err := openapi.FromSwagger(spec)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := doc.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		panic(err)
+	}
+
+	if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Generated %s\n", *out)
+}
@@ -0,0 +1,97 @@
+// Package events carries state changes between services. Changes are written
+// to the outbox table in the same transaction as the change itself and a
+// Relay later hands them to a Publisher, so an event is never lost nor
+// published for a change that was rolled back.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+const (
+	OrderPlaced      = "order.placed"
+	PaymentSucceeded = "payment.succeeded"
+	PaymentFailed    = "payment.failed"
+	StockChanged     = "stock.changed"
+)
+
+type Event struct {
+	ID          string          `db:"id" json:"id"`
+	Type        string          `db:"type" json:"type"`
+	AggregateID string          `db:"aggregate_id" json:"aggregate_id"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+}
+
+func New(eventType, aggregateID string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:          store.GenerateID(),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     data,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// Decode unmarshals the payload into v.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+type OrderPlacedPayload struct {
+	OrderID    string            `json:"order_id"`
+	UserID     string            `json:"user_id"`
+	Items      []OrderPlacedItem `json:"items"`
+	TotalPrice money.Money       `json:"total_price"`
+}
+
+type OrderPlacedItem struct {
+	ProductID string      `json:"product_id"`
+	VariantID string      `json:"variant_id"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+}
+
+type PaymentSucceededPayload struct {
+	PaymentID string      `json:"payment_id"`
+	OrderID   string      `json:"order_id"`
+	UserID    string      `json:"user_id"`
+	Amount    money.Money `json:"amount"`
+}
+
+type PaymentFailedPayload struct {
+	PaymentID string `json:"payment_id"`
+	OrderID   string `json:"order_id"`
+	UserID    string `json:"user_id"`
+}
+
+// StockChangedPayload is a change of the stock of a variant, Stock is what
+// the variant has left.
+type StockChangedPayload struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id"`
+	Delta     int    `json:"delta"`
+	Stock     int    `json:"stock"`
+}
+
+// Handler consumes a single event. Delivery is at least once, so handlers
+// have to tolerate seeing the same event again.
+type Handler func(ctx context.Context, e Event) error
+
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+type Subscriber interface {
+	Subscribe(eventType string, h Handler)
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// InProcessBus delivers events to handlers registered in the same process.
+// Publish returns the first handler error so the relay retries the event.
+type InProcessBus struct {
+	mu sync.RWMutex
+
+	handlers map[string][]Handler
+}
+
+func NewInProcessBus() *InProcessBus {
+	return &InProcessBus{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+func (b *InProcessBus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+func (b *InProcessBus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[e.Type]
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
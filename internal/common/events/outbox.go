@@ -0,0 +1,171 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// relayLock serializes relays across all services so events get their
+// published_seq in the order they are published.
+const relayLock = 7305
+
+// Add writes e to the outbox, exec is expected to be the transaction that
+// makes the change the event describes.
+func Add(ctx context.Context, exec sqlx.ExecerContext, e Event) error {
+	q := `INSERT INTO outbox (id, type, aggregate_id, payload, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := exec.ExecContext(ctx, q, e.ID, e.Type, e.AggregateID, []byte(e.Payload), e.CreatedAt)
+
+	return err
+}
+
+// TxPublisher is implemented by publishers living in the outbox database.
+// Publishing inside the relay transaction makes an event visible to them
+// exactly when it is marked as published.
+type TxPublisher interface {
+	PublishTx(ctx context.Context, tx *sqlx.Tx, e Event) error
+}
+
+// Relay moves events from the outbox to a Publisher.
+type Relay struct {
+	db *sqlx.DB
+
+	publisher Publisher
+
+	interval  time.Duration
+	batchSize int
+
+	retention     time.Duration
+	sweepInterval time.Duration
+}
+
+func NewRelay(db *sqlx.DB, publisher Publisher, configs ...func(*Relay)) *Relay {
+	if db == nil {
+		panic("db is required")
+	}
+
+	r := &Relay{
+		db:            db,
+		publisher:     publisher,
+		interval:      time.Second,
+		batchSize:     100,
+		retention:     7 * 24 * time.Hour,
+		sweepInterval: time.Hour,
+	}
+
+	for _, cfg := range configs {
+		cfg(r)
+	}
+
+	return r
+}
+
+func WithRelayInterval(interval time.Duration) func(*Relay) {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithRetention sets how long published events and dead letters are kept,
+// zero keeps them forever. Consumers down for longer than that miss the
+// events deleted in the meantime.
+func WithRetention(retention time.Duration) func(*Relay) {
+	return func(r *Relay) {
+		if retention >= 0 {
+			r.retention = retention
+		}
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	sweepTicker := time.NewTicker(r.sweepInterval)
+	defer sweepTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.relay(ctx); err != nil {
+				fmt.Printf("Relaying outbox events failed: %v\n", err)
+			}
+		case now := <-sweepTicker.C:
+			if err := r.sweep(ctx, r.db, now); err != nil {
+				fmt.Printf("Deleting old outbox events failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// sweep deletes the events published and the dead letters failed longer than
+// the retention before now. Unpublished events are kept however old they are.
+func (r *Relay) sweep(ctx context.Context, exec sqlx.ExecerContext, now time.Time) error {
+	if r.retention == 0 {
+		return nil
+	}
+
+	before := now.Add(-r.retention)
+
+	if _, err := exec.ExecContext(ctx, `DELETE FROM outbox WHERE published_seq IS NOT NULL AND published_at < $1`, before); err != nil {
+		return err
+	}
+
+	_, err := exec.ExecContext(ctx, `DELETE FROM outbox_dead_letters WHERE failed_at < $1`, before)
+
+	return err
+}
+
+// relay publishes one batch of pending events in outbox order. An event that
+// fails to publish stops the batch so later events don't overtake it.
+func (r *Relay) relay(ctx context.Context) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", relayLock); err != nil {
+		return err
+	}
+
+	pending := []Event{}
+
+	q := `SELECT id, type, aggregate_id, payload, created_at FROM outbox WHERE published_seq IS NULL ORDER BY seq LIMIT $1`
+
+	if err = tx.SelectContext(ctx, &pending, q, r.batchSize); err != nil {
+		return err
+	}
+
+	var publishErr error
+
+	for _, e := range pending {
+		if tp, ok := r.publisher.(TxPublisher); ok {
+			publishErr = tp.PublishTx(ctx, tx, e)
+		} else {
+			publishErr = r.publisher.Publish(ctx, e)
+		}
+
+		if publishErr != nil {
+			break
+		}
+
+		q = `UPDATE outbox SET published_seq = nextval('outbox_published_seq'), published_at = NOW() WHERE id = $1`
+
+		if _, err = tx.ExecContext(ctx, q, e.ID); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return publishErr
+}
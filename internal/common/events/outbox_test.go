@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type execCall struct {
+	query string
+	args  []any
+}
+
+// recordingExec records the statements it is given.
+type recordingExec struct {
+	sqlx.ExecerContext
+
+	calls []execCall
+}
+
+func (e *recordingExec) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	e.calls = append(e.calls, execCall{query, args})
+
+	return nil, nil
+}
+
+func TestRelaySweep(t *testing.T) {
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	t.Run("deletes past the retention", func(t *testing.T) {
+		r := NewRelay(&sqlx.DB{}, nil, WithRetention(24*time.Hour))
+		exec := &recordingExec{}
+
+		if err := r.sweep(context.Background(), exec, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(exec.calls) != 2 {
+			t.Fatalf("got %d statements, want 2", len(exec.calls))
+		}
+
+		before := []any{now.Add(-24 * time.Hour)}
+
+		for i, table := range []string{"outbox ", "outbox_dead_letters "} {
+			call := exec.calls[i]
+
+			if !strings.HasPrefix(call.query, "DELETE FROM "+table) {
+				t.Errorf("statement %d: got %q, want a delete from %s", i, call.query, table)
+			}
+
+			if !reflect.DeepEqual(call.args, before) {
+				t.Errorf("statement %d: got arguments %v, want %v", i, call.args, before)
+			}
+		}
+
+		if !strings.Contains(exec.calls[0].query, "published_seq IS NOT NULL") {
+			t.Errorf("got %q, want unpublished events kept", exec.calls[0].query)
+		}
+	})
+
+	t.Run("zero keeps everything", func(t *testing.T) {
+		r := NewRelay(&sqlx.DB{}, nil, WithRetention(0))
+		exec := &recordingExec{}
+
+		if err := r.sweep(context.Background(), exec, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(exec.calls) != 0 {
+			t.Errorf("got statements %v, want none", exec.calls)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const notifyChannel = "outbox_events"
+
+// PostgresBus uses the outbox table itself as the event log and LISTEN/NOTIFY
+// to wake consumers up, so it needs nothing but the database. Every consumer
+// keeps its position in outbox_offsets and catches up on whatever it missed
+// while it was down. An event a handler keeps failing on is moved to
+// outbox_dead_letters after maxAttempts, so it doesn't hold up the events
+// after it forever.
+type PostgresBus struct {
+	db *sqlx.DB
+
+	url      string
+	consumer string
+
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewPostgresBus(db *sqlx.DB, url, consumer string, configs ...func(*PostgresBus)) *PostgresBus {
+	if db == nil {
+		panic("db is required")
+	}
+
+	b := &PostgresBus{
+		db:           db,
+		url:          url,
+		consumer:     consumer,
+		pollInterval: 10 * time.Second,
+		batchSize:    100,
+		maxAttempts:  5,
+		handlers:     make(map[string][]Handler),
+	}
+
+	for _, cfg := range configs {
+		cfg(b)
+	}
+
+	return b
+}
+
+// WithMaxAttempts sets how many times an event is handled before it is
+// dead-lettered.
+func WithMaxAttempts(attempts int) func(*PostgresBus) {
+	return func(b *PostgresBus) {
+		if attempts > 0 {
+			b.maxAttempts = attempts
+		}
+	}
+}
+
+func (b *PostgresBus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish wakes up listeners, they read the event from the outbox.
+func (b *PostgresBus) Publish(ctx context.Context, e Event) error {
+	_, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, e.Type)
+
+	return err
+}
+
+// PublishTx queues the notification in tx, Postgres delivers it on commit.
+func (b *PostgresBus) PublishTx(ctx context.Context, tx *sqlx.Tx, e Event) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, e.Type)
+
+	return err
+}
+
+// Listen consumes events of the subscribed types until ctx is cancelled. It
+// wakes up on notifications and polls as a fallback for missed ones.
+func (b *PostgresBus) Listen(ctx context.Context) error {
+	listener := pq.NewListener(b.url, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Printf("Event listener error: %v\n", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.consume(ctx); err != nil {
+			fmt.Printf("Consuming events as %s failed: %v\n", b.consumer, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *PostgresBus) consume(ctx context.Context) error {
+	b.mu.RLock()
+	types := make([]string, 0, len(b.handlers))
+	for t := range b.handlers {
+		types = append(types, t)
+	}
+	b.mu.RUnlock()
+
+	if len(types) == 0 {
+		return nil
+	}
+
+	for {
+		n, err := b.consumeBatch(ctx, types)
+		if err != nil || n < b.batchSize {
+			return err
+		}
+	}
+}
+
+// consumeBatch handles the next batch of events. The offset row stays locked
+// for the whole batch so replicas of the same consumer take turns. It also
+// counts the failed attempts at the event after the position, the only one
+// that can be failing as consuming stops there.
+func (b *PostgresBus) consumeBatch(ctx context.Context, types []string) (int, error) {
+	tx, err := b.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	q := `INSERT INTO outbox_offsets (consumer, position) VALUES ($1, 0) ON CONFLICT (consumer) DO NOTHING`
+
+	if _, err = tx.ExecContext(ctx, q, b.consumer); err != nil {
+		return 0, err
+	}
+
+	offset := struct {
+		Position int64 `db:"position"`
+		Attempts int   `db:"attempts"`
+	}{}
+
+	if err = tx.GetContext(ctx, &offset, "SELECT position, attempts FROM outbox_offsets WHERE consumer = $1 FOR UPDATE", b.consumer); err != nil {
+		return 0, err
+	}
+
+	position, attempts := offset.Position, offset.Attempts
+
+	q, args, err := sqlx.In(`
+		SELECT id, type, aggregate_id, payload, created_at, published_seq FROM outbox
+		WHERE published_seq > ? AND type IN (?)
+		ORDER BY published_seq LIMIT ?
+	`, position, types, b.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := []struct {
+		Event
+		Seq int64 `db:"published_seq"`
+	}{}
+
+	if err = tx.SelectContext(ctx, &rows, tx.Rebind(q), args...); err != nil {
+		return 0, err
+	}
+
+	var handleErr error
+
+	for _, row := range rows {
+		if handleErr = b.dispatch(ctx, row.Event); handleErr != nil {
+			if attempts++; attempts < b.maxAttempts {
+				break
+			}
+
+			if err = b.deadLetter(ctx, tx, row.Event, attempts, handleErr); err != nil {
+				return 0, err
+			}
+
+			fmt.Printf("Gave up on %s event with id %s as %s after %d attempts: %v\n", row.Type, row.ID, b.consumer, attempts, handleErr)
+
+			handleErr = nil
+		}
+
+		position, attempts = row.Seq, 0
+	}
+
+	q = `UPDATE outbox_offsets SET position = $1, attempts = $2, updated_at = NOW() WHERE consumer = $3`
+
+	if _, err = tx.ExecContext(ctx, q, position, attempts, b.consumer); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(rows), handleErr
+}
+
+// deadLetter keeps an event the consumer gave up on, to be looked into and
+// replayed by hand.
+func (b *PostgresBus) deadLetter(ctx context.Context, tx *sqlx.Tx, e Event, attempts int, handleErr error) error {
+	q := `
+		INSERT INTO outbox_dead_letters (consumer, event_id, type, aggregate_id, payload, attempts, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (consumer, event_id) DO UPDATE SET attempts = EXCLUDED.attempts, error = EXCLUDED.error, failed_at = NOW()
+	`
+
+	_, err := tx.ExecContext(ctx, q, b.consumer, e.ID, e.Type, e.AggregateID, e.Payload, attempts, handleErr.Error())
+
+	return err
+}
+
+func (b *PostgresBus) dispatch(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[e.Type]
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil {
+			return fmt.Errorf("handling %s event with id %s: %w", e.Type, e.ID, err)
+		}
+	}
+
+	return nil
+}
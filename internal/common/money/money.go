@@ -0,0 +1,301 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	moneypb "github.com/erazr/ecommerce-microservices/internal/common/pb/money"
+)
+
+// DefaultCurrency is used for amounts that don't carry a currency, such as
+// requests from older clients and rows stored before currencies were tracked.
+const DefaultCurrency = "KZT"
+
+// exponents lists currencies that don't have two digits after the decimal
+// point. Database columns hold at most two.
+var exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"CLP": 0,
+	"ISK": 0,
+}
+
+var (
+	ErrInvalidAmount    = &MoneyError{"invalid money amount"}
+	ErrInvalidCurrency  = &MoneyError{"invalid currency code"}
+	ErrCurrencyMismatch = &MoneyError{"currency mismatch"}
+)
+
+type MoneyError struct {
+	message string
+}
+
+func (e *MoneyError) Error() string {
+	return e.message
+}
+
+func (e *MoneyError) Is(err error) bool {
+	return e == err
+}
+
+// Money is an amount in minor units (cents, tiyn) of an ISO 4217 currency.
+// It is encoded as a decimal string in JSON, the tags document that.
+type Money struct {
+	Amount   int64  `json:"amount" swaggertype:"string" example:"12.50"`
+	Currency string `json:"currency" example:"KZT"`
+} // @name Money
+
+func New(amount int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Parse reads a decimal amount in major units, e.g. "12.50".
+func Parse(s, currency string) (Money, error) {
+	m := New(0, currency)
+
+	if len(m.Currency) != 3 {
+		return Money{}, ErrInvalidCurrency
+	}
+
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	// Only digits are left once the one sign is gone, ParseInt below would
+	// take another sign and flip "--5" to 5
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+	}
+
+	exp := m.exponent()
+
+	// Trailing zeros past the currency precision are fine, anything else
+	// would be silently rounded away.
+	if len(frac) > exp {
+		if strings.Trim(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %s has more than %d decimals", ErrInvalidAmount, s, exp)
+		}
+		frac = frac[:exp]
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	m.Amount = amount
+
+	return m, nil
+}
+
+// WithCurrency reads the decimal amount of m in currency. Amount columns are
+// scanned in the default currency and fixed up with this once the currency
+// column is known.
+func (m Money) WithCurrency(currency string) (Money, error) {
+	return Parse(m.Decimal(), currency)
+}
+
+func (m Money) exponent() int {
+	if exp, ok := exponents[m.Currency]; ok {
+		return exp
+	}
+
+	return 2
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == o.Currency
+}
+
+// Add returns m + o. Adding to a zero value without a currency takes the
+// currency of o, so totals can start from Money{}.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency == "" && m.Amount == 0 {
+		return o, nil
+	}
+
+	if !m.SameCurrency(o) {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Cmp compares amounts of the same currency, returning -1, 0 or 1.
+func (m Money) Cmp(o Money) (int, error) {
+	if !m.SameCurrency(o) {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Decimal formats the amount in major units without the currency, e.g. "12.50".
+func (m Money) Decimal() string {
+	exp := m.exponent()
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	unit := int64(math.Pow10(exp))
+
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
+
+// Float returns the amount in major units, for external APIs that only
+// accept floating point numbers. Never use it for arithmetic.
+func (m Money) Float() float64 {
+	f, _ := strconv.ParseFloat(m.Decimal(), 64)
+	return f
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// method of [driver.Valuer] interface, only the amount is stored, the
+// currency lives in its own column
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// method of [sql.Scanner] interface
+func (m *Money) Scan(val interface{}) error {
+	var s string
+
+	switch v := val.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		s = "0"
+	default:
+		return fmt.Errorf("expected numeric, got %T", val)
+	}
+
+	parsed, err := Parse(s, m.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as a decimal string so clients never see
+// binary floating point, e.g. {"amount":"12.50","currency":"KZT"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+// UnmarshalJSON accepts the object form with the amount as a decimal string
+// or number. A bare amount is read in the default currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v := jsonMoney{}
+
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &v)
+	} else {
+		err = json.Unmarshal(data, &v.Amount)
+	}
+	if err != nil {
+		return err
+	}
+
+	parsed, err := Parse(v.Amount.String(), v.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+func (m Money) Proto() *moneypb.Money {
+	return &moneypb.Money{
+		Amount:   m.Amount,
+		Currency: m.Currency,
+	}
+}
+
+func FromProto(m *moneypb.Money) Money {
+	return New(m.GetAmount(), m.GetCurrency())
+}
@@ -0,0 +1,41 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s      string
+		amount int64
+		err    error
+	}{
+		{"12.50", 1250, nil},
+		{"-12.5", -1250, nil},
+		{" 7 ", 700, nil},
+		{".5", 50, nil},
+		{"1.230", 123, nil},
+		{"1.234", 0, ErrInvalidAmount},
+		{"--5", 0, ErrInvalidAmount},
+		{"-+5", 0, ErrInvalidAmount},
+		{"+5", 500, nil},
+		{"+-5", 0, ErrInvalidAmount},
+		{"5.-1", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			m, err := Parse(tt.s, "KZT")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if m.Amount != tt.amount {
+				t.Errorf("got amount %d, want %d", m.Amount, tt.amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+)
+
+// Contract checks the responses of a handler against a document, like the
+// contract command does for the running API, so services can check theirs
+// in tests. It remembers the operations it served, to tell which ones a
+// test left out.
+type Contract struct {
+	doc     *Document
+	handler http.Handler
+
+	served map[*Operation]bool
+}
+
+func NewContract(doc *Document, handler http.Handler) *Contract {
+	return &Contract{
+		doc:     doc,
+		handler: handler,
+		served:  make(map[*Operation]bool),
+	}
+}
+
+// Do serves req and validates the response, which is returned even when it
+// breaks the contract.
+func (c *Contract) Do(req *http.Request) (*httptest.ResponseRecorder, error) {
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+
+	if op, _, ok := c.doc.Find(req.Method, req.URL.Path); ok {
+		c.served[op] = true
+	}
+
+	if err := c.doc.ValidateResponse(req.Method, req.URL.Path, rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+		return rec, fmt.Errorf("%s %s: %d: %w", req.Method, req.URL.Path, rec.Code, err)
+	}
+
+	return rec, nil
+}
+
+// Unserved returns the operations on the paths include accepts that Do
+// never served, as "METHOD path".
+func (c *Contract) Unserved(include func(path string) bool) []string {
+	unserved := []string{}
+
+	for path, item := range c.doc.Paths {
+		if !include(path) {
+			continue
+		}
+
+		for method, op := range item {
+			if !c.served[op] {
+				unserved = append(unserved, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	sort.Strings(unserved)
+
+	return unserved
+}
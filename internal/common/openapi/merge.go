@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Merge adds the paths of a service's document that include accepts, with
+// the schemas and security schemes they use. A schema named like a
+// different one already in d is renamed after the service.
+func (d *Document) Merge(service string, from *Document, include func(path string) bool) error {
+	if d.Paths == nil {
+		d.Paths = make(map[string]PathItem)
+	}
+
+	if d.Components.Schemas == nil {
+		d.Components.Schemas = make(map[string]*Schema)
+	}
+
+	if d.Components.SecuritySchemes == nil {
+		d.Components.SecuritySchemes = make(map[string]SecurityScheme)
+	}
+
+	// Work on a copy, renaming rewrites the references in place
+	from, err := from.clone()
+	if err != nil {
+		return err
+	}
+
+	renamed := make(map[string]string)
+	for name, schema := range from.Components.Schemas {
+		if existing, ok := d.Components.Schemas[name]; ok && !reflect.DeepEqual(existing, schema) {
+			renamed[schemaRef+name] = schemaRef + service + "." + name
+		}
+	}
+
+	from.walkSchemas(func(s *Schema) {
+		if to, ok := renamed[s.Ref]; ok {
+			s.Ref = to
+		}
+	})
+
+	for name, schema := range from.Components.Schemas {
+		if to, ok := renamed[schemaRef+name]; ok {
+			name = strings.TrimPrefix(to, schemaRef)
+		}
+
+		d.Components.Schemas[name] = schema
+	}
+
+	for name, scheme := range from.Components.SecuritySchemes {
+		if _, ok := d.Components.SecuritySchemes[name]; !ok {
+			d.Components.SecuritySchemes[name] = scheme
+		}
+	}
+
+	for path, item := range from.Paths {
+		if !include(path) {
+			continue
+		}
+
+		merged, ok := d.Paths[path]
+		if !ok {
+			merged = make(PathItem)
+			d.Paths[path] = merged
+		}
+
+		for method, op := range item {
+			if _, ok := merged[method]; ok {
+				return fmt.Errorf("%s %s of %s is already documented", strings.ToUpper(method), path, service)
+			}
+
+			merged[method] = op
+		}
+	}
+
+	for _, tag := range from.Tags {
+		if !d.hasTag(tag.Name) {
+			d.Tags = append(d.Tags, tag)
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) hasTag(name string) bool {
+	for _, tag := range d.Tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Document) clone() (*Document, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Document
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
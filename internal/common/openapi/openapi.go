@@ -0,0 +1,259 @@
+// Package openapi holds OpenAPI 3 documents. The services generate theirs
+// from the swag annotations of their handlers and serve them, the gateway
+// merges them into one document describing everything it routes.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps the lower case methods of a path to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Schema is the subset of JSON Schema swag generates.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Example              any                `json:"example,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+
+	// XNullable is how Swagger 2.0 says nullable
+	XNullable bool `json:"x-nullable,omitempty"`
+}
+
+const schemaRef = "#/components/schemas/"
+
+// walk calls fn for the schema and every schema nested in it.
+func (s *Schema) walk(fn func(*Schema)) {
+	if s == nil {
+		return
+	}
+
+	fn(s)
+
+	s.Items.walk(fn)
+	s.AdditionalProperties.walk(fn)
+
+	for _, property := range s.Properties {
+		property.walk(fn)
+	}
+
+	for _, sub := range s.AllOf {
+		sub.walk(fn)
+	}
+}
+
+// walkSchemas calls fn for every schema of the document.
+func (d *Document) walkSchemas(fn func(*Schema)) {
+	for _, schema := range d.Components.Schemas {
+		schema.walk(fn)
+	}
+
+	for _, item := range d.Paths {
+		for _, op := range item {
+			for _, param := range op.Parameters {
+				param.Schema.walk(fn)
+			}
+
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					media.Schema.walk(fn)
+				}
+			}
+
+			for _, res := range op.Responses {
+				for _, media := range res.Content {
+					media.Schema.walk(fn)
+				}
+			}
+		}
+	}
+}
+
+// resolve follows the reference of a schema to its component.
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRef)]
+	}
+
+	return s
+}
+
+// Find returns the operation serving the request path and its path
+// parameters. Literal segments win over parameters, so /orders/search is
+// not taken for /orders/{id}.
+func (d *Document) Find(method, path string) (*Operation, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	templates := make([]string, 0, len(d.Paths))
+	for template := range d.Paths {
+		templates = append(templates, template)
+	}
+
+	// Templates with fewer parameters first, then in a stable order
+	sort.Slice(templates, func(i, j int) bool {
+		pi, pj := strings.Count(templates[i], "{"), strings.Count(templates[j], "{")
+		if pi != pj {
+			return pi < pj
+		}
+
+		return templates[i] < templates[j]
+	})
+
+	for _, template := range templates {
+		op, ok := d.Paths[template][strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+
+		if params, ok := matchPath(template, segments); ok {
+			return op, params, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+func matchPath(template string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(template, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+
+	for i, part := range parts {
+		if name, ok := pathParam(part); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+
+			params[name] = segments[i]
+			continue
+		}
+
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func pathParam(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
+
+// Handler serves a document, usually an embedded openapi.json.
+func Handler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+// Parse reads a document from JSON.
+func Parse(data []byte) (*Document, error) {
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
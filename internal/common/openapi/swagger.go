@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// swagger is the Swagger 2.0 document swag generates.
+type swagger struct {
+	Info                Info                                    `json:"info"`
+	BasePath            string                                  `json:"basePath"`
+	Consumes            []string                                `json:"consumes"`
+	Produces            []string                                `json:"produces"`
+	Tags                []Tag                                   `json:"tags"`
+	Paths               map[string]map[string]*swaggerOperation `json:"paths"`
+	Definitions         map[string]*Schema                      `json:"definitions"`
+	SecurityDefinitions map[string]SecurityScheme               `json:"securityDefinitions"`
+}
+
+type swaggerOperation struct {
+	Tags        []string                   `json:"tags"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description"`
+	OperationID string                     `json:"operationId"`
+	Consumes    []string                   `json:"consumes"`
+	Produces    []string                   `json:"produces"`
+	Parameters  []swaggerParameter         `json:"parameters"`
+	Responses   map[string]swaggerResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+	Deprecated  bool                       `json:"deprecated"`
+}
+
+type swaggerParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+
+	// The schema of parameters outside the body is inline
+	Type    string  `json:"type"`
+	Format  string  `json:"format"`
+	Items   *Schema `json:"items"`
+	Enum    []any   `json:"enum"`
+	Default any     `json:"default"`
+}
+
+type swaggerResponse struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+// FromSwagger converts a Swagger 2.0 document, as generated by swag, to
+// OpenAPI 3.
+func FromSwagger(data []byte) (*Document, error) {
+	var in swagger
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+
+	d := &Document{
+		OpenAPI: Version,
+		Info:    in.Info,
+		Tags:    in.Tags,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         in.Definitions,
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+
+	if in.BasePath != "" && in.BasePath != "/" {
+		d.Servers = []Server{{URL: in.BasePath}}
+	}
+
+	for name, scheme := range in.SecurityDefinitions {
+		if scheme.Type == "basic" {
+			scheme = SecurityScheme{Type: "http", Scheme: "basic", Description: scheme.Description}
+		}
+
+		d.Components.SecuritySchemes[name] = scheme
+	}
+
+	for path, methods := range in.Paths {
+		item := make(PathItem)
+
+		for method, op := range methods {
+			item[strings.ToLower(method)] = convertOperation(op, or(op.Consumes, in.Consumes), or(op.Produces, in.Produces))
+		}
+
+		d.Paths[path] = item
+	}
+
+	d.walkSchemas(func(s *Schema) {
+		if strings.HasPrefix(s.Ref, "#/definitions/") {
+			s.Ref = schemaRef + strings.TrimPrefix(s.Ref, "#/definitions/")
+		}
+
+		if s.XNullable {
+			s.Nullable, s.XNullable = true, false
+		}
+	})
+
+	return d, nil
+}
+
+func convertOperation(in *swaggerOperation, consumes, produces []string) *Operation {
+	op := &Operation{
+		Tags:        in.Tags,
+		Summary:     in.Summary,
+		Description: in.Description,
+		OperationID: in.OperationID,
+		Responses:   make(map[string]Response),
+		Security:    in.Security,
+		Deprecated:  in.Deprecated,
+	}
+
+	if len(consumes) == 0 {
+		consumes = []string{"application/json"}
+	}
+
+	if len(produces) == 0 {
+		produces = []string{"application/json"}
+	}
+
+	var form *Schema
+
+	for _, param := range in.Parameters {
+		switch param.In {
+		case "body":
+			op.RequestBody = &RequestBody{
+				Description: param.Description,
+				Required:    param.Required,
+				Content:     content(consumes, param.Schema),
+			}
+		case "formData":
+			if form == nil {
+				form = &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			}
+
+			form.Properties[param.Name] = param.schema()
+			if param.Required {
+				form.Required = append(form.Required, param.Name)
+			}
+		default:
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        param.Name,
+				In:          param.In,
+				Description: param.Description,
+				Required:    param.Required || param.In == "path",
+				Schema:      param.schema(),
+			})
+		}
+	}
+
+	if form != nil {
+		op.RequestBody = &RequestBody{Required: len(form.Required) > 0, Content: content(consumes, form)}
+	}
+
+	for status, res := range in.Responses {
+		op.Responses[status] = Response{
+			Description: res.Description,
+			Content:     content(produces, res.Schema),
+		}
+	}
+
+	return op
+}
+
+func (p swaggerParameter) schema() *Schema {
+	if p.Schema != nil {
+		return p.Schema
+	}
+
+	return &Schema{
+		Type:        p.Type,
+		Format:      p.Format,
+		Description: p.Description,
+		Items:       p.Items,
+		Enum:        p.Enum,
+		Default:     p.Default,
+	}
+}
+
+func content(types []string, schema *Schema) map[string]MediaType {
+	if schema == nil {
+		return nil
+	}
+
+	c := make(map[string]MediaType, len(types))
+	for _, t := range types {
+		c[t] = MediaType{Schema: schema}
+	}
+
+	return c
+}
+
+func or(values, fallback []string) []string {
+	if len(values) > 0 {
+		return values
+	}
+
+	return fallback
+}
+
+// Check finds the mistakes of annotations that drifted from their handlers:
+// path parameters missing from the route or missing a declaration, and
+// references to schemas that don't exist.
+func (d *Document) Check() error {
+	var errs []error
+
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		inPath := make(map[string]bool)
+		for _, segment := range strings.Split(path, "/") {
+			if name, ok := pathParam(segment); ok {
+				inPath[name] = true
+			}
+		}
+
+		for method, op := range d.Paths[path] {
+			declared := make(map[string]bool)
+
+			for _, param := range op.Parameters {
+				if param.In != "path" {
+					continue
+				}
+
+				declared[param.Name] = true
+
+				if !inPath[param.Name] {
+					errs = append(errs, fmt.Errorf("%s %s: path parameter %q is not in the path", strings.ToUpper(method), path, param.Name))
+				}
+			}
+
+			for name := range inPath {
+				if !declared[name] {
+					errs = append(errs, fmt.Errorf("%s %s: path parameter %q is not declared", strings.ToUpper(method), path, name))
+				}
+			}
+		}
+	}
+
+	d.walkSchemas(func(s *Schema) {
+		if s.Ref == "" {
+			return
+		}
+
+		if _, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRef)]; !ok {
+			errs = append(errs, fmt.Errorf("reference to unknown schema %s", s.Ref))
+		}
+	})
+
+	return errors.Join(errs...)
+}
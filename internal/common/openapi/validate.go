@@ -0,0 +1,210 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUndocumentedOperation = errors.New("operation is not documented")
+	ErrUndocumentedStatus    = errors.New("status is not documented")
+)
+
+// ValidateResponse checks a response to method and path against the
+// document: its status has to be documented and its body has to match the
+// schema of the status. Bodies that aren't JSON are taken as strings.
+func (d *Document) ValidateResponse(method, path string, status int, header http.Header, body []byte) error {
+	op, _, ok := d.Find(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s: %w", method, path, ErrUndocumentedOperation)
+	}
+
+	res, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		res, ok = op.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if !ok {
+		res, ok = op.Responses["default"]
+	}
+	if !ok {
+		return ErrUndocumentedStatus
+	}
+
+	var schema *Schema
+	for _, media := range res.Content {
+		schema = media.Schema
+		break
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	var value any = string(body)
+
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.Unmarshal(body, &value); err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+	}
+
+	return d.Validate(schema, value)
+}
+
+// Validate checks a value decoded from JSON against a schema of the
+// document.
+func (d *Document) Validate(schema *Schema, value any) error {
+	return d.validate("body", schema, value)
+}
+
+func (d *Document) validate(at string, schema *Schema, value any) error {
+	s := d.resolve(schema)
+	if s == nil {
+		return fmt.Errorf("%s: unknown schema %s", at, schema.Ref)
+	}
+
+	for _, sub := range s.AllOf {
+		if err := d.validate(at, sub, value); err != nil {
+			return err
+		}
+	}
+
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+
+		return fmt.Errorf("%s: is null, want %s", at, s.Type)
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return fmt.Errorf("%s: %v is not one of %v", at, value, s.Enum)
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+
+		return d.validateObject(at, s, object)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+
+		if s.Items == nil {
+			return nil
+		}
+
+		for i, item := range items {
+			if err := d.validate(at+"["+strconv.Itoa(i)+"]", s.Items, item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return mismatch(at, s.Type, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return mismatch(at, s.Type, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch(at, s.Type, value)
+		}
+	case "":
+		// Objects swag couldn't describe further
+		if len(s.Properties) > 0 {
+			if object, ok := value.(map[string]any); ok {
+				return d.validateObject(at, s, object)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) validateObject(at string, s *Schema, object map[string]any) error {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s.%s: is required", at, name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			property = s.AdditionalProperties
+		}
+
+		if property == nil {
+			continue
+		}
+
+		if err := d.validate(at+"."+name, property, object[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mismatch(at, want string, value any) error {
+	var got string
+
+	switch value.(type) {
+	case map[string]any:
+		got = "object"
+	case []any:
+		got = "array"
+	case string:
+		got = "string"
+	case float64:
+		got = "number"
+	case bool:
+		got = "boolean"
+	default:
+		got = fmt.Sprintf("%T", value)
+	}
+
+	return fmt.Errorf("%s: is %s, want %s", at, got, want)
+}
@@ -23,7 +23,8 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type OrdersClient interface {
 	UpdateOrderStatus(ctx context.Context, in *UpdateOrderStatusRequest, opts ...grpc.CallOption) (*UpdateOrderStatusResponse, error)
-	GetOrderProductIDs(ctx context.Context, in *GetOrderProductIDsRequest, opts ...grpc.CallOption) (*GetOrderProductIDsResponse, error)
+	GetOrderVariantIDs(ctx context.Context, in *GetOrderVariantIDsRequest, opts ...grpc.CallOption) (*GetOrderVariantIDsResponse, error)
+	GetOrderOwner(ctx context.Context, in *GetOrderOwnerRequest, opts ...grpc.CallOption) (*GetOrderOwnerResponse, error)
 }
 
 type ordersClient struct {
@@ -43,9 +44,18 @@ func (c *ordersClient) UpdateOrderStatus(ctx context.Context, in *UpdateOrderSta
 	return out, nil
 }
 
-func (c *ordersClient) GetOrderProductIDs(ctx context.Context, in *GetOrderProductIDsRequest, opts ...grpc.CallOption) (*GetOrderProductIDsResponse, error) {
-	out := new(GetOrderProductIDsResponse)
-	err := c.cc.Invoke(ctx, "/api.proto.Orders/GetOrderProductIDs", in, out, opts...)
+func (c *ordersClient) GetOrderVariantIDs(ctx context.Context, in *GetOrderVariantIDsRequest, opts ...grpc.CallOption) (*GetOrderVariantIDsResponse, error) {
+	out := new(GetOrderVariantIDsResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Orders/GetOrderVariantIDs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ordersClient) GetOrderOwner(ctx context.Context, in *GetOrderOwnerRequest, opts ...grpc.CallOption) (*GetOrderOwnerResponse, error) {
+	out := new(GetOrderOwnerResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Orders/GetOrderOwner", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +67,8 @@ func (c *ordersClient) GetOrderProductIDs(ctx context.Context, in *GetOrderProdu
 // for forward compatibility
 type OrdersServer interface {
 	UpdateOrderStatus(context.Context, *UpdateOrderStatusRequest) (*UpdateOrderStatusResponse, error)
-	GetOrderProductIDs(context.Context, *GetOrderProductIDsRequest) (*GetOrderProductIDsResponse, error)
+	GetOrderVariantIDs(context.Context, *GetOrderVariantIDsRequest) (*GetOrderVariantIDsResponse, error)
+	GetOrderOwner(context.Context, *GetOrderOwnerRequest) (*GetOrderOwnerResponse, error)
 	mustEmbedUnimplementedOrdersServer()
 }
 
@@ -68,8 +79,11 @@ type UnimplementedOrdersServer struct {
 func (UnimplementedOrdersServer) UpdateOrderStatus(context.Context, *UpdateOrderStatusRequest) (*UpdateOrderStatusResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateOrderStatus not implemented")
 }
-func (UnimplementedOrdersServer) GetOrderProductIDs(context.Context, *GetOrderProductIDsRequest) (*GetOrderProductIDsResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetOrderProductIDs not implemented")
+func (UnimplementedOrdersServer) GetOrderVariantIDs(context.Context, *GetOrderVariantIDsRequest) (*GetOrderVariantIDsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrderVariantIDs not implemented")
+}
+func (UnimplementedOrdersServer) GetOrderOwner(context.Context, *GetOrderOwnerRequest) (*GetOrderOwnerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrderOwner not implemented")
 }
 func (UnimplementedOrdersServer) mustEmbedUnimplementedOrdersServer() {}
 
@@ -102,20 +116,38 @@ func _Orders_UpdateOrderStatus_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Orders_GetOrderProductIDs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetOrderProductIDsRequest)
+func _Orders_GetOrderVariantIDs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderVariantIDsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrdersServer).GetOrderVariantIDs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Orders/GetOrderVariantIDs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrdersServer).GetOrderVariantIDs(ctx, req.(*GetOrderVariantIDsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orders_GetOrderOwner_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderOwnerRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(OrdersServer).GetOrderProductIDs(ctx, in)
+		return srv.(OrdersServer).GetOrderOwner(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/api.proto.Orders/GetOrderProductIDs",
+		FullMethod: "/api.proto.Orders/GetOrderOwner",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(OrdersServer).GetOrderProductIDs(ctx, req.(*GetOrderProductIDsRequest))
+		return srv.(OrdersServer).GetOrderOwner(ctx, req.(*GetOrderOwnerRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -132,8 +164,12 @@ var Orders_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Orders_UpdateOrderStatus_Handler,
 		},
 		{
-			MethodName: "GetOrderProductIDs",
-			Handler:    _Orders_GetOrderProductIDs_Handler,
+			MethodName: "GetOrderVariantIDs",
+			Handler:    _Orders_GetOrderVariantIDs_Handler,
+		},
+		{
+			MethodName: "GetOrderOwner",
+			Handler:    _Orders_GetOrderOwner_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -25,6 +25,11 @@ type ProductsClient interface {
 	UpdateProductStock(ctx context.Context, in *UpdateProductStockRequest, opts ...grpc.CallOption) (*UpdateProductStockResponse, error)
 	ProductsAvailable(ctx context.Context, in *ProductsAvailableRequest, opts ...grpc.CallOption) (*ProductsAvailableResponse, error)
 	GetProductPrices(ctx context.Context, in *GetProductPricesRequest, opts ...grpc.CallOption) (*GetProductPricesResponse, error)
+	ReserveStock(ctx context.Context, in *ReserveStockRequest, opts ...grpc.CallOption) (*ReserveStockResponse, error)
+	CommitReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error)
+	ReleaseReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error)
+	ReturnReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error)
+	ReturnStock(ctx context.Context, in *ReturnStockRequest, opts ...grpc.CallOption) (*ReturnStockResponse, error)
 }
 
 type productsClient struct {
@@ -62,6 +67,51 @@ func (c *productsClient) GetProductPrices(ctx context.Context, in *GetProductPri
 	return out, nil
 }
 
+func (c *productsClient) ReserveStock(ctx context.Context, in *ReserveStockRequest, opts ...grpc.CallOption) (*ReserveStockResponse, error) {
+	out := new(ReserveStockResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Products/ReserveStock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productsClient) CommitReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error) {
+	out := new(ReservationResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Products/CommitReservation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productsClient) ReleaseReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error) {
+	out := new(ReservationResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Products/ReleaseReservation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productsClient) ReturnReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*ReservationResponse, error) {
+	out := new(ReservationResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Products/ReturnReservation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *productsClient) ReturnStock(ctx context.Context, in *ReturnStockRequest, opts ...grpc.CallOption) (*ReturnStockResponse, error) {
+	out := new(ReturnStockResponse)
+	err := c.cc.Invoke(ctx, "/api.proto.Products/ReturnStock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ProductsServer is the server API for Products service.
 // All implementations must embed UnimplementedProductsServer
 // for forward compatibility
@@ -69,6 +119,11 @@ type ProductsServer interface {
 	UpdateProductStock(context.Context, *UpdateProductStockRequest) (*UpdateProductStockResponse, error)
 	ProductsAvailable(context.Context, *ProductsAvailableRequest) (*ProductsAvailableResponse, error)
 	GetProductPrices(context.Context, *GetProductPricesRequest) (*GetProductPricesResponse, error)
+	ReserveStock(context.Context, *ReserveStockRequest) (*ReserveStockResponse, error)
+	CommitReservation(context.Context, *ReservationRequest) (*ReservationResponse, error)
+	ReleaseReservation(context.Context, *ReservationRequest) (*ReservationResponse, error)
+	ReturnReservation(context.Context, *ReservationRequest) (*ReservationResponse, error)
+	ReturnStock(context.Context, *ReturnStockRequest) (*ReturnStockResponse, error)
 	mustEmbedUnimplementedProductsServer()
 }
 
@@ -85,6 +140,21 @@ func (UnimplementedProductsServer) ProductsAvailable(context.Context, *ProductsA
 func (UnimplementedProductsServer) GetProductPrices(context.Context, *GetProductPricesRequest) (*GetProductPricesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetProductPrices not implemented")
 }
+func (UnimplementedProductsServer) ReserveStock(context.Context, *ReserveStockRequest) (*ReserveStockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReserveStock not implemented")
+}
+func (UnimplementedProductsServer) CommitReservation(context.Context, *ReservationRequest) (*ReservationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitReservation not implemented")
+}
+func (UnimplementedProductsServer) ReleaseReservation(context.Context, *ReservationRequest) (*ReservationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseReservation not implemented")
+}
+func (UnimplementedProductsServer) ReturnReservation(context.Context, *ReservationRequest) (*ReservationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReturnReservation not implemented")
+}
+func (UnimplementedProductsServer) ReturnStock(context.Context, *ReturnStockRequest) (*ReturnStockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReturnStock not implemented")
+}
 func (UnimplementedProductsServer) mustEmbedUnimplementedProductsServer() {}
 
 // UnsafeProductsServer may be embedded to opt out of forward compatibility for this service.
@@ -152,6 +222,96 @@ func _Products_GetProductPrices_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Products_ReserveStock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReserveStockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductsServer).ReserveStock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Products/ReserveStock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductsServer).ReserveStock(ctx, req.(*ReserveStockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Products_CommitReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductsServer).CommitReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Products/CommitReservation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductsServer).CommitReservation(ctx, req.(*ReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Products_ReleaseReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductsServer).ReleaseReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Products/ReleaseReservation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductsServer).ReleaseReservation(ctx, req.(*ReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Products_ReturnReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductsServer).ReturnReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Products/ReturnReservation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductsServer).ReturnReservation(ctx, req.(*ReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Products_ReturnStock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReturnStockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductsServer).ReturnStock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.proto.Products/ReturnStock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductsServer).ReturnStock(ctx, req.(*ReturnStockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Products_ServiceDesc is the grpc.ServiceDesc for Products service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -171,6 +331,26 @@ var Products_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetProductPrices",
 			Handler:    _Products_GetProductPrices_Handler,
 		},
+		{
+			MethodName: "ReserveStock",
+			Handler:    _Products_ReserveStock_Handler,
+		},
+		{
+			MethodName: "CommitReservation",
+			Handler:    _Products_CommitReservation_Handler,
+		},
+		{
+			MethodName: "ReleaseReservation",
+			Handler:    _Products_ReleaseReservation_Handler,
+		},
+		{
+			MethodName: "ReturnReservation",
+			Handler:    _Products_ReturnReservation_Handler,
+		},
+		{
+			MethodName: "ReturnStock",
+			Handler:    _Products_ReturnStock_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "product.proto",
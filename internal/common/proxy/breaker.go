@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is the circuit breaker of an instance.
+type breaker struct {
+	name string
+	cfg  CircuitBreakerConfig
+
+	mu        sync.Mutex
+	state     int
+	failures  int
+	openUntil time.Time
+	probes    int
+}
+
+func newBreaker(name string, cfg CircuitBreakerConfig) *breaker {
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = Duration(30 * time.Second)
+	}
+
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	return &breaker{name: name, cfg: cfg}
+}
+
+// ready reports whether allow would let a request through, without taking
+// a probe.
+func (b *breaker) ready(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		return !now.Before(b.openUntil)
+	case breakerHalfOpen:
+		return b.probes < b.cfg.HalfOpenRequests
+	}
+
+	return true
+}
+
+// allow reports whether a request may go to the instance. Every allowed
+// request has to be followed by done.
+func (b *breaker) allow(now time.Time) bool {
+	if b.cfg.Failures == 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return false
+		}
+
+		b.state = breakerHalfOpen
+		b.probes = 0
+	}
+
+	if b.state == breakerHalfOpen {
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return false
+		}
+
+		b.probes++
+	}
+
+	return true
+}
+
+// done records the outcome of an allowed request.
+func (b *breaker) done(ok bool, now time.Time) {
+	if b.cfg.Failures == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		if ok {
+			b.failures = 0
+			return
+		}
+
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.open(now)
+		}
+	case breakerHalfOpen:
+		b.probes--
+
+		if ok {
+			b.state = breakerClosed
+			b.failures = 0
+
+			fmt.Printf("Closed circuit of %s\n", b.name)
+			return
+		}
+
+		b.open(now)
+	}
+}
+
+// cancel gives back what allow took for a request that was given up before
+// its outcome was known, leaving the state and the failures as they were.
+func (b *breaker) cancel() {
+	if b.cfg.Failures == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.failures = 0
+	b.openUntil = now.Add(time.Duration(b.cfg.OpenFor))
+
+	fmt.Printf("Opened circuit of %s for %s\n", b.name, time.Duration(b.cfg.OpenFor))
+}
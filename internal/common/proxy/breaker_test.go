@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+// request runs a request through b at now, it reports false if b didn't
+// let it through.
+func request(b *breaker, now time.Time, ok bool) bool {
+	if !b.allow(now) {
+		return false
+	}
+
+	b.done(ok, now)
+
+	return true
+}
+
+func newTestBreaker() *breaker {
+	return newBreaker("test", CircuitBreakerConfig{
+		Failures:         2,
+		OpenFor:          Duration(time.Second),
+		HalfOpenRequests: 1,
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	start := time.Now()
+	reopened := start.Add(time.Second)
+
+	t.Run("success resets failures", func(t *testing.T) {
+		b := newTestBreaker()
+
+		request(b, start, false)
+		request(b, start, true)
+		request(b, start, false)
+
+		if b.state != breakerClosed {
+			t.Errorf("got state %d after failures apart, want closed", b.state)
+		}
+	})
+
+	t.Run("probe closes", func(t *testing.T) {
+		b := newTestBreaker()
+
+		request(b, start, false)
+		request(b, start, false)
+
+		if b.state != breakerOpen || request(b, start, true) {
+			t.Fatal("circuit let a request through after the failures")
+		}
+
+		if !b.allow(reopened) {
+			t.Fatal("circuit didn't let a probe through after open_for")
+		}
+
+		if b.state != breakerHalfOpen || b.allow(reopened) {
+			t.Fatal("circuit let a second probe through")
+		}
+
+		b.done(true, reopened)
+
+		if b.state != breakerClosed || !request(b, reopened, true) {
+			t.Errorf("got state %d after a good probe, want closed", b.state)
+		}
+	})
+
+	t.Run("probe reopens", func(t *testing.T) {
+		b := newTestBreaker()
+
+		request(b, start, false)
+		request(b, start, false)
+
+		if !request(b, reopened, false) {
+			t.Fatal("circuit didn't let a probe through after open_for")
+		}
+
+		if b.state != breakerOpen || request(b, reopened, true) {
+			t.Errorf("got state %d after a failed probe, want open", b.state)
+		}
+
+		if !request(b, reopened.Add(time.Second), true) || b.state != breakerClosed {
+			t.Errorf("got state %d after the next good probe, want closed", b.state)
+		}
+	})
+}
+
+func TestBreakerCancel(t *testing.T) {
+	start := time.Now()
+	reopened := start.Add(time.Second)
+
+	t.Run("closed", func(t *testing.T) {
+		b := newTestBreaker()
+
+		request(b, start, false)
+
+		b.allow(start)
+		b.cancel()
+
+		request(b, start, false)
+
+		if b.state != breakerOpen {
+			t.Errorf("got state %d, want the canceled request to keep the failure", b.state)
+		}
+	})
+
+	t.Run("probe", func(t *testing.T) {
+		b := newTestBreaker()
+
+		request(b, start, false)
+		request(b, start, false)
+
+		if !b.allow(reopened) {
+			t.Fatal("circuit didn't let a probe through after open_for")
+		}
+
+		b.cancel()
+
+		if b.state != breakerHalfOpen {
+			t.Fatalf("got state %d after a canceled probe, want half-open", b.state)
+		}
+
+		// The slot of the canceled probe is free for the next one
+		if !request(b, reopened, false) || b.state != breakerOpen {
+			t.Errorf("got state %d after the next probe failed, want open", b.state)
+		}
+	})
+}
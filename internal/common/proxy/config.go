@@ -0,0 +1,156 @@
+// Package proxy forwards the gateway's requests to the services. A route
+// table maps path prefixes to services, each service is a pool of
+// instances that requests are balanced over, and instances failing their
+// health checks or requests are taken out of rotation until they recover.
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+)
+
+// Config is the route table, usually read from a JSON file with LoadConfig.
+type Config struct {
+	Routes   []Route                  `json:"routes"`
+	Services map[string]ServiceConfig `json:"services"`
+}
+
+// Route sends the requests whose path starts with Prefix to Service, the
+// longest matching prefix wins. Timeout overrides the service's.
+type Route struct {
+	Prefix  string   `json:"prefix"`
+	Service string   `json:"service"`
+	Timeout Duration `json:"timeout"`
+}
+
+type ServiceConfig struct {
+	// Upstreams are the base URLs of the instances.
+	Upstreams []string `json:"upstreams"`
+	// Balancer is round_robin, the default, or least_connections.
+	Balancer string `json:"balancer"`
+	// Spec is the path of the service's OpenAPI document, which the gateway
+	// merges into its own.
+	Spec string `json:"spec"`
+	// Timeout bounds a request including its retries, 30s if zero.
+	Timeout        Duration             `json:"timeout"`
+	Retry          RetryConfig          `json:"retry"`
+	HealthCheck    HealthCheckConfig    `json:"health_check"`
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+}
+
+// RetryConfig retries idempotent requests up to Retries times when they
+// failed to reach an instance or got 502, 503 or 504 from it, on another
+// instance when there is one. The wait before a retry starts at Backoff and
+// doubles up to MaxBackoff, with jitter.
+type RetryConfig struct {
+	Retries    int      `json:"retries"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+}
+
+// HealthCheckConfig polls every instance, those not answering with 2xx are
+// out of rotation until they do. An empty path disables the checks.
+type HealthCheckConfig struct {
+	Path     string   `json:"path"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+}
+
+// CircuitBreakerConfig takes an instance out of rotation for OpenFor after
+// Failures requests in a row failed. Then up to HalfOpenRequests requests
+// probe it at a time, the first to succeed puts it back into rotation and
+// a failure takes it out again. Zero Failures disables the breaker.
+type CircuitBreakerConfig struct {
+	Failures         int      `json:"failures"`
+	OpenFor          Duration `json:"open_for"`
+	HalfOpenRequests int      `json:"half_open_requests"`
+}
+
+// Duration reads durations like "10s" from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads the route table from a JSON file, expanding environment
+// variables like ${USER_HOST} in it first.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (cfg Config) Validate() error {
+	if len(cfg.Routes) == 0 {
+		return errors.New("no routes")
+	}
+
+	for _, route := range cfg.Routes {
+		if route.Prefix == "" {
+			return errors.New("route without a prefix")
+		}
+
+		if _, ok := cfg.Services[route.Service]; !ok {
+			return fmt.Errorf("route %s goes to unknown service %q", route.Prefix, route.Service)
+		}
+	}
+
+	for name, service := range cfg.Services {
+		if len(service.Upstreams) == 0 {
+			return fmt.Errorf("service %s has no upstreams", name)
+		}
+
+		for _, upstream := range service.Upstreams {
+			u, err := url.Parse(upstream)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("service %s has invalid upstream %q", name, upstream)
+			}
+		}
+
+		switch service.Balancer {
+		case "", RoundRobin, LeastConnections:
+		default:
+			return fmt.Errorf("service %s has unknown balancer %q", name, service.Balancer)
+		}
+	}
+
+	return nil
+}
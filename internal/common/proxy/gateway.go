@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+)
+
+// Gateway routes requests to the services in its route table, which can be
+// swapped while serving.
+type Gateway struct {
+	table atomic.Pointer[table]
+}
+
+type table struct {
+	cfg    Config
+	routes []Route
+	pools  map[string]*pool
+
+	stop context.CancelFunc
+}
+
+func New(cfg Config) (*Gateway, error) {
+	g := &Gateway{}
+
+	if err := g.Reload(cfg); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Reload replaces the route table. Requests already on their way finish
+// with the old one.
+func (g *Gateway) Reload(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	t := &table{
+		cfg:    cfg,
+		routes: append([]Route{}, cfg.Routes...),
+		pools:  make(map[string]*pool),
+		stop:   stop,
+	}
+
+	for i, route := range t.routes {
+		if len(route.Prefix) > 1 {
+			t.routes[i].Prefix = strings.TrimSuffix(route.Prefix, "/")
+		}
+	}
+
+	// Longest prefix first, so the most specific route wins
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		return len(t.routes[i].Prefix) > len(t.routes[j].Prefix)
+	})
+
+	for name, service := range cfg.Services {
+		p, err := newPool(name, service)
+		if err != nil {
+			stop()
+			return err
+		}
+
+		if service.HealthCheck.Path != "" {
+			go p.checkHealth(ctx, service.HealthCheck)
+		}
+
+		t.pools[name] = p
+	}
+
+	if old := g.table.Swap(t); old != nil {
+		old.stop()
+	}
+
+	for _, route := range t.routes {
+		fmt.Printf("Routing %s to %s %v\n", route.Prefix, route.Service, cfg.Services[route.Service].Upstreams)
+	}
+
+	return nil
+}
+
+// Watch reloads the route table whenever the file at path changes, until
+// ctx is done. A file that doesn't load leaves the current table in place.
+func (g *Gateway) Watch(ctx context.Context, path string, interval time.Duration) {
+	modified := modTime(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := modTime(path)
+		if current.Equal(modified) {
+			continue
+		}
+		modified = current
+
+		cfg, err := LoadConfig(path)
+		if err == nil {
+			err = g.Reload(cfg)
+		}
+		if err != nil {
+			fmt.Printf("Reloading routes failed, keeping the current ones: %v\n", err)
+			continue
+		}
+
+		fmt.Printf("Reloaded routes from %s\n", path)
+	}
+}
+
+// Close stops the health checks.
+func (g *Gateway) Close() {
+	if t := g.table.Load(); t != nil {
+		t.stop()
+	}
+}
+
+// Config returns the current route table.
+func (g *Gateway) Config() Config {
+	return g.table.Load().cfg
+}
+
+// Match returns the route of a path.
+func (g *Gateway) Match(path string) (Route, bool) {
+	return g.table.Load().match(path)
+}
+
+func (t *table) match(path string) (Route, bool) {
+	for _, route := range t.routes {
+		if path == route.Prefix || strings.HasPrefix(path, strings.TrimSuffix(route.Prefix, "/")+"/") {
+			return route, true
+		}
+	}
+
+	return Route{}, false
+}
+
+// Spec fetches the OpenAPI document of a service from one of its
+// instances.
+func (g *Gateway) Spec(ctx context.Context, service string) ([]byte, error) {
+	t := g.table.Load()
+
+	p, ok := t.pools[service]
+	if !ok || t.cfg.Services[service].Spec == "" {
+		return nil, fmt.Errorf("service %s has no spec", service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.cfg.Services[service].Spec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching spec of %s: %s", service, res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := g.table.Load()
+
+	route, ok := t.match(r.URL.Path)
+	if !ok {
+		response.NotFound(w, r, ErrNoRoute)
+		return
+	}
+
+	t.pools[route.Service].serve(w, r, time.Duration(route.Timeout))
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
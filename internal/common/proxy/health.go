@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// checkHealth polls the instances of the pool until ctx is done.
+func (p *pool) checkHealth(ctx context.Context, cfg HealthCheckConfig) {
+	interval := time.Duration(cfg.Interval)
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range p.upstreams {
+			u.setHealthy(probe(ctx, client, u.url.JoinPath(cfg.Path).String()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func probe(ctx context.Context, client *http.Client, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// Shutting down says nothing about the instance
+		return ctx.Err() != nil
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode >= 200 && res.StatusCode < 300
+}
@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/server"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+)
+
+// maxRetryBody is the largest request body kept to be sent again, requests
+// with larger bodies aren't retried.
+const maxRetryBody = 1 << 20
+
+var (
+	ErrNoRoute             = errors.New("no service for this path")
+	ErrNoHealthyUpstream   = errors.New("service unavailable")
+	ErrUpstreamUnavailable = errors.New("service didn't respond")
+	ErrUpstreamTimeout     = errors.New("service took too long to respond")
+)
+
+// upstream is one instance of a service.
+type upstream struct {
+	url     *url.URL
+	breaker *breaker
+
+	// active is the number of requests in flight
+	active atomic.Int64
+
+	mu      sync.Mutex
+	healthy bool
+}
+
+func (u *upstream) isHealthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.healthy
+}
+
+func (u *upstream) setHealthy(healthy bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if healthy && !u.healthy {
+		fmt.Printf("Upstream %s is healthy\n", u.url)
+	}
+	if !healthy && u.healthy {
+		fmt.Printf("Upstream %s failed its health check\n", u.url)
+	}
+
+	u.healthy = healthy
+}
+
+// pool balances the requests of a service over its instances. It is the
+// transport of its reverse proxy, so it picks the instance for every
+// attempt of a request and retries the failed ones.
+type pool struct {
+	name      string
+	upstreams []*upstream
+
+	balancer string
+	timeout  time.Duration
+	retry    RetryConfig
+
+	proxy     *httputil.ReverseProxy
+	transport http.RoundTripper
+
+	next atomic.Uint64
+}
+
+func newPool(name string, cfg ServiceConfig) (*pool, error) {
+	p := &pool{
+		name:      name,
+		balancer:  cfg.Balancer,
+		timeout:   time.Duration(cfg.Timeout),
+		retry:     cfg.Retry,
+		transport: http.DefaultTransport,
+	}
+
+	if p.timeout <= 0 {
+		p.timeout = 30 * time.Second
+	}
+
+	if p.retry.Backoff <= 0 {
+		p.retry.Backoff = Duration(100 * time.Millisecond)
+	}
+
+	if p.retry.MaxBackoff < p.retry.Backoff {
+		p.retry.MaxBackoff = p.retry.Backoff * 10
+	}
+
+	for _, raw := range cfg.Upstreams {
+		target, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		p.upstreams = append(p.upstreams, &upstream{
+			url:     target,
+			breaker: newBreaker(target.String(), cfg.CircuitBreaker),
+			healthy: true,
+		})
+	}
+
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
+			r.SetXForwarded()
+		},
+		Transport:    p,
+		ErrorHandler: p.proxyError,
+	}
+
+	return p, nil
+}
+
+// serve proxies the request, giving up after timeout, or the service's
+// timeout if zero.
+func (p *pool) serve(w http.ResponseWriter, r *http.Request, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = p.timeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	p.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (p *pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if retryable(req) {
+		retries = p.retry.Retries
+	}
+
+	var body []byte
+	if retries > 0 && req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength < 0 || req.ContentLength > maxRetryBody {
+			retries = 0
+		} else {
+			var err error
+			if body, err = io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			req.Body.Close()
+		}
+	}
+
+	tried := make(map[*upstream]bool)
+
+	for attempt := 0; ; attempt++ {
+		u := p.acquire(tried)
+		if u == nil {
+			return nil, ErrNoHealthyUpstream
+		}
+		tried[u] = true
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = u.url.Scheme
+		out.URL.Host = u.url.Host
+		out.URL.Path = strings.TrimSuffix(u.url.Path, "/") + req.URL.Path
+		out.URL.RawPath = ""
+		out.Host = ""
+
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		u.active.Add(1)
+
+		res, err := p.transport.RoundTrip(out)
+		if err != nil {
+			u.active.Add(-1)
+		} else {
+			res.Body = &countedBody{ReadCloser: res.Body, done: func() { u.active.Add(-1) }}
+		}
+
+		// The client gave up, which is no fault of the instance
+		if errors.Is(req.Context().Err(), context.Canceled) {
+			u.breaker.cancel()
+			return res, err
+		}
+
+		failed := err != nil || isUpstreamFailure(res.StatusCode)
+		u.breaker.done(!failed, time.Now())
+
+		if !failed || attempt >= retries || req.Context().Err() != nil {
+			return res, err
+		}
+
+		if err != nil {
+			fmt.Printf("Proxying %s to %s failed, retrying: %v\n", req.URL.Path, u.url, err)
+		} else {
+			fmt.Printf("Proxying %s to %s got %d, retrying\n", req.URL.Path, u.url, res.StatusCode)
+
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		if err := p.backoff(req.Context(), attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// acquire picks the instance for the next attempt of a request, preferring
+// those it wasn't sent to yet. It returns nil if no instance is in rotation.
+func (p *pool) acquire(tried map[*upstream]bool) *upstream {
+	now := time.Now()
+
+	candidates := make([]*upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if u.isHealthy() && u.breaker.ready(now) {
+			candidates = append(candidates, u)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if p.balancer == LeastConnections {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].active.Load() < candidates[j].active.Load()
+		})
+	} else {
+		start := int(p.next.Add(1) % uint64(len(candidates)))
+		candidates = append(candidates[start:], candidates[:start]...)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return !tried[candidates[i]] && tried[candidates[j]]
+	})
+
+	for _, u := range candidates {
+		if u.breaker.allow(now) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// backoff waits before the retry after attempt, until ctx is done.
+func (p *pool) backoff(ctx context.Context, attempt int) error {
+	wait := time.Duration(p.retry.Backoff) << attempt
+	if wait <= 0 || wait > time.Duration(p.retry.MaxBackoff) {
+		wait = time.Duration(p.retry.MaxBackoff)
+	}
+
+	// Anywhere from half to the full wait, so the retries of many clients
+	// don't arrive together
+	wait = wait/2 + rand.N(wait/2+1)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p *pool) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		// The client gave up, nobody reads the response
+	case errors.Is(err, ErrNoHealthyUpstream):
+		response.ServiceUnavailable(w, r, err)
+	case errors.Is(err, context.DeadlineExceeded) || r.Context().Err() != nil:
+		fmt.Printf("Proxying %s to %s timed out\n", r.URL.Path, p.name)
+
+		response.GatewayTimeout(w, r, ErrUpstreamTimeout)
+	default:
+		fmt.Printf("Proxying %s to %s failed: %v\n", r.URL.Path, p.name, err)
+
+		response.BadGateway(w, r, ErrUpstreamUnavailable)
+	}
+}
+
+// countedBody calls done once the response body is closed, which is when
+// the request stops occupying its instance.
+type countedBody struct {
+	io.ReadCloser
+
+	once sync.Once
+	done func()
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(b.done)
+
+	return b.ReadCloser.Close()
+}
+
+// retryable reports whether a request is safe to send again, because its
+// method is idempotent or an idempotency key guards it.
+func retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return r.Header.Get(server.IdempotencyKeyHeader) != ""
+}
+
+func isUpstreamFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
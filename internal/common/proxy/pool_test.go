@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/server"
+)
+
+// newUpstream serves status, counting the requests it got.
+func newUpstream(t *testing.T, status int, hits *atomic.Int32) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func TestPoolRetries(t *testing.T) {
+	var failing, working atomic.Int32
+
+	p, err := newPool("orders", ServiceConfig{
+		Upstreams: []string{newUpstream(t, http.StatusServiceUnavailable, &failing), newUpstream(t, http.StatusOK, &working)},
+		Retry:     RetryConfig{Retries: 1, Backoff: Duration(time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		p.serve(rec, req, 0)
+
+		return rec.Code
+	}
+
+	// Requests round robin sends to the failing instance are retried on the
+	// other one
+	for i := 0; i < 4; i++ {
+		if status := serve(httptest.NewRequest(http.MethodGet, "/orders", nil)); status != http.StatusOK {
+			t.Errorf("get %d: got status %d, want %d", i, status, http.StatusOK)
+		}
+	}
+
+	if failing.Load() == 0 || working.Load() != 4 {
+		t.Errorf("got %d requests to the failing instance and %d to the working one, want some and 4", failing.Load(), working.Load())
+	}
+
+	// A POST is only sent again with an idempotency key
+	statuses := map[int]int{}
+	for i := 0; i < 2; i++ {
+		statuses[serve(httptest.NewRequest(http.MethodPost, "/orders", nil))]++
+	}
+
+	if statuses[http.StatusServiceUnavailable] != 1 {
+		t.Errorf("got statuses %v of posts without a key, want one failed", statuses)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set(server.IdempotencyKeyHeader, "key")
+
+		if status := serve(req); status != http.StatusOK {
+			t.Errorf("post with a key: got status %d, want %d", status, http.StatusOK)
+		}
+	}
+}
+
+func TestPoolBreaker(t *testing.T) {
+	var failing, working atomic.Int32
+
+	p, err := newPool("orders", ServiceConfig{
+		Upstreams:      []string{newUpstream(t, http.StatusServiceUnavailable, &failing), newUpstream(t, http.StatusOK, &working)},
+		Retry:          RetryConfig{Retries: 1, Backoff: Duration(time.Millisecond)},
+		CircuitBreaker: CircuitBreakerConfig{Failures: 1, OpenFor: Duration(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		p.serve(rec, httptest.NewRequest(http.MethodGet, "/orders", nil), 0)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("get %d: got status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+
+	// The failing instance is out of rotation after its first failure
+	if failing.Load() != 1 {
+		t.Errorf("got %d requests to the failing instance, want 1", failing.Load())
+	}
+}
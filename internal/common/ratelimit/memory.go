@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the buckets of a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+
+	fullAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, has := s.buckets[key]
+	if !has {
+		b = &memoryBucket{bucket: newBucket(limit, now)}
+		s.buckets[key] = b
+	}
+
+	res := b.take(limit, now)
+	b.fullAt = b.bucket.fullAt(limit)
+
+	return res, nil
+}
+
+// sweep drops the buckets that have refilled, which are no different from
+// new ones, at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.After(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
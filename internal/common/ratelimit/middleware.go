@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+)
+
+var (
+	ErrRateLimited = errors.New("too many requests, slow down")
+	ErrUnavailable = errors.New("rate limiting is unavailable, try again later")
+)
+
+// KeyFunc returns whose bucket a request draws from, an empty key leaves
+// the request alone.
+type KeyFunc func(r *http.Request) string
+
+// ByIP keys requests by client address. TrustedProxies is the number of
+// proxies in front of the service that append to X-Forwarded-For, the
+// address the outermost of them was connected from is used. Without trusted
+// proxies, or when the header is shorter than the chain, the address of the
+// connection is used, so it must not be rewritten from client headers
+// before.
+func ByIP(trustedProxies int) KeyFunc {
+	return func(r *http.Request) string {
+		if trustedProxies > 0 {
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				for _, hop := range strings.Split(header, ",") {
+					hops = append(hops, strings.TrimSpace(hop))
+				}
+			}
+
+			// Entries left of the outermost trusted proxy's are client supplied
+			if len(hops) >= trustedProxies {
+				if hop := hops[len(hops)-trustedProxies]; hop != "" {
+					return hop
+				}
+			}
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+
+		return host
+	}
+}
+
+// ByUser keys requests by the authenticated user, anonymous requests are
+// left alone.
+func ByUser(r *http.Request) string {
+	return r.Header.Get(auth.UserIDHeader)
+}
+
+// ByUserOrIP keys requests by the authenticated user and anonymous ones by
+// client address, see ByIP.
+func ByUserOrIP(trustedProxies int) KeyFunc {
+	byIP := ByIP(trustedProxies)
+
+	return func(r *http.Request) string {
+		if user := ByUser(r); user != "" {
+			return "user:" + user
+		}
+
+		return "ip:" + byIP(r)
+	}
+}
+
+// Rule limits the requests matching its method and either its exact path or
+// its path prefix, empty ones match everything. Name tells the buckets of
+// different rules apart.
+type Rule struct {
+	Name   string
+	Method string
+	Path   string
+	Prefix string
+	Key    KeyFunc
+	Limit  Limit
+	// FailClosed rejects the requests with 503 while the store fails, they
+	// go through otherwise.
+	FailClosed bool
+}
+
+func (rule Rule) match(r *http.Request) bool {
+	if rule.Method != "" && rule.Method != r.Method {
+		return false
+	}
+
+	if rule.Path != "" {
+		return strings.TrimSuffix(r.URL.Path, "/") == strings.TrimSuffix(rule.Path, "/")
+	}
+
+	return strings.HasPrefix(r.URL.Path, rule.Prefix)
+}
+
+// Middleware takes a token for every matching rule and rejects the request
+// with 429 at the first empty bucket. The rules after it keep their tokens,
+// so the strictest rules should come first. The RateLimit headers describe
+// the bucket closest to running out. Rules with a zero limit are skipped.
+func Middleware(store Store, rules ...Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tightest *Result
+
+			for _, rule := range rules {
+				if rule.Limit.IsZero() || !rule.match(r) {
+					continue
+				}
+
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+
+				res, err := store.Take(r.Context(), rule.Name+":"+key, rule.Limit)
+				if err != nil {
+					fmt.Printf("Rate limiting %s failed: %v\n", rule.Name, err)
+
+					if rule.FailClosed {
+						response.ServiceUnavailable(w, r, ErrUnavailable)
+						return
+					}
+					continue
+				}
+
+				if !res.Allowed {
+					setHeaders(w, res)
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+
+					response.TooManyRequests(w, r, ErrRateLimited)
+					return
+				}
+
+				if tightest == nil || res.Remaining < tightest.Remaining {
+					tightest = &res
+				}
+			}
+
+			if tightest != nil {
+				setHeaders(w, *tightest)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setHeaders(w http.ResponseWriter, res Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(int(res.Limit.capacity())))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	w.Header().Set("RateLimit-Policy", res.Limit.Policy())
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
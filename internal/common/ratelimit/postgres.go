@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore keeps the buckets in the rate_limit_buckets table, so every
+// gateway replica draws from the same buckets.
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &PostgresStore{
+		db: db,
+	}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().UTC()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	b := newBucket(limit, now)
+
+	q := `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (key) DO NOTHING
+	`
+
+	if _, err = tx.ExecContext(ctx, q, key, b.tokens, b.updatedAt); err != nil {
+		return Result{}, err
+	}
+
+	q = "SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE"
+
+	if err = tx.QueryRowContext(ctx, q, key).Scan(&b.tokens, &b.updatedAt); err != nil {
+		return Result{}, err
+	}
+
+	res := b.take(limit, now)
+
+	q = "UPDATE rate_limit_buckets SET tokens = $1, updated_at = $2, full_at = $3 WHERE key = $4"
+
+	if _, err = tx.ExecContext(ctx, q, b.tokens, b.updatedAt, b.fullAt(limit), key); err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// Purge deletes the buckets that have refilled, they are no different from
+// new ones.
+func (s *PostgresStore) Purge(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE full_at < NOW()")
+	return err
+}
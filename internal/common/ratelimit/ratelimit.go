@@ -0,0 +1,139 @@
+// Package ratelimit throttles requests with token buckets. Every bucket
+// holds up to Burst tokens and gains Requests tokens each Per, a request
+// takes one token and is rejected when the bucket is empty.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit, expected requests/period or requests/period/burst")
+
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	// Burst is the size of the bucket, Requests if zero.
+	Burst int
+}
+
+// ParseLimit reads a limit like 100/1m, or 100/1m/20 to allow bursts of 20
+// requests. An empty string is the zero limit, which disables limiting.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	l := Limit{Requests: requests, Per: per}
+
+	if len(parts) == 3 {
+		if l.Burst, err = strconv.Atoi(parts[2]); err != nil || l.Burst <= 0 {
+			return Limit{}, ErrInvalidLimit
+		}
+	}
+
+	return l, nil
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests == 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return float64(l.Requests)
+}
+
+// rate is the number of tokens gained per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Policy describes the limit for the RateLimit-Policy header.
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", int(l.capacity()), int(math.Ceil(l.Per.Seconds()*l.capacity()/float64(l.Requests))))
+}
+
+type Result struct {
+	Limit   Limit
+	Allowed bool
+	// Remaining is the number of tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, zero if allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets.
+type Store interface {
+	// Take takes a token from the bucket of the key if there is one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newBucket(limit Limit, now time.Time) bucket {
+	return bucket{
+		tokens:    limit.capacity(),
+		updatedAt: now,
+	}
+}
+
+// take refills the bucket for the time since it was last used and takes a
+// token if there is one.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens = math.Min(limit.capacity(), b.tokens+elapsed.Seconds()*limit.rate())
+	}
+	b.updatedAt = now
+
+	res := Result{Limit: limit}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.rate())
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((limit.capacity() - b.tokens) / limit.rate())
+
+	return res
+}
+
+// fullAt is when the bucket has refilled completely and can be forgotten.
+func (b *bucket) fullAt(limit Limit) time.Time {
+	return b.updatedAt.Add(seconds((limit.capacity() - b.tokens) / limit.rate()))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit Limit
+		err   error
+	}{
+		{"", Limit{}, nil},
+		{"100/1m", Limit{Requests: 100, Per: time.Minute}, nil},
+		{"10/1s/20", Limit{Requests: 10, Per: time.Second, Burst: 20}, nil},
+		{"100", Limit{}, ErrInvalidLimit},
+		{"0/1m", Limit{}, ErrInvalidLimit},
+		{"100/minute", Limit{}, ErrInvalidLimit},
+		{"10/1s/0", Limit{}, ErrInvalidLimit},
+		{"10/1s/20/5", Limit{}, ErrInvalidLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			limit, err := ParseLimit(tt.s)
+			if limit != tt.limit || !errors.Is(err, tt.err) {
+				t.Errorf("got %+v, %v, want %+v, %v", limit, err, tt.limit, tt.err)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	limit := Limit{Requests: 2, Per: time.Second, Burst: 3}
+	now := time.Now()
+
+	b := newBucket(limit, now)
+
+	for i := 0; i < 3; i++ {
+		if res := b.take(limit, now); !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: got %+v, want it allowed with %d left", i, res, 2-i)
+		}
+	}
+
+	res := b.take(limit, now)
+	if res.Allowed {
+		t.Fatal("got a request allowed past the burst")
+	}
+
+	if res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Errorf("got retry after %s and reset %s, want 500ms and 1.5s", res.RetryAfter, res.Reset)
+	}
+
+	// Half a second refills one token
+	if res := b.take(limit, now.Add(500*time.Millisecond)); !res.Allowed {
+		t.Error("got a request rejected after a refill")
+	}
+
+	// The bucket never holds more than the burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		b.take(limit, later)
+	}
+
+	if res := b.take(limit, later); res.Allowed {
+		t.Error("got a request allowed past the burst after a long wait")
+	}
+}
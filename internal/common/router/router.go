@@ -5,12 +5,33 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func New() *chi.Mux {
+type config struct {
+	realIP bool
+}
+
+// WithoutRealIP keeps the address of the connection as the remote address.
+// Services behind the gateway take the client's address from the headers it
+// sets, the gateway itself can't trust the headers clients send.
+func WithoutRealIP() func(*config) {
+	return func(c *config) {
+		c.realIP = false
+	}
+}
+
+func New(configs ...func(*config)) *chi.Mux {
+	c := &config{realIP: true}
+
+	for _, cfg := range configs {
+		cfg(c)
+	}
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
 
-	r.Use(middleware.RealIP)
+	if c.realIP {
+		r.Use(middleware.RealIP)
+	}
 
 	r.Use(middleware.Logger)
 
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceNameMetadata carries the calling service's name on connections
+// without TLS, where there is no certificate to take it from.
+const ServiceNameMetadata = "x-service-name"
+
+type GRPCConfig struct {
+	tls      *tls.Config
+	insecure bool
+
+	callers map[string][]string
+}
+
+// WithGRPCTLS serves over mutual TLS, callers must present a certificate
+// signed by the configured CA. Without it the server refuses to start unless
+// WithGRPCInsecure allows plain text.
+func WithGRPCTLS(cfg *tls.Config) func(*GRPCConfig) {
+	return func(c *GRPCConfig) {
+		c.tls = cfg
+	}
+}
+
+// WithGRPCInsecure lets the server run in plain text when there is no TLS
+// config, trusting the service name callers declare. It is only fit for
+// local development.
+func WithGRPCInsecure(allow bool) func(*GRPCConfig) {
+	return func(c *GRPCConfig) {
+		c.insecure = allow
+	}
+}
+
+// WithGRPCCallers only lets the listed services call each method, keyed by
+// full method name like /api.proto.Orders/UpdateOrderStatus. Methods that
+// aren't listed can't be called at all.
+func WithGRPCCallers(callers map[string][]string) func(*GRPCConfig) {
+	return func(c *GRPCConfig) {
+		c.callers = callers
+	}
+}
+
+func WithGRPCServer(register func(*grpc.Server), port string, configs ...func(*GRPCConfig)) Configuration {
+	return func(r *Server) (err error) {
+		cfg := &GRPCConfig{}
+		for _, config := range configs {
+			config(cfg)
+		}
+
+		if cfg.tls == nil && !cfg.insecure {
+			return errors.New("gRPC server needs TLS certificates, set GRPC_TLS_DIR or GRPC_INSECURE=true")
+		}
+
+		opts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(cfg.authorizeUnary),
+			grpc.ChainStreamInterceptor(cfg.authorizeStream),
+		}
+
+		if cfg.tls != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(cfg.tls)))
+		}
+
+		r.grpc = grpc.NewServer(opts...)
+		register(r.grpc)
+
+		r.listener, err = net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", port))
+		return err
+	}
+}
+
+func (c *GRPCConfig) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := c.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (c *GRPCConfig) authorizeStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := c.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+func (c *GRPCConfig) authorize(ctx context.Context, method string) error {
+	service := c.caller(ctx)
+	if service == "" {
+		return status.Error(codes.Unauthenticated, "unknown calling service")
+	}
+
+	if !slices.Contains(c.callers[method], service) {
+		return status.Errorf(codes.PermissionDenied, "%s may not call %s", service, method)
+	}
+
+	return nil
+}
+
+// caller returns the name of the calling service, the common name of its
+// verified certificate when serving over TLS.
+func (c *GRPCConfig) caller(ctx context.Context) string {
+	if c.tls == nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if names := md.Get(ServiceNameMetadata); len(names) == 1 {
+			return names[0]
+		}
+
+		return ""
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return info.State.VerifiedChains[0][0].Subject.CommonName
+}
+
+// DialGRPC connects the named service to another one, over mutual TLS if
+// tlsConfig is set. The server's certificate has to be issued for the host
+// of the target.
+func DialGRPC(target, service string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	if tlsConfig != nil {
+		return grpc.NewClient(target, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	return grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, ServiceNameMetadata, service)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx = metadata.AppendToOutgoingContext(ctx, ServiceNameMetadata, service)
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	)
+}
+
+// LoadGRPCTLS reads the CA and the service's certificate from dir, as
+// ca.pem, <service>.pem and <service>-key.pem. The same certificate serves
+// and identifies the service as a client. An empty dir disables TLS and
+// returns nil.
+func LoadGRPCTLS(dir, service string) (*tls.Config, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, service+".pem"), filepath.Join(dir, service+"-key.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in " + filepath.Join(dir, "ca.pem"))
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from the cache.
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	idempotencyLockTimeout  = time.Minute
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was already used for a different request")
+)
+
+// StoredResponse is a response kept under its idempotency key.
+type StoredResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// Fingerprint is the hash of the request the response was for.
+	Fingerprint string `json:"fingerprint"`
+}
+
+type IdempotencyCache interface {
+	store.Cache[StoredResponse]
+	store.Locker
+}
+
+// Idempotency replays the stored response for a request that repeats the
+// Idempotency-Key header of an earlier one instead of handling it again.
+// Requests without the header and safe methods pass through. While the
+// first request is in progress, repeats get 409, and server errors aren't
+// stored so the client can retry.
+func Idempotency(cache IdempotencyCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+
+			if idempotencyKey == "" || isSafeMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				response.BadRequest(w, r, []response.ErrorResponse{{
+					Message: "idempotency key is too long",
+					Field:   IdempotencyKeyHeader,
+				}})
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				response.BadRequest(w, r, []response.ErrorResponse{{
+					Message: err.Error(),
+					Field:   "body",
+				}})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are per user, nobody gets replayed someone else's response
+			key := r.Method + " " + r.URL.Path + " " + r.Header.Get(auth.UserIDHeader) + " " + idempotencyKey
+			fingerprint := requestFingerprint(r, body)
+
+			if stored, has := cache.Get(key); has {
+				replay(w, r, stored, fingerprint)
+				return
+			}
+
+			if !cache.Lock(key, idempotencyLockTimeout) {
+				// The first request may have finished in between
+				if stored, has := cache.Get(key); has {
+					replay(w, r, stored, fingerprint)
+					return
+				}
+
+				response.Conflict(w, r, ErrIdempotencyKeyInUse)
+				return
+			}
+			defer cache.Unlock(key)
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+
+			cache.Set(key, StoredResponse{
+				Status:      rec.status,
+				Header:      w.Header().Clone(),
+				Body:        rec.body.Bytes(),
+				Fingerprint: fingerprint,
+			})
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, stored StoredResponse, fingerprint string) {
+	if stored.Fingerprint != fingerprint {
+		response.UnprocessableEntity(w, r, ErrIdempotencyKeyMismatch)
+		return
+	}
+
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayHeader, "true")
+
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.URL.RawQuery))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// responseRecorder passes the response through while keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+func newIdempotentRequest(key, userID, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	req.Header.Set(auth.UserIDHeader, userID)
+
+	return req
+}
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	var calls atomic.Int32
+
+	h := Idempotency(store.NewInMemoryIdempotencyCache[StoredResponse](time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+
+		w.Write([]byte("order1"))
+	}))
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- serve(h, newIdempotentRequest("key1", "user1", `{"items":[]}`))
+	}()
+
+	<-entered
+
+	if rec := serve(h, newIdempotentRequest("key1", "user1", `{"items":[]}`)); rec.Code != http.StatusConflict {
+		t.Errorf("repeat in flight: got status %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	close(release)
+
+	if rec := <-first; rec.Code != http.StatusOK || rec.Body.String() != "order1" {
+		t.Fatalf("first request: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := serve(h, newIdempotentRequest("key1", "user1", `{"items":[]}`))
+	if rec.Code != http.StatusOK || rec.Body.String() != "order1" || rec.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Errorf("repeat after: got status %d %q, want the replayed response", rec.Code, rec.Body)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want once", n)
+	}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls atomic.Int32
+
+	h := Idempotency(store.NewInMemoryIdempotencyCache[StoredResponse](time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte(strconv.Itoa(int(n))))
+	}))
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		body   string
+	}{
+		{"first", newIdempotentRequest("key1", "user1", "a"), http.StatusOK, "1"},
+		{"repeat", newIdempotentRequest("key1", "user1", "a"), http.StatusOK, "1"},
+		{"other body", newIdempotentRequest("key1", "user1", "b"), http.StatusUnprocessableEntity, ""},
+		{"other user", newIdempotentRequest("key1", "user2", "a"), http.StatusOK, "2"},
+		{"without key", newIdempotentRequest("", "user1", "a"), http.StatusOK, "3"},
+		{"too long key", newIdempotentRequest(strings.Repeat("k", 256), "user1", "a"), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		rec := serve(h, tt.req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: got body %q, want %q", tt.name, rec.Body, tt.body)
+		}
+	}
+
+	// Server errors aren't stored, the retry runs again
+	failed := newIdempotentRequest("key2", "user1", "a")
+	failed.Header.Set("X-Fail", "true")
+	serve(h, failed)
+
+	if rec := serve(h, newIdempotentRequest("key2", "user1", "a")); rec.Body.String() != "5" {
+		t.Errorf("retry after a server error: got body %q, want a new response", rec.Body)
+	}
+}
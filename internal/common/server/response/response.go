@@ -17,24 +17,97 @@ type Object struct {
 	Data    any    `json:"data,omitempty"`
 }
 
+// Page is a page of a list, Next and Prev are the cursors of the pages
+// around it and Total counts the items of all pages.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Total int    `json:"total"`
+}
+
 func OK(w http.ResponseWriter, r *http.Request, data any) {
 	render.Status(r, http.StatusOK)
 
 	render.JSON(w, r, data)
 }
 
+// NewPage builds a page, an empty page has no items rather than null.
+func NewPage[T any](items []T, next, prev string, total int) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	return Page[T]{Items: items, Next: next, Prev: prev, Total: total}
+}
+
+// Paginated answers with a page of a list.
+func Paginated[T any](w http.ResponseWriter, r *http.Request, items []T, next, prev string, total int) {
+	OK(w, r, NewPage(items, next, prev, total))
+}
+
 func BadRequest(w http.ResponseWriter, r *http.Request, errs []ErrorResponse) {
 	render.Status(r, http.StatusBadRequest)
 
 	render.JSON(w, r, errs)
 }
 
+func Unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusUnauthorized)
+
+	render.PlainText(w, r, err.Error())
+}
+
+func Forbidden(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusForbidden)
+
+	render.PlainText(w, r, err.Error())
+}
+
 func NotFound(w http.ResponseWriter, r *http.Request, err error) {
 	render.Status(r, http.StatusNotFound)
 
 	render.PlainText(w, r, err.Error())
 }
 
+func Conflict(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusConflict)
+
+	render.PlainText(w, r, err.Error())
+}
+
+func UnprocessableEntity(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusUnprocessableEntity)
+
+	render.PlainText(w, r, err.Error())
+}
+
+func TooManyRequests(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusTooManyRequests)
+
+	render.PlainText(w, r, err.Error())
+}
+
+// BadGateway, ServiceUnavailable and GatewayTimeout answer for a service
+// that couldn't, so their bodies look like the services' error bodies.
+func BadGateway(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusBadGateway)
+
+	render.JSON(w, r, []ErrorResponse{{Message: err.Error()}})
+}
+
+func ServiceUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusServiceUnavailable)
+
+	render.JSON(w, r, []ErrorResponse{{Message: err.Error()}})
+}
+
+func GatewayTimeout(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusGatewayTimeout)
+
+	render.JSON(w, r, []ErrorResponse{{Message: err.Error()}})
+}
+
 func InternalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	render.Status(r, http.StatusInternalServerError)
 
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"net/http"
 
@@ -52,7 +51,13 @@ func (r *Server) Start() error {
 }
 
 func (r *Server) Stop(ctx context.Context) error {
-	return r.http.Shutdown(ctx)
+	err := r.http.Shutdown(ctx)
+
+	if r.grpc != nil {
+		r.grpc.GracefulStop()
+	}
+
+	return err
 }
 
 func WithHTTPServer(handler http.Handler, port string) Configuration {
@@ -64,11 +69,3 @@ func WithHTTPServer(handler http.Handler, port string) Configuration {
 		return nil
 	}
 }
-
-func WithGRPCServer(server *grpc.Server, port string) Configuration {
-	return func(r *Server) (err error) {
-		r.listener, err = net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", port))
-		r.grpc = server
-		return err
-	}
-}
@@ -3,6 +3,7 @@ package store
 import (
 	"encoding/json"
 	"sync"
+	"time"
 )
 
 type Cache[T any] interface {
@@ -10,12 +11,38 @@ type Cache[T any] interface {
 	Set(key string, value T)
 }
 
+// Locker is implemented by caches that can mark a key as being worked on,
+// so concurrent requests with the same key don't both run. A lock that
+// isn't released expires after the timeout.
+type Locker interface {
+	Lock(key string, timeout time.Duration) bool
+	Unlock(key string)
+}
+
+// Taker is implemented by caches that can remove an entry as they read it,
+// so a value is handed out at most once.
+type Taker[T any] interface {
+	Take(key string) (T, bool)
+}
+
+// InMemoryIdempotencyCache keeps values in the process, entries are lost on
+// restart and aren't shared between replicas.
 type InMemoryIdempotencyCache[T any] struct {
 	cache sync.Map
+	locks sync.Map
+
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	data      []byte
+	expiresAt time.Time
 }
 
-func NewInMemoryIdempotencyCache[T any]() *InMemoryIdempotencyCache[T] {
-	return &InMemoryIdempotencyCache[T]{}
+// NewInMemoryIdempotencyCache returns a cache whose entries expire after
+// ttl, a zero ttl keeps them forever.
+func NewInMemoryIdempotencyCache[T any](ttl time.Duration) *InMemoryIdempotencyCache[T] {
+	return &InMemoryIdempotencyCache[T]{ttl: ttl}
 }
 
 func (c *InMemoryIdempotencyCache[T]) Get(key string) (val T, has bool) {
@@ -24,7 +51,13 @@ func (c *InMemoryIdempotencyCache[T]) Get(key string) (val T, has bool) {
 		return
 	}
 
-	err := json.Unmarshal(v.([]byte), &val)
+	entry := v.(cacheEntry)
+	if expired(entry.expiresAt) {
+		c.cache.CompareAndDelete(key, v)
+		return val, false
+	}
+
+	err := json.Unmarshal(entry.data, &val)
 	if err != nil {
 		return
 	}
@@ -38,5 +71,53 @@ func (c *InMemoryIdempotencyCache[T]) Set(key string, value T) {
 		return
 	}
 
-	c.cache.Store(key, data)
+	c.cache.Store(key, cacheEntry{data: data, expiresAt: expiresAt(c.ttl)})
+}
+
+func (c *InMemoryIdempotencyCache[T]) Take(key string) (val T, has bool) {
+	v, has := c.cache.LoadAndDelete(key)
+	if !has {
+		return
+	}
+
+	entry := v.(cacheEntry)
+	if expired(entry.expiresAt) {
+		return val, false
+	}
+
+	if err := json.Unmarshal(entry.data, &val); err != nil {
+		return val, false
+	}
+
+	return val, true
+}
+
+func (c *InMemoryIdempotencyCache[T]) Lock(key string, timeout time.Duration) bool {
+	until := time.Now().Add(timeout)
+
+	v, loaded := c.locks.LoadOrStore(key, until)
+	if !loaded {
+		return true
+	}
+
+	// Take over a lock its holder never released
+	return time.Now().After(v.(time.Time)) && c.locks.CompareAndSwap(key, v, until)
+}
+
+func (c *InMemoryIdempotencyCache[T]) Unlock(key string) {
+	c.locks.Delete(key)
+}
+
+// expiresAt returns when an entry stored now expires, the zero time if it
+// never does.
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(ttl)
+}
+
+func expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && time.Now().After(expiresAt)
 }
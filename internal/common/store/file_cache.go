@@ -0,0 +1,131 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileCache keeps every value in its own file under a directory, for single
+// instance deployments without a database at hand. Locks are lock files
+// created next to the values.
+type FileCache[T any] struct {
+	dir string
+	ttl time.Duration
+}
+
+type fileEntry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// NewFileCache returns a cache in dir whose entries expire after ttl, a
+// zero ttl keeps them forever.
+func NewFileCache[T any](dir string, ttl time.Duration) (*FileCache[T], error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileCache[T]{
+		dir: dir,
+		ttl: ttl,
+	}, nil
+}
+
+func (c *FileCache[T]) Get(key string) (val T, has bool) {
+	data, err := os.ReadFile(c.path(key, ".json"))
+	if err != nil {
+		return
+	}
+
+	entry := fileEntry{}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return
+	}
+
+	if expired(entry.ExpiresAt) {
+		os.Remove(c.path(key, ".json"))
+		return
+	}
+
+	if err = json.Unmarshal(entry.Value, &val); err != nil {
+		return
+	}
+
+	return val, true
+}
+
+// Set writes to a temporary file first, so readers never see a partially
+// written value.
+func (c *FileCache[T]) Set(key string, value T) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	data, err = json.Marshal(fileEntry{Value: data, ExpiresAt: expiresAt(c.ttl)})
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		fmt.Printf("Storing idempotency key %s failed: %v\n", key, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key, ".json"))
+	}
+	if err != nil {
+		fmt.Printf("Storing idempotency key %s failed: %v\n", key, err)
+	}
+}
+
+func (c *FileCache[T]) Lock(key string, timeout time.Duration) bool {
+	path := c.path(key, ".lock")
+
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return true
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			fmt.Printf("Locking idempotency key %s failed: %v\n", key, err)
+			return false
+		}
+
+		// Take over a lock its holder never released
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < timeout {
+			return false
+		}
+
+		os.Remove(path)
+	}
+
+	return false
+}
+
+func (c *FileCache[T]) Unlock(key string) {
+	os.Remove(c.path(key, ".lock"))
+}
+
+// path hashes the key, keys are client supplied and not safe as file names.
+func (c *FileCache[T]) path(key, ext string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+ext)
+}
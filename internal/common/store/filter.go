@@ -0,0 +1,238 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op is how a filter compares a column with its values.
+type Op string
+
+const (
+	// Eq matches one value.
+	Eq Op = "eq"
+	// In matches any of its values.
+	In Op = "in"
+	// Like matches values containing its value, ignoring case.
+	Like Op = "like"
+	// Range matches values between its two bounds, inclusive. An empty bound
+	// leaves that side open.
+	Range Op = "range"
+)
+
+// maxInValues bounds the values of an In filter.
+const maxInValues = 100
+
+// ColumnType decides the operators a column takes and checks its values.
+type ColumnType int
+
+const (
+	// Key columns are identifiers and states, compared whole.
+	Key ColumnType = iota
+	// Text columns are compared whole or searched.
+	Text
+	Number
+	Date
+	// Bool columns are conditions, compared with true or false.
+	Bool
+)
+
+func (t ColumnType) allows(op Op) bool {
+	switch op {
+	case Eq:
+		return true
+	case In:
+		return t != Date && t != Bool
+	case Like:
+		return t == Text
+	case Range:
+		return t == Number || t == Date
+	}
+
+	return false
+}
+
+func (t ColumnType) check(value string) error {
+	switch t {
+	case Number:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+	case Date:
+		if _, err := time.Parse(DateLayout, value); err != nil {
+			return fmt.Errorf("%q is not a date like %s", value, DateLayout)
+		}
+	case Bool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+	}
+
+	return nil
+}
+
+// Column is a column filters may use. Name is its SQL expression, like
+// o.status or (amount > 0).
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Columns whitelists the columns of an entity that filters may use, by the
+// field name the API knows them by. Only these ever end up in a query.
+type Columns map[string]Column
+
+// Filter restricts a field to values, compared with Op.
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []string
+}
+
+// FilterError is a filter the columns don't take, the API answers it with
+// 400.
+type FilterError struct {
+	Field   string
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Where returns the condition of the filters combined with AND, and its
+// arguments. Its placeholders are numbered after the n arguments the query
+// already has. Without filters the condition is TRUE.
+func (c Columns) Where(filters []Filter, n int) (string, []any, error) {
+	if len(filters) == 0 {
+		return "TRUE", nil, nil
+	}
+
+	var (
+		conditions []string
+		args       []any
+	)
+
+	placeholder := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(n+len(args))
+	}
+
+	for _, f := range filters {
+		column, ok := c[f.Field]
+		if !ok {
+			return "", nil, &FilterError{Field: f.Field, Message: "can't filter by this field"}
+		}
+
+		if !column.Type.allows(f.Op) {
+			return "", nil, &FilterError{Field: f.Field, Message: fmt.Sprintf("can't filter this field with %s", f.Op)}
+		}
+
+		if err := f.check(column.Type); err != nil {
+			return "", nil, &FilterError{Field: f.Field, Message: err.Error()}
+		}
+
+		switch f.Op {
+		case Eq:
+			conditions = append(conditions, column.Name+" = "+placeholder(f.Values[0]))
+		case In:
+			placeholders := make([]string, len(f.Values))
+			for i, value := range f.Values {
+				placeholders[i] = placeholder(value)
+			}
+
+			conditions = append(conditions, column.Name+" IN ("+strings.Join(placeholders, ", ")+")")
+		case Like:
+			conditions = append(conditions, column.Name+" ILIKE "+placeholder("%"+escapeLike(f.Values[0])+"%")+` ESCAPE '\'`)
+		case Range:
+			if f.Values[0] != "" {
+				conditions = append(conditions, column.Name+" >= "+placeholder(f.Values[0]))
+			}
+
+			if f.Values[1] != "" {
+				conditions = append(conditions, column.Name+" <= "+placeholder(f.Values[1]))
+			}
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func (f Filter) check(t ColumnType) error {
+	switch f.Op {
+	case Eq, Like:
+		if len(f.Values) != 1 {
+			return fmt.Errorf("%s takes one value", f.Op)
+		}
+	case In:
+		if len(f.Values) == 0 || len(f.Values) > maxInValues {
+			return fmt.Errorf("%s takes 1 to %d values", f.Op, maxInValues)
+		}
+	case Range:
+		if len(f.Values) != 2 || f.Values[0] == "" && f.Values[1] == "" {
+			return fmt.Errorf("%s takes a lower and an upper bound, one may be empty", f.Op)
+		}
+	}
+
+	for _, value := range f.Values {
+		if value == "" && f.Op == Range {
+			continue
+		}
+
+		if err := t.check(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// FiltersFromQuery reads filters from query parameters: field=value is Eq,
+// field[in]=a,b is In, field[like]=value is Like and field[range]=low,high is
+// Range. The parameters named in skip aren't filters.
+func FiltersFromQuery(query url.Values, skip ...string) ([]Filter, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var filters []Filter
+
+	for _, key := range keys {
+		field, op := key, Eq
+
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			field, op = key[:i], Op(key[i+1:len(key)-1])
+		}
+
+		if slices.Contains(skip, field) {
+			continue
+		}
+
+		for _, value := range query[key] {
+			f := Filter{Field: field, Op: op, Values: []string{value}}
+
+			switch op {
+			case Eq, Like:
+			case In, Range:
+				f.Values = strings.Split(value, ",")
+			default:
+				return nil, &FilterError{Field: field, Message: fmt.Sprintf("unknown operator %q", op)}
+			}
+
+			filters = append(filters, f)
+		}
+	}
+
+	return filters, nil
+}
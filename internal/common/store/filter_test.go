@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testColumns = Columns{
+	"name":     {Name: "name", Type: Text},
+	"status":   {Name: "o.status"},
+	"price":    {Name: "price", Type: Number},
+	"added_at": {Name: "added_at", Type: Date},
+	"in_stock": {Name: "(amount > 0)", Type: Bool},
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []Filter
+		n       int
+		where   string
+		args    []any
+	}{
+		{"none", nil, 0, "TRUE", nil},
+		{"eq", []Filter{{"status", Eq, []string{"paid"}}}, 0, "o.status = $1", []any{"paid"}},
+		{"in", []Filter{{"status", In, []string{"paid", "new"}}}, 0, "o.status IN ($1, $2)", []any{"paid", "new"}},
+		{"like", []Filter{{"name", Like, []string{"shirt"}}}, 0, `name ILIKE $1 ESCAPE '\'`, []any{"%shirt%"}},
+		{"like escapes", []Filter{{"name", Like, []string{`50%_off\`}}}, 0, `name ILIKE $1 ESCAPE '\'`, []any{`%50\%\_off\\%`}},
+		{"range", []Filter{{"price", Range, []string{"10", "20.5"}}}, 0, "price >= $1 AND price <= $2", []any{"10", "20.5"}},
+		{"open range", []Filter{{"added_at", Range, []string{"", "2024-01-31"}}}, 0, "added_at <= $1", []any{"2024-01-31"}},
+		{"bool", []Filter{{"in_stock", Eq, []string{"true"}}}, 0, "(amount > 0) = $1", []any{"true"}},
+		{
+			"combined",
+			[]Filter{
+				{"status", In, []string{"paid", "new"}},
+				{"price", Range, []string{"10", ""}},
+				{"name", Like, []string{"shirt"}},
+			},
+			2,
+			`o.status IN ($3, $4) AND price >= $5 AND name ILIKE $6 ESCAPE '\'`,
+			[]any{"paid", "new", "10", "%shirt%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := testColumns.Where(tt.filters, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if where != tt.where {
+				t.Errorf("got condition %q, want %q", where, tt.where)
+			}
+
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got arguments %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestWhereRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{"column not whitelisted", Filter{"password", Eq, []string{"x"}}},
+		{"sql as the field", Filter{"1=1; --", Eq, []string{"x"}}},
+		{"like on a key", Filter{"status", Like, []string{"pa"}}},
+		{"range on text", Filter{"name", Range, []string{"a", "b"}}},
+		{"in on a date", Filter{"added_at", In, []string{"2024-01-01"}}},
+		{"not a number", Filter{"price", Eq, []string{"ten"}}},
+		{"not a date", Filter{"added_at", Range, []string{"yesterday", ""}}},
+		{"not a bool", Filter{"in_stock", Eq, []string{"maybe"}}},
+		{"eq of two values", Filter{"status", Eq, []string{"paid", "new"}}},
+		{"range without bounds", Filter{"price", Range, []string{"", ""}}},
+		{"range of one bound", Filter{"price", Range, []string{"10"}}},
+		{"empty in", Filter{"status", In, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := testColumns.Where([]Filter{{"status", Eq, []string{"paid"}}, tt.filter}, 0)
+
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("got error %v, want a FilterError", err)
+			}
+
+			if filterErr.Field != tt.filter.Field {
+				t.Errorf("got error of field %q, want %q", filterErr.Field, tt.filter.Field)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// PageParams are the query parameters of a page request, the rest are
+// filters.
+var PageParams = []string{"limit", "sort", "order", "cursor"}
+
+// PageRequest asks for Limit items sorted by the Sort field, or the next or
+// previous page of an earlier request with the Cursor it returned. A cursor
+// carries the sort of its request.
+type PageRequest struct {
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor string
+}
+
+// PageRequestFromQuery reads a page request from the limit, sort, order
+// (asc or desc) and cursor query parameters.
+func PageRequestFromQuery(query url.Values) (PageRequest, error) {
+	req := PageRequest{
+		Limit:  DefaultPageLimit,
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return PageRequest{}, &FilterError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxPageLimit)}
+		}
+
+		req.Limit = limit
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		req.Desc = true
+	default:
+		return PageRequest{}, &FilterError{Field: "order", Message: "must be asc or desc"}
+	}
+
+	return req, nil
+}
+
+// Page is a page of a list. Next and Prev are the cursors of the pages
+// after and before it, empty at the ends of the list. Total counts the
+// items of all pages.
+type Page[T any] struct {
+	Items []T
+	Next  string
+	Prev  string
+	Total int
+}
+
+// SortKey is a field lists can be sorted by: its column, which can't be
+// null, and how to read its value from an item for cursors. The values of
+// cursors are checked against Type before they reach a query.
+type SortKey[T any] struct {
+	Column string
+	Type   ColumnType
+	Value  func(T) string
+}
+
+// Keyset pages a list by the sort value and id of the items at the edges of
+// a page instead of offsets, so pages don't shift as rows come and go and
+// late pages cost as much as the first.
+type Keyset[T any] struct {
+	// ID is the id column, which orders items with the same sort value.
+	ID   string
+	IDOf func(T) string
+
+	Sorts map[string]SortKey[T]
+	// Default is the sort field of requests without one.
+	Default string
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+	// Back pages towards the start of the list
+	Back bool `json:"b,omitempty"`
+}
+
+// Clause returns the condition restricting a query to the requested page
+// and its arguments, numbered after the n arguments the query already has,
+// and its ORDER BY and LIMIT clauses. The query fetches one item more than
+// the limit, which tells Page whether there are more.
+func (k Keyset[T]) Clause(req PageRequest, n int) (cond, orderBy, limit string, args []any, err error) {
+	req, c, key, err := k.resolve(req)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+
+	dir, op := "ASC", ">"
+	if req.Desc != (c != nil && c.Back) {
+		dir, op = "DESC", "<"
+	}
+
+	cond = "TRUE"
+	if c != nil {
+		cond = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", key.Column, k.ID, op, n+1, n+2)
+		args = []any{c.Value, c.ID}
+	}
+
+	orderBy = fmt.Sprintf("ORDER BY %s %s, %s %s", key.Column, dir, k.ID, dir)
+	limit = fmt.Sprintf("LIMIT %d", req.Limit+1)
+
+	return cond, orderBy, limit, args, nil
+}
+
+// Page builds the page from the items a query with Clause returned.
+func (k Keyset[T]) Page(req PageRequest, items []T, total int) (Page[T], error) {
+	req, c, key, err := k.resolve(req)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	back := c != nil && c.Back
+
+	more := len(items) > req.Limit
+	if more {
+		items = items[:req.Limit]
+	}
+
+	// Paging back fetched the items closest to the cursor first
+	if back {
+		slices.Reverse(items)
+	}
+
+	page := Page[T]{Items: items, Total: total}
+
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	edge := func(item T, back bool) string {
+		return encodeCursor(cursor{
+			Sort:  req.Sort,
+			Desc:  req.Desc,
+			Value: key.Value(item),
+			ID:    k.IDOf(item),
+			Back:  back,
+		})
+	}
+
+	// Coming from a cursor there are items on its side of the page
+	if more && !back || back {
+		page.Next = edge(items[len(items)-1], false)
+	}
+
+	if more && back || c != nil && !back {
+		page.Prev = edge(items[0], true)
+	}
+
+	return page, nil
+}
+
+// resolve fills the request in from its cursor and defaults.
+func (k Keyset[T]) resolve(req PageRequest) (PageRequest, *cursor, SortKey[T], error) {
+	var c *cursor
+
+	if req.Cursor != "" {
+		var err error
+		if c, err = decodeCursor(req.Cursor); err != nil {
+			return req, nil, SortKey[T]{}, &FilterError{Field: "cursor", Message: "invalid cursor"}
+		}
+
+		req.Sort, req.Desc = c.Sort, c.Desc
+	}
+
+	if req.Sort == "" {
+		req.Sort = k.Default
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = DefaultPageLimit
+	}
+
+	key, ok := k.Sorts[req.Sort]
+	if !ok {
+		return req, nil, SortKey[T]{}, &FilterError{Field: "sort", Message: "can't sort by this field"}
+	}
+
+	if c != nil && (c.ID == "" || key.Type.check(c.Value) != nil) {
+		return req, nil, SortKey[T]{}, &FilterError{Field: "cursor", Message: "invalid cursor"}
+	}
+
+	return req, c, key, nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type testItem struct {
+	ID    string
+	Price int
+}
+
+var testKeyset = Keyset[testItem]{
+	ID:   "id",
+	IDOf: func(item testItem) string { return item.ID },
+	Sorts: map[string]SortKey[testItem]{
+		"price": {Column: "price", Type: Number, Value: func(item testItem) string { return strconv.Itoa(item.Price) }},
+		"id":    {Column: "id", Value: func(item testItem) string { return item.ID }},
+	},
+	Default: "price",
+}
+
+// testItems are priced so that item1 and item2 tie on price.
+var testItems = []testItem{{"item1", 10}, {"item2", 10}, {"item3", 20}, {"item4", 30}, {"item5", 40}}
+
+// query does what the database does with a Clause: keeps the items after
+// the cursor in its order, up to the limit.
+func query(t *testing.T, req PageRequest) []testItem {
+	t.Helper()
+
+	_, _, _, args, err := testKeyset.Clause(req, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, c, _, err := testKeyset.resolve(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := req.Desc != (c != nil && c.Back)
+
+	items := slices.Clone(testItems)
+	slices.SortStableFunc(items, func(a, b testItem) int {
+		if desc {
+			a, b = b, a
+		}
+
+		if a.Price != b.Price {
+			return a.Price - b.Price
+		}
+
+		if a.ID < b.ID {
+			return -1
+		}
+
+		return 1
+	})
+
+	var found []testItem
+
+	for _, item := range items {
+		if args != nil {
+			price, _ := strconv.Atoi(args[0].(string))
+			after := item.Price > price || item.Price == price && item.ID > args[1].(string)
+
+			if desc {
+				after = item.Price < price || item.Price == price && item.ID < args[1].(string)
+			}
+
+			if !after {
+				continue
+			}
+		}
+
+		if len(found) < req.Limit+1 {
+			found = append(found, item)
+		}
+	}
+
+	return found
+}
+
+func page(t *testing.T, req PageRequest) Page[testItem] {
+	t.Helper()
+
+	p, err := testKeyset.Page(req, query(t, req), len(testItems))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func ids(items []testItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	return ids
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		desc  bool
+		pages [][]string
+	}{
+		{false, [][]string{{"item1", "item2"}, {"item3", "item4"}, {"item5"}}},
+		{true, [][]string{{"item5", "item4"}, {"item3", "item2"}, {"item1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run("desc "+strconv.FormatBool(tt.desc), func(t *testing.T) {
+			p := page(t, PageRequest{Limit: 2, Desc: tt.desc})
+			if p.Prev != "" {
+				t.Errorf("got a previous cursor on the first page")
+			}
+
+			var cursors []string
+
+			for i, want := range tt.pages {
+				if got := ids(p.Items); !reflect.DeepEqual(got, want) {
+					t.Fatalf("page %d: got %v, want %v", i, got, want)
+				}
+
+				if i == len(tt.pages)-1 {
+					break
+				}
+
+				if p.Next == "" {
+					t.Fatalf("page %d: got no next cursor", i)
+				}
+
+				cursors = append(cursors, p.Next)
+				p = page(t, PageRequest{Limit: 2, Cursor: p.Next})
+			}
+
+			if p.Next != "" {
+				t.Errorf("got a next cursor on the last page")
+			}
+
+			// Paging back from the last page visits the same pages
+			for i := len(tt.pages) - 2; i >= 0; i-- {
+				if p.Prev == "" {
+					t.Fatalf("page %d: got no previous cursor", i+1)
+				}
+
+				p = page(t, PageRequest{Limit: 2, Cursor: p.Prev})
+
+				if got := ids(p.Items); !reflect.DeepEqual(got, tt.pages[i]) {
+					t.Fatalf("back to page %d: got %v, want %v", i, got, tt.pages[i])
+				}
+			}
+
+			if p.Prev != "" {
+				t.Errorf("got a previous cursor back on the first page")
+			}
+
+			// Cursors carry the order of their request
+			c, err := decodeCursor(cursors[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Desc != tt.desc || c.Sort != "price" || c.Back {
+				t.Errorf("got cursor %+v", c)
+			}
+		})
+	}
+}
+
+func TestKeysetInvalidCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("price"))},
+		{"unknown sort", encodeCursor(cursor{Sort: "password", Value: "x", ID: "item1"})},
+		{"value not of the column type", encodeCursor(cursor{Sort: "price", Value: "'; DROP TABLE items; --", ID: "item1"})},
+		{"without id", encodeCursor(cursor{Sort: "price", Value: "10"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, err := testKeyset.Clause(PageRequest{Cursor: tt.cursor}, 0)
+
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("got error %v, want a FilterError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresCache keeps values in the idempotency_keys table, so they survive
+// restarts and are shared between replicas. Scope separates the caches
+// sharing the table.
+type PostgresCache[T any] struct {
+	db    *sqlx.DB
+	scope string
+	ttl   time.Duration
+}
+
+// NewPostgresCache returns a cache whose entries expire after ttl, a zero
+// ttl keeps them until Purge is called.
+func NewPostgresCache[T any](db *sqlx.DB, scope string, ttl time.Duration) *PostgresCache[T] {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &PostgresCache[T]{
+		db:    db,
+		scope: scope,
+		ttl:   ttl,
+	}
+}
+
+func (c *PostgresCache[T]) Get(key string) (val T, has bool) {
+	q := `
+		SELECT value FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND value IS NOT NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	var data []byte
+
+	err := c.db.QueryRowContext(context.Background(), q, c.scope, key).Scan(&data)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("Reading idempotency key %s failed: %v\n", key, err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &val); err != nil {
+		return
+	}
+
+	return val, true
+}
+
+func (c *PostgresCache[T]) Set(key string, value T) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	q := `
+		INSERT INTO idempotency_keys (scope, key, value, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope, key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at, locked_until = NULL
+	`
+
+	_, err = c.db.ExecContext(context.Background(), q, c.scope, key, data, nullTime(expiresAt(c.ttl)))
+	if err != nil {
+		fmt.Printf("Storing idempotency key %s failed: %v\n", key, err)
+	}
+}
+
+// Take deletes the entry and returns its value, of concurrent takes only
+// one gets it.
+func (c *PostgresCache[T]) Take(key string) (val T, has bool) {
+	q := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND value IS NOT NULL AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING value
+	`
+
+	var data []byte
+
+	err := c.db.QueryRowContext(context.Background(), q, c.scope, key).Scan(&data)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("Taking idempotency key %s failed: %v\n", key, err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &val); err != nil {
+		return
+	}
+
+	return val, true
+}
+
+// Lock inserts the key without a value. A row left by an expired entry or
+// an abandoned lock is taken over.
+func (c *PostgresCache[T]) Lock(key string, timeout time.Duration) bool {
+	q := `
+		INSERT INTO idempotency_keys (scope, key, locked_until, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET value = NULL, locked_until = EXCLUDED.locked_until, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+			OR (idempotency_keys.value IS NULL AND idempotency_keys.locked_until <= NOW())
+	`
+
+	until := time.Now().Add(timeout)
+
+	res, err := c.db.ExecContext(context.Background(), q, c.scope, key, until, nullTime(expiresAt(c.ttl)))
+	if err != nil {
+		fmt.Printf("Locking idempotency key %s failed: %v\n", key, err)
+		return false
+	}
+
+	locked, err := res.RowsAffected()
+
+	return err == nil && locked == 1
+}
+
+func (c *PostgresCache[T]) Unlock(key string) {
+	q := "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND value IS NULL"
+
+	if _, err := c.db.ExecContext(context.Background(), q, c.scope, key); err != nil {
+		fmt.Printf("Unlocking idempotency key %s failed: %v\n", key, err)
+	}
+}
+
+// Purge deletes the expired entries of every scope.
+func (c *PostgresCache[T]) Purge(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= NOW()")
+
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
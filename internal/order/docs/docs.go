@@ -0,0 +1,8 @@
+// Package docs holds the OpenAPI document of the service, generated from
+// the swag annotations of its handlers with make docs.
+package docs
+
+import _ "embed"
+
+//go:embed openapi.json
+var OpenAPI []byte
@@ -1,16 +1,29 @@
 package order
 
-import "github.com/erazr/ecommerce-microservices/internal/common/store"
+import (
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
 
 type Order struct {
 	ID          string         `db:"id" json:"id"`
 	UserID      string         `db:"user_id" json:"user_id"`
-	ProductID   []string       `db:"-" json:"product_id"`
-	TotalPrice  float64        `db:"total_price" json:"total_price"`
+	Items       []LineItem     `db:"-" json:"items"`
+	TotalPrice  money.Money    `db:"total_price" json:"total_price"`
 	OrderedDate store.OnlyDate `db:"ordered_date" json:"ordered_date"`
 	Status      string         `db:"status" json:"status"`
 } // @name Order
 
+// LineItem is a variant of a product on an order with the price it had when
+// the order was placed. Later price changes don't touch it.
+type LineItem struct {
+	ProductID string      `db:"product_id" json:"product_id"`
+	VariantID string      `db:"variant_id" json:"variant_id"`
+	Quantity  int         `db:"quantity" json:"quantity"`
+	UnitPrice money.Money `db:"unit_price" json:"unit_price"`
+	LineTotal money.Money `db:"line_total" json:"line_total"`
+} // @name OrderLineItem
+
 var (
 	ErrExists   = &OrderError{"order already exists"}
 	ErrNotFound = &OrderError{"order not found"}
@@ -29,25 +42,65 @@ func (e *OrderError) Is(err error) bool {
 	return e == err
 }
 
-func (o *Order) AddProduct(productID string) {
-	o.ProductID = append(o.ProductID, productID)
+// AddItem adds quantity units of a variant of the product at unitPrice.
+// Adding a variant that is already on the order increases its quantity. All
+// items of an order must be priced in the same currency.
+func (o *Order) AddItem(productID, variantID string, quantity int, unitPrice money.Money) error {
+	if len(o.Items) > 0 && !o.Items[0].UnitPrice.SameCurrency(unitPrice) {
+		return money.ErrCurrencyMismatch
+	}
+
+	for i := range o.Items {
+		if o.Items[i].VariantID == variantID {
+			o.Items[i].Quantity += quantity
+			o.Items[i].LineTotal = o.Items[i].UnitPrice.Mul(int64(o.Items[i].Quantity))
+			return o.calculateTotal()
+		}
+	}
+
+	o.Items = append(o.Items, LineItem{
+		ProductID: productID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		UnitPrice: unitPrice,
+		LineTotal: unitPrice.Mul(int64(quantity)),
+	})
+
+	return o.calculateTotal()
 }
 
-func (o *Order) RemoveProduct(productID string) {
-	for i, id := range o.ProductID {
-		if id == productID {
-			o.ProductID = append(o.ProductID[:i], o.ProductID[i+1:]...)
+func (o *Order) RemoveItem(variantID string) {
+	for i, item := range o.Items {
+		if item.VariantID == variantID {
+			o.Items = append(o.Items[:i], o.Items[i+1:]...)
+			o.calculateTotal()
 			return
 		}
 	}
 }
 
+// TotalAmount returns the ordered quantity of each variant.
 func (o *Order) TotalAmount() map[string]int {
 	totals := map[string]int{}
 
-	for _, id := range o.ProductID {
-		totals[id]++
+	for _, item := range o.Items {
+		totals[item.VariantID] += item.Quantity
 	}
 
 	return totals
 }
+
+func (o *Order) calculateTotal() error {
+	total := money.Money{}
+
+	for _, item := range o.Items {
+		var err error
+		if total, err = total.Add(item.LineTotal); err != nil {
+			return err
+		}
+	}
+
+	o.TotalPrice = total
+
+	return nil
+}
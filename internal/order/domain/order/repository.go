@@ -1,12 +1,21 @@
 package order
 
-import "context"
+import (
+	"context"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
 
 type Repository interface {
-	Search(ctx context.Context, filter, value string) ([]Order, error)
-	List(ctx context.Context) ([]Order, error)
+	Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[Order], error)
+	List(ctx context.Context, req store.PageRequest) (store.Page[Order], error)
+	ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[Order], error)
 	Get(ctx context.Context, id string) (Order, error)
 	Create(ctx context.Context, order Order) (string, error)
-	Update(ctx context.Context, id string, order Order) error
+	// Update changes everything but the status. Changes of the status given
+	// with it are applied in the same transaction, like UpdateStatus does.
+	Update(ctx context.Context, id string, order Order, changes ...StatusChange) error
+	UpdateStatus(ctx context.Context, change StatusChange) error
+	History(ctx context.Context, id string) ([]StatusChange, error)
 	Delete(ctx context.Context, id string) error
 }
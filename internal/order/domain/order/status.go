@@ -0,0 +1,112 @@
+package order
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatusNew               = "new"
+	StatusAwaitingPayment   = "awaiting_payment"
+	StatusPaid              = "paid"
+	StatusShipped           = "shipped"
+	StatusDelivered         = "delivered"
+	StatusCancelled         = "cancelled"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
+// transitions lists the statuses an order may move to from each status.
+var transitions = map[string][]string{
+	StatusNew:               {StatusAwaitingPayment, StatusCancelled},
+	StatusAwaitingPayment:   {StatusPaid, StatusCancelled},
+	StatusPaid:              {StatusShipped, StatusPartiallyRefunded, StatusRefunded},
+	StatusShipped:           {StatusDelivered, StatusPartiallyRefunded, StatusRefunded},
+	StatusDelivered:         {StatusPartiallyRefunded, StatusRefunded},
+	StatusCancelled:         {},
+	StatusPartiallyRefunded: {StatusRefunded},
+	StatusRefunded:          {},
+}
+
+var (
+	ErrInvalidStatus     = &OrderError{"invalid order status"}
+	ErrInvalidTransition = &OrderError{"invalid order status transition"}
+	ErrStatusConflict    = &OrderError{"order status was changed concurrently"}
+)
+
+// StatusChange records a single transition of an order, who made it and why.
+type StatusChange struct {
+	OrderID   string    `db:"order_id" json:"order_id"`
+	From      string    `db:"from_status" json:"from"`
+	To        string    `db:"to_status" json:"to"`
+	Actor     string    `db:"actor" json:"actor"`
+	Reason    string    `db:"reason" json:"reason"`
+	ChangedAt time.Time `db:"changed_at" json:"changed_at"`
+} // @name OrderStatusChange
+
+func ValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionTo moves the order to status and returns the change to persist.
+func (o *Order) TransitionTo(status, actor, reason string) (StatusChange, error) {
+	if !ValidStatus(status) {
+		return StatusChange{}, ErrInvalidStatus
+	}
+
+	if !CanTransition(o.Status, status) {
+		return StatusChange{}, fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, o.Status, status)
+	}
+
+	change := StatusChange{
+		OrderID:   o.ID,
+		From:      o.Status,
+		To:        status,
+		Actor:     actor,
+		Reason:    reason,
+		ChangedAt: time.Now().UTC(),
+	}
+
+	o.Status = status
+
+	return change, nil
+}
+
+func (o *Order) AwaitPayment(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusAwaitingPayment, actor, reason)
+}
+
+func (o *Order) MarkPaid(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusPaid, actor, reason)
+}
+
+func (o *Order) Ship(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusShipped, actor, reason)
+}
+
+func (o *Order) Deliver(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusDelivered, actor, reason)
+}
+
+func (o *Order) Cancel(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusCancelled, actor, reason)
+}
+
+func (o *Order) PartiallyRefund(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusPartiallyRefunded, actor, reason)
+}
+
+func (o *Order) Refund(actor, reason string) (StatusChange, error) {
+	return o.TransitionTo(StatusRefunded, actor, reason)
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gatewaydocs "github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	moneypb "github.com/erazr/ecommerce-microservices/internal/common/pb/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/common/router"
+	"github.com/erazr/ecommerce-microservices/internal/common/server"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/order/docs"
+	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
+	"google.golang.org/grpc"
+)
+
+// orderRepository keeps orders in memory. Methods the tests don't reach
+// panic on the nil embedded interface.
+type orderRepository struct {
+	order.Repository
+
+	orders  map[string]order.Order
+	history map[string][]order.StatusChange
+}
+
+func newOrderRepository(orders ...order.Order) *orderRepository {
+	r := &orderRepository{
+		orders:  make(map[string]order.Order),
+		history: make(map[string][]order.StatusChange),
+	}
+
+	for _, o := range orders {
+		r.orders[o.ID] = o
+	}
+
+	return r
+}
+
+func (r *orderRepository) page(keep func(order.Order) bool) store.Page[order.Order] {
+	page := store.Page[order.Order]{Items: []order.Order{}}
+
+	for _, o := range r.orders {
+		if keep(o) {
+			page.Items = append(page.Items, o)
+		}
+	}
+
+	page.Total = len(page.Items)
+
+	return page
+}
+
+func (r *orderRepository) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[order.Order], error) {
+	return r.page(func(o order.Order) bool {
+		for _, f := range filters {
+			if f.Field == "user_id" && o.UserID != f.Values[0] {
+				return false
+			}
+		}
+
+		return true
+	}), nil
+}
+
+func (r *orderRepository) List(ctx context.Context, req store.PageRequest) (store.Page[order.Order], error) {
+	return r.page(func(order.Order) bool { return true }), nil
+}
+
+func (r *orderRepository) ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[order.Order], error) {
+	return r.page(func(o order.Order) bool { return o.UserID == userID }), nil
+}
+
+func (r *orderRepository) Get(ctx context.Context, id string) (order.Order, error) {
+	o, ok := r.orders[id]
+	if !ok {
+		return order.Order{}, order.ErrNotFound
+	}
+
+	return o, nil
+}
+
+func (r *orderRepository) Create(ctx context.Context, o order.Order) (string, error) {
+	r.orders[o.ID] = o
+
+	return o.ID, nil
+}
+
+func (r *orderRepository) Update(ctx context.Context, id string, o order.Order, changes ...order.StatusChange) error {
+	if _, ok := r.orders[id]; !ok {
+		return order.ErrNotFound
+	}
+
+	for _, c := range changes {
+		o.Status = c.To
+		r.history[id] = append(r.history[id], c)
+	}
+
+	r.orders[id] = o
+
+	return nil
+}
+
+func (r *orderRepository) UpdateStatus(ctx context.Context, change order.StatusChange) error {
+	o, ok := r.orders[change.OrderID]
+	if !ok {
+		return order.ErrNotFound
+	}
+
+	if o.Status != change.From {
+		return order.ErrStatusConflict
+	}
+
+	return r.Update(ctx, change.OrderID, o, change)
+}
+
+func (r *orderRepository) History(ctx context.Context, id string) ([]order.StatusChange, error) {
+	if _, ok := r.orders[id]; !ok {
+		return nil, order.ErrNotFound
+	}
+
+	return append([]order.StatusChange{}, r.history[id]...), nil
+}
+
+func (r *orderRepository) Delete(ctx context.Context, id string) error {
+	delete(r.orders, id)
+
+	return nil
+}
+
+// productsClient prices every variant at 10.00 KZT and has all of them in
+// stock.
+type productsClient struct {
+	product.ProductsClient
+
+	released []string
+}
+
+func (c *productsClient) GetProductPrices(ctx context.Context, in *product.GetProductPricesRequest, opts ...grpc.CallOption) (*product.GetProductPricesResponse, error) {
+	res := &product.GetProductPricesResponse{
+		Prices:     make(map[string]*moneypb.Money),
+		ProductIds: make(map[string]string),
+	}
+
+	for _, id := range in.GetVariantIds() {
+		res.Prices[id] = money.New(1000, "KZT").Proto()
+		res.ProductIds[id] = id
+	}
+
+	return res, nil
+}
+
+func (c *productsClient) ReserveStock(ctx context.Context, in *product.ReserveStockRequest, opts ...grpc.CallOption) (*product.ReserveStockResponse, error) {
+	return &product.ReserveStockResponse{Success: true}, nil
+}
+
+func (c *productsClient) ReleaseReservation(ctx context.Context, in *product.ReservationRequest, opts ...grpc.CallOption) (*product.ReservationResponse, error) {
+	c.released = append(c.released, in.GetOrderId())
+
+	return &product.ReservationResponse{Success: true}, nil
+}
+
+// contractDocument merges the order document into the gateway's, as the
+// gateway does for the paths it routes to the order service.
+func contractDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+
+	doc, err := openapi.Parse(gatewaydocs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := openapi.Parse(docs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Merge("order", service, isOrderPath); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func isOrderPath(path string) bool {
+	return strings.HasPrefix(path, "/orders")
+}
+
+func newRequest(method, target, userID, role, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if userID != "" {
+		req.Header.Set(auth.UserIDHeader, userID)
+		req.Header.Set(auth.UserRoleHeader, role)
+	}
+
+	return req
+}
+
+func TestContract(t *testing.T) {
+	placed := order.Order{
+		ID:          "order1",
+		UserID:      "user1",
+		OrderedDate: store.OnlyDate("2024-01-02"),
+		Status:      order.StatusNew,
+	}
+	if err := placed.AddItem("product1", "product1", 2, money.New(1000, "KZT")); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newOrderRepository(placed, order.Order{ID: "order2", UserID: "user2", Status: order.StatusNew})
+	products := &productsClient{}
+
+	h := NewOrderHandler(repo,
+		WithProductGRPCService(products),
+	)
+
+	r := router.New()
+	r.Use(authz.Identify)
+	r.Use(server.Idempotency(store.NewInMemoryIdempotencyCache[server.StoredResponse](time.Hour)))
+	r.Mount("/orders", h.Routes())
+
+	contract := openapi.NewContract(contractDocument(t), r)
+
+	const (
+		client = authz.RoleClient
+		admin  = authz.RoleAdmin
+	)
+
+	tests := []struct {
+		method string
+		target string
+		userID string
+		role   string
+		body   string
+	}{
+		{http.MethodPost, "/orders", "user1", client, `{"items":[{"product_id":"product1","quantity":1}],"ordered_date":"2024-01-03"}`},
+		{http.MethodGet, "/orders", "user1", client, ""},
+		{http.MethodGet, "/orders/search?status=new", "user1", client, ""},
+		{http.MethodGet, "/orders/order1", "user1", client, ""},
+		{http.MethodPut, "/orders/order1", "user1", client, `{"ordered_date":"2024-01-02","status":"cancelled"}`},
+		{http.MethodGet, "/orders/order1/history", "user1", client, ""},
+		{http.MethodDelete, "/orders/order2", "admin1", admin, ""},
+	}
+
+	for _, tt := range tests {
+		rec, err := contract.Do(newRequest(tt.method, tt.target, tt.userID, tt.role, tt.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if rec.Code >= http.StatusBadRequest {
+			t.Errorf("%s %s: got status %d: %s", tt.method, tt.target, rec.Code, rec.Body)
+		}
+	}
+
+	if unserved := contract.Unserved(isOrderPath); len(unserved) > 0 {
+		t.Errorf("operations without a test: %v", unserved)
+	}
+
+	if len(products.released) != 1 || products.released[0] != "order1" {
+		t.Errorf("got released reservations %v, want the cancelled order1", products.released)
+	}
+}
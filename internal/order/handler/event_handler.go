@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
+)
+
+type OrderEventHandler struct {
+	repo order.Repository
+
+	products product.ProductsClient
+}
+
+func NewOrderEventHandler(repo order.Repository, products product.ProductsClient) *OrderEventHandler {
+	return &OrderEventHandler{repo: repo, products: products}
+}
+
+func (h *OrderEventHandler) Subscribe(s events.Subscriber) {
+	s.Subscribe(events.PaymentSucceeded, h.paymentSucceeded)
+	s.Subscribe(events.PaymentFailed, h.paymentFailed)
+}
+
+// paymentSucceeded marks the order as paid if the checkout didn't get to it.
+func (h *OrderEventHandler) paymentSucceeded(ctx context.Context, e events.Event) error {
+	payload := events.PaymentSucceededPayload{}
+	if err := e.Decode(&payload); err != nil {
+		return err
+	}
+
+	o, err := h.repo.Get(ctx, payload.OrderID)
+	if errors.Is(err, order.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.Status != order.StatusAwaitingPayment {
+		return nil
+	}
+
+	change, err := o.MarkPaid("order", "payment "+payload.PaymentID+" succeeded")
+	if err != nil {
+		return err
+	}
+
+	err = h.repo.UpdateStatus(ctx, change)
+	if errors.Is(err, order.ErrStatusConflict) {
+		return nil
+	}
+
+	return err
+}
+
+// paymentFailed cancels an order still waiting for its payment, e.g. when the
+// provider reports a decline after the checkout returned, and releases the
+// stock held for it.
+func (h *OrderEventHandler) paymentFailed(ctx context.Context, e events.Event) error {
+	payload := events.PaymentFailedPayload{}
+	if err := e.Decode(&payload); err != nil {
+		return err
+	}
+
+	o, err := h.repo.Get(ctx, payload.OrderID)
+	if errors.Is(err, order.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.Status != order.StatusNew && o.Status != order.StatusAwaitingPayment {
+		return nil
+	}
+
+	change, err := o.Cancel("order", "payment "+payload.PaymentID+" failed")
+	if err != nil {
+		return err
+	}
+
+	err = h.repo.UpdateStatus(ctx, change)
+	if errors.Is(err, order.ErrStatusConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	releaseReservation(ctx, h.products, o.ID)
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
+)
+
+func TestPaymentFailedReleasesReservation(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		want     string
+		released bool
+	}{
+		{"awaiting payment", order.StatusAwaitingPayment, order.StatusCancelled, true},
+		{"new", order.StatusNew, order.StatusCancelled, true},
+		{"paid", order.StatusPaid, order.StatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newOrderRepository(order.Order{ID: "order1", UserID: "user1", Status: tt.status})
+			products := &productsClient{}
+
+			bus := events.NewInProcessBus()
+			NewOrderEventHandler(repo, products).Subscribe(bus)
+
+			e, err := events.New(events.PaymentFailed, "payment1", events.PaymentFailedPayload{PaymentID: "payment1", OrderID: "order1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := bus.Publish(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := repo.orders["order1"].Status; got != tt.want {
+				t.Errorf("got status %s, want %s", got, tt.want)
+			}
+
+			if released := len(products.released) == 1; released != tt.released {
+				t.Errorf("got released reservations %v, want released %v", products.released, tt.released)
+			}
+		})
+	}
+}
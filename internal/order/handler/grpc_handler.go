@@ -2,45 +2,100 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"errors"
 
 	orderpb "github.com/erazr/ecommerce-microservices/internal/common/pb/order"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type OrderGRPCHandler struct {
 	repo order.Repository
 
+	products product.ProductsClient
+
 	orderpb.UnimplementedOrdersServer
 }
 
-func NewOrderGRPCHandler(repo order.Repository) *OrderGRPCHandler {
-	return &OrderGRPCHandler{repo: repo}
+func NewOrderGRPCHandler(repo order.Repository, products product.ProductsClient) *OrderGRPCHandler {
+	return &OrderGRPCHandler{repo: repo, products: products}
+}
+
+// GRPCCallers lists the services allowed to call each RPC.
+var GRPCCallers = map[string][]string{
+	"/api.proto.Orders/UpdateOrderStatus":  {"payment"},
+	"/api.proto.Orders/GetOrderVariantIDs": {"payment"},
+	"/api.proto.Orders/GetOrderOwner":      {"payment"},
 }
 
+// UpdateOrderStatus moves the order through the state machine. Asking for the
+// status the order is already in succeeds without recording anything, so
+// callers can safely retry. Cancelling releases the stock held for the order.
 func (h *OrderGRPCHandler) UpdateOrderStatus(ctx context.Context, req *orderpb.UpdateOrderStatusRequest) (*orderpb.UpdateOrderStatusResponse, error) {
 	o, err := h.repo.Get(ctx, req.OrderId)
 	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+
 		return nil, err
 	}
 
-	o.Status = req.Status
-	fmt.Println("Updating order status", req.Status, o.Status)
+	if o.Status == req.Status {
+		return &orderpb.UpdateOrderStatusResponse{Success: true}, nil
+	}
+
+	change, err := o.TransitionTo(req.Status, req.Actor, req.Reason)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	if err := h.repo.UpdateStatus(ctx, change); err != nil {
+		if errors.Is(err, order.ErrStatusConflict) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
 
-	if err := h.repo.Update(ctx, req.OrderId, o); err != nil {
 		return nil, err
 	}
 
+	if change.To == order.StatusCancelled {
+		releaseReservation(ctx, h.products, o.ID)
+	}
+
 	return &orderpb.UpdateOrderStatusResponse{
 		Success: true,
 	}, nil
 }
 
-func (h *OrderGRPCHandler) GetOrderProductIDs(ctx context.Context, req *orderpb.GetOrderProductIDsRequest) (*orderpb.GetOrderProductIDsResponse, error) {
+func (h *OrderGRPCHandler) GetOrderVariantIDs(ctx context.Context, req *orderpb.GetOrderVariantIDsRequest) (*orderpb.GetOrderVariantIDsResponse, error) {
 	o, err := h.repo.Get(ctx, req.OrderId)
 	if err != nil {
 		return nil, err
 	}
 
-	return &orderpb.GetOrderProductIDsResponse{ProductIds: o.ProductID}, nil
+	// Each variant is listed once per ordered unit.
+	variantIDs := []string{}
+	for _, item := range o.Items {
+		for i := 0; i < item.Quantity; i++ {
+			variantIDs = append(variantIDs, item.VariantID)
+		}
+	}
+
+	return &orderpb.GetOrderVariantIDsResponse{VariantIds: variantIDs}, nil
+}
+
+// GetOrderOwner returns who placed the order and the total they owe for it.
+func (h *OrderGRPCHandler) GetOrderOwner(ctx context.Context, req *orderpb.GetOrderOwnerRequest) (*orderpb.GetOrderOwnerResponse, error) {
+	o, err := h.repo.Get(ctx, req.OrderId)
+	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+
+		return nil, err
+	}
+
+	return &orderpb.GetOrderOwnerResponse{UserId: o.UserID, TotalPrice: o.TotalPrice.Proto()}, nil
 }
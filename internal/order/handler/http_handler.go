@@ -1,27 +1,27 @@
 package handler
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"sort"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type OrderHandler struct {
 	repo order.Repository
 
-	idempotencyCache store.Cache[order.Order]
-
 	productGRPCService product.ProductsClient
 }
 
@@ -37,12 +37,6 @@ func NewOrderHandler(repo order.Repository, configs ...func(h *OrderHandler)) Or
 	return h
 }
 
-func WithIdempotencyCache(c store.Cache[order.Order]) func(h *OrderHandler) {
-	return func(h *OrderHandler) {
-		h.idempotencyCache = c
-	}
-}
-
 func WithProductGRPCService(s product.ProductsClient) func(h *OrderHandler) {
 	return func(h *OrderHandler) {
 		h.productGRPCService = s
@@ -52,28 +46,54 @@ func WithProductGRPCService(s product.ProductsClient) func(h *OrderHandler) {
 func (h *OrderHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Post("/", h.placeOrder)
-	r.Get("/", h.listOrders)
+	admin := authz.Require(authz.Admin)
+
+	authenticated := authz.Require(authz.Authenticated)
+
+	r.With(authenticated).Post("/", h.placeOrder)
+	r.With(authenticated).Get("/", h.listOrders)
 
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", h.getOrder)
-		r.Put("/", h.updateOrder)
-		r.Delete("/", h.deleteOrder)
+		r.Group(func(r chi.Router) {
+			r.Use(authz.Require(authz.Owner(h.orderOwner)))
+
+			r.Get("/", h.getOrder)
+			r.Put("/", h.updateOrder)
+			r.Get("/history", h.getOrderHistory)
+		})
+
+		r.With(admin).Delete("/", h.deleteOrder)
 	})
 
-	r.Get("/search", h.Search)
+	r.With(authenticated).Get("/search", h.Search)
 
 	return r
 }
 
+// orderOwner returns the user who placed the requested order.
+func (h *OrderHandler) orderOwner(r *http.Request) (string, error) {
+	o, err := h.repo.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return o.UserID, nil
+}
+
 // @Summary		Place an order
-// @Description	place an order
+// @Description	place an order of variants of products, items without a variant_id order the default variant of the product
 // @Tags			orders
 // @Accept			json
 // @Produce		json
-// @Param			body	body		request	true	"request"
+// @Param			body			body		request	true	"request"
+// @Param			Idempotency-Key	header		string	false	"replays the response of an earlier request with the same key"
 // @Success		200		{string}	string	"order id"
 // @Failure		400		{array}		response.ErrorResponse
+// @Failure		403		{string}	string
 // @Failure		500
 // @Router			/orders [post]
 func (h *OrderHandler) placeOrder(w http.ResponseWriter, r *http.Request) {
@@ -86,87 +106,150 @@ func (h *OrderHandler) placeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if errs := req.Validate(); errs != nil {
-		response.BadRequest(w, r, errs)
+	// Orders belong to the caller, only admins order for someone else
+	userID, err := authz.FromContext(r.Context()).OnBehalfOf(req.UserID)
+	if err != nil {
+		response.Forbidden(w, r, err)
 		return
 	}
 
-	idempotencyKey := h.generateIdempotencyKey(req)
+	req.UserID = userID
+	req.normalize()
 
-	stored, has := h.idempotencyCache.Get(idempotencyKey)
-	if has {
-		render.PlainText(w, r, stored.ID)
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
 		return
 	}
 
-	// Check if products are available
-	availabes, err := h.productGRPCService.ProductsAvailable(r.Context(), &product.ProductsAvailableRequest{
-		ProductIds: req.ProductID,
+	variantIDs := make([]string, 0, len(req.Items))
+	for _, item := range req.Items {
+		variantIDs = append(variantIDs, item.VariantID)
+	}
+
+	// Get variant prices
+	prices, err := h.productGRPCService.GetProductPrices(r.Context(), &product.GetProductPricesRequest{
+		VariantIds: variantIDs,
 	})
 	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: status.Convert(err).Message(),
+				Field:   "items.variant_id",
+			}})
+			return
+		}
+
 		response.InternalServerError(w, r, err)
 		return
 	}
 
-	for _, p := range availabes.GetAvailability() {
-		if !p.Available {
+	o := order.Order{
+		ID:          store.GenerateID(),
+		UserID:      req.UserID,
+		OrderedDate: store.OnlyDate(req.OrderedDate),
+		Status:      order.StatusNew,
+	}
+
+	// Snapshot the current prices, the total is computed from them
+	for _, item := range req.Items {
+		if prices.GetProductIds()[item.VariantID] != item.ProductID {
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: fmt.Sprintf("variant %s is not a variant of product %s", item.VariantID, item.ProductID),
+				Field:   "items.variant_id",
+			}})
+			return
+		}
+
+		price := money.FromProto(prices.GetPrices()[item.VariantID])
+
+		if err := o.AddItem(item.ProductID, item.VariantID, item.Quantity, price); err != nil {
 			response.BadRequest(w, r, []response.ErrorResponse{{
-				Message: fmt.Sprintf("product %s with id: %s is not available, stock is %d", p.GetName(), p.GetProductId(), p.GetStock()),
-				Field:   "product_id",
+				Message: err.Error(),
+				Field:   "items.product_id",
 			}})
 			return
 		}
 	}
 
-	// Get product prices
-	prices, err := h.productGRPCService.GetProductPrices(r.Context(), &product.GetProductPricesRequest{
-		ProductIds: req.ProductID,
+	// Hold the stock until the order is paid for
+	items := []*product.ReserveProduct{}
+	for variantID, amount := range o.TotalAmount() {
+		items = append(items, &product.ReserveProduct{
+			VariantId: variantID,
+			Quantity:  int32(amount),
+		})
+	}
+
+	reservation, err := h.productGRPCService.ReserveStock(r.Context(), &product.ReserveStockRequest{
+		OrderId: o.ID,
+		Items:   items,
 	})
 	if err != nil {
 		response.InternalServerError(w, r, err)
 		return
 	}
 
-	o := order.Order{
-		ID:          store.GenerateID(),
-		UserID:      req.UserID,
-		ProductID:   req.ProductID,
-		OrderedDate: store.OnlyDate(req.OrderedDate),
-		Status:      req.Status,
-	}
+	if !reservation.GetSuccess() {
+		errs := []response.ErrorResponse{}
+		for _, res := range reservation.GetResults() {
+			if res.GetSuccess() {
+				continue
+			}
+
+			errs = append(errs, response.ErrorResponse{
+				Message: fmt.Sprintf("%s, stock is %d", res.GetMessage(), res.GetStock()),
+				Field:   "items.variant_id",
+			})
+		}
 
-	// Calculate total price
-	for _, price := range prices.GetPrices() {
-		o.TotalPrice += float64(price)
+		response.BadRequest(w, r, errs)
+		return
 	}
 
 	id, err := h.repo.Create(r.Context(), o)
 	if err != nil {
+		releaseReservation(context.Background(), h.productGRPCService, o.ID)
+
 		response.InternalServerError(w, r, err)
 		return
 	}
 
-	h.idempotencyCache.Set(idempotencyKey, o)
-
 	render.PlainText(w, r, id)
 }
 
 // @Summary		List orders
-// @Description	list all orders
+// @Description	list the caller's orders, or all orders for admins, a page at a time
 // @Tags			orders
 // @Accept			json
 // @Produce		json
-// @Success		200	{array}	order.Order
+// @Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort	query		string	false	"Sort field: ordered_date (default), total_price or status"
+// @Param			order	query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[order.Order]
+// @Failure		400		{array}		response.ErrorResponse
 // @Failure		500
 // @Router			/orders [get]
 func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request) {
-	products, err := h.repo.List(r.Context())
+	req, err := store.PageRequestFromQuery(r.URL.Query())
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	render.JSON(w, r, products)
+	var orders store.Page[order.Order]
+
+	if p := authz.FromContext(r.Context()); p.IsAdmin() {
+		orders, err = h.repo.List(r.Context(), req)
+	} else {
+		orders, err = h.repo.ListByUser(r.Context(), p.UserID, req)
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	response.Paginated(w, r, orders.Items, orders.Next, orders.Prev, orders.Total)
 }
 
 // @Summary		Get order
@@ -177,6 +260,7 @@ func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request) {
 // @Param			id	path		string	true	"order id"
 // @Success		200	{object}	order.Order
 // @Failure		400	{array}		response.ErrorResponse
+// @Failure		403	{string}	string
 // @Failure		404	{string}	string
 // @Failure		500
 // @Router			/orders/{id} [get]
@@ -202,10 +286,13 @@ func (h *OrderHandler) getOrder(w http.ResponseWriter, r *http.Request) {
 // @Tags			orders
 // @Accept			json
 // @Produce		json
-// @Param			id	path	string	true	"order id"
+// @Param			id		path	string	true	"order id"
+// @Param			body	body	request	true	"request"
 // @Success		200
 // @Failure		400	{array}		response.ErrorResponse
+// @Failure		403	{string}	string
 // @Failure		404	{string}	string
+// @Failure		409	{string}	string
 // @Failure		500
 // @Router			/orders/{id} [put]
 func (h *OrderHandler) updateOrder(w http.ResponseWriter, r *http.Request) {
@@ -220,25 +307,94 @@ func (h *OrderHandler) updateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if errs := req.Validate(); errs != nil {
+	if errs := req.ValidateUpdate(); errs != nil {
 		response.BadRequest(w, r, errs)
 		return
 	}
 
-	err := h.repo.Update(r.Context(), id, order.Order{
-		ProductID: req.ProductID,
-		// TotalPrice:  req.TotalPrice,
-		OrderedDate: store.OnlyDate(req.OrderedDate),
-		Status:      req.Status,
-	})
+	o, err := h.repo.Get(r.Context(), id)
 	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
 		response.InternalServerError(w, r, err)
 		return
 	}
 
+	caller := authz.FromContext(r.Context())
+
+	// Clients may only cancel their orders, the other statuses follow from
+	// payments and shipping. Nothing is written before the checks pass
+	if req.Status != "" && req.Status != order.StatusCancelled && !caller.IsAdmin() {
+		response.Forbidden(w, r, authz.ErrForbidden)
+		return
+	}
+
+	changes := []order.StatusChange{}
+
+	if req.Status != "" && req.Status != o.Status {
+		change, err := o.TransitionTo(req.Status, caller.UserID, req.Reason)
+		if err != nil {
+			response.Conflict(w, r, err)
+			return
+		}
+
+		changes = append(changes, change)
+	}
+
+	o.OrderedDate = store.OnlyDate(req.OrderedDate)
+
+	// The date and the status change together or not at all
+	if err := h.repo.Update(r.Context(), id, o, changes...); err != nil {
+		switch {
+		case errors.Is(err, order.ErrNotFound):
+			response.NotFound(w, r, err)
+		case errors.Is(err, order.ErrStatusConflict):
+			response.Conflict(w, r, err)
+		default:
+			response.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	// The stock of a cancelled order is for sale again
+	if len(changes) > 0 && changes[0].To == order.StatusCancelled {
+		releaseReservation(context.Background(), h.productGRPCService, o.ID)
+	}
+
 	render.Status(r, http.StatusOK)
 }
 
+// @Summary		Get order status history
+// @Description	Get the status transitions of an order, oldest first
+// @Tags			orders
+// @Accept			json
+// @Produce		json
+// @Param			id	path		string	true	"order id"
+// @Success		200	{array}		order.StatusChange
+// @Failure		403	{string}	string
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/orders/{id}/history [get]
+func (h *OrderHandler) getOrderHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	history, err := h.repo.History(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, order.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, history)
+}
+
 // @Summary		Delete order
 // @Description	Delete order by id
 // @Tags			orders
@@ -247,6 +403,7 @@ func (h *OrderHandler) updateOrder(w http.ResponseWriter, r *http.Request) {
 // @Param			id	path	string	true	"order id"
 // @Success		200
 // @Failure		400	{array}		response.ErrorResponse
+// @Failure		403	{string}	string
 // @Failure		404	{string}	string
 // @Failure		500
 // @Router			/orders/{id} [delete]
@@ -263,37 +420,63 @@ func (h *OrderHandler) deleteOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary		Search order
-// @Description	Search order by user id and status
+// @Description	Search the caller's orders, or all orders for admins, with field=value, field[in]=a,b or field[range]=low,high filters combined with AND. Fields: user_id, status, currency, total_price, ordered_date
 // @Tags			orders
 // @Accept			json
 // @Produce		json
-// @Param			user	query	string	false	"user id"
-// @Param			status	query	string	false	"status"
-// @Success		200
+// @Param			user_id			query	string	false	"user id"
+// @Param			status			query	string	false	"status"
+// @Param			ordered_date	query	string	false	"date ordered"
+// @Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort	query		string	false	"Sort field: ordered_date (default), total_price or status"
+// @Param			order	query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200	{object}	response.Page[order.Order]
 // @Failure		400	{array}		response.ErrorResponse
-// @Failure		404	{string}	string
 // @Failure		500
 // @Router			/orders/search [get]
 func (h *OrderHandler) Search(w http.ResponseWriter, r *http.Request) {
-	productID := r.URL.Query().Get("user")
-	status := r.URL.Query().Get("status")
+	query := r.URL.Query()
 
-	products, err := h.repo.Search(r.Context(), productID, status)
+	req, err := store.PageRequestFromQuery(query)
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	render.JSON(w, r, products)
-}
+	filters, err := store.FiltersFromQuery(query, store.PageParams...)
+	if err == nil && len(filters) == 0 {
+		err = &store.FilterError{Field: "query", Message: "empty query"}
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	if p := authz.FromContext(r.Context()); !p.IsAdmin() {
+		filters = append(filters, store.Filter{Field: "user_id", Op: store.Eq, Values: []string{p.UserID}})
+	}
 
-func (h *OrderHandler) generateIdempotencyKey(req request) string {
-	// Normalize the ProductID slice by sorting it
-	sort.Strings(req.ProductID)
+	orders, err := h.repo.Search(r.Context(), filters, req)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
 
-	keyData := fmt.Sprintf("%s|%s|%s", req.UserID, req.ProductID, req.OrderedDate)
+	response.Paginated(w, r, orders.Items, orders.Next, orders.Prev, orders.Total)
+}
 
-	hash := sha256.Sum256([]byte(keyData))
+// queryError answers filters and page requests the repository doesn't take
+// with 400.
+func queryError(w http.ResponseWriter, r *http.Request, err error) {
+	var filterErr *store.FilterError
+	if errors.As(err, &filterErr) {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: filterErr.Message,
+			Field:   filterErr.Field,
+		}})
+		return
+	}
 
-	return hex.EncodeToString(hash[:])
+	response.InternalServerError(w, r, err)
 }
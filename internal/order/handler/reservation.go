@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// releaseReservation gives the stock held for an order back to the product
+// service. Failures are only logged, the reservation expires on its own.
+func releaseReservation(ctx context.Context, products product.ProductsClient, orderID string) {
+	resp, err := products.ReleaseReservation(ctx, &product.ReservationRequest{
+		OrderId: orderID,
+	})
+
+	switch {
+	case status.Code(err) == codes.NotFound:
+		// Nothing was reserved for the order
+	case err != nil:
+		fmt.Printf("Releasing reservation of order %s failed: %v\n", orderID, err)
+	case !resp.GetSuccess():
+		fmt.Printf("Releasing reservation of order %s failed: %s\n", orderID, resp.GetMessage())
+	}
+}
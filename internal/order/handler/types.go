@@ -5,26 +5,69 @@ import (
 
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
 )
 
 type request struct {
-	UserID    string   `json:"user_id"`
-	ProductID []string `json:"product_id"`
-	// TotalPrice  float64
-	OrderedDate string `json:"ordered_date"`
-	Status      string `json:"status"`
+	UserID      string        `json:"user_id"`
+	Items       []itemRequest `json:"items"`
+	OrderedDate string        `json:"ordered_date"`
+	Status      string        `json:"status"`
+	Reason      string        `json:"reason"`
 } // @name OrderRequest
 
+// itemRequest orders a variant of a product, the default variant when the
+// variant is left out.
+type itemRequest struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+} // @name OrderItemRequest
+
+// normalize picks the default variant, which has the id of its product, for
+// items without a variant.
+func (r *request) normalize() {
+	for i := range r.Items {
+		if r.Items[i].VariantID == "" {
+			r.Items[i].VariantID = r.Items[i].ProductID
+		}
+	}
+}
+
 func (r request) Validate() []response.ErrorResponse {
 	var errs []response.ErrorResponse
 
-	if r.ProductID == nil {
+	if len(r.Items) == 0 {
 		errs = append(errs, response.ErrorResponse{
-			Message: "ProductID is required",
-			Field:   "product_id",
+			Message: "Items are required",
+			Field:   "items",
 		})
 	}
 
+	for _, item := range r.Items {
+		if item.ProductID == "" {
+			errs = append(errs, response.ErrorResponse{
+				Message: "ProductID is required",
+				Field:   "items.product_id",
+			})
+		}
+
+		if item.Quantity <= 0 {
+			errs = append(errs, response.ErrorResponse{
+				Message: "Quantity must be positive",
+				Field:   "items.quantity",
+			})
+		}
+	}
+
+	return append(errs, r.ValidateUpdate()...)
+}
+
+// ValidateUpdate checks the fields an update reads, the items of an order
+// don't change once it is placed.
+func (r request) ValidateUpdate() []response.ErrorResponse {
+	var errs []response.ErrorResponse
+
 	if _, err := time.Parse(store.DateLayout, r.OrderedDate); err != nil {
 		errs = append(errs, response.ErrorResponse{
 			Message: "Invalid date format",
@@ -32,9 +75,9 @@ func (r request) Validate() []response.ErrorResponse {
 		})
 	}
 
-	if r.Status == "" {
+	if r.Status != "" && !order.ValidStatus(r.Status) {
 		errs = append(errs, response.ErrorResponse{
-			Message: "Status is required",
+			Message: "Invalid status",
 			Field:   "status",
 		})
 	}
@@ -5,45 +5,120 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
 	orderpb "github.com/erazr/ecommerce-microservices/internal/common/pb/order"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/common/router"
 	"github.com/erazr/ecommerce-microservices/internal/common/server"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
-	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
+	"github.com/erazr/ecommerce-microservices/internal/order/docs"
 	"github.com/erazr/ecommerce-microservices/internal/order/handler"
 	"github.com/erazr/ecommerce-microservices/internal/order/repository"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+//	@title			E-commerce Microservices Order Service
+//	@version		1.0
+//	@description	Places orders and tracks their status.
+
 func main() {
 	db, err := store.New(os.Getenv("DB_URL"))
 	if err != nil {
 		panic(err)
 	}
 
-	conn, err := grpc.NewClient("product:"+os.Getenv("PRODUCT_GRPC_PORT"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	grpcTLS, err := server.LoadGRPCTLS(os.Getenv("GRPC_TLS_DIR"), "order")
+	if err != nil {
+		panic(err)
+	}
+
+	conn, err := server.DialGRPC("product:"+os.Getenv("PRODUCT_GRPC_PORT"), "order", grpcTLS)
 	if err != nil {
 		panic(err)
 	}
 	defer conn.Close()
 
 	orderRepository := repository.NewOrderRepository(db.Client)
-	idempotencyCache := store.NewInMemoryIdempotencyCache[order.Order]()
-	orderHandler := handler.NewOrderHandler(orderRepository, handler.WithIdempotencyCache(idempotencyCache), handler.WithProductGRPCService(product.NewProductsClient(conn)))
+
+	productsClient := product.NewProductsClient(conn)
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	bus := events.NewPostgresBus(db.Client, os.Getenv("DB_URL"), "order")
+	handler.NewOrderEventHandler(orderRepository, productsClient).Subscribe(bus)
+
+	relayConfigs := []func(*events.Relay){}
+	if retention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil {
+		relayConfigs = append(relayConfigs, events.WithRetention(retention))
+	}
+
+	go events.NewRelay(db.Client, bus, relayConfigs...).Run(background)
+	go func() {
+		if err := bus.Listen(background); err != nil {
+			fmt.Printf("Event listener stopped: %v\n", err)
+		}
+	}()
+
+	idempotencyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil {
+		idempotencyTTL = 24 * time.Hour
+	}
+
+	var requestCache server.IdempotencyCache
+
+	if dir := os.Getenv("IDEMPOTENCY_DIR"); dir != "" {
+		responseCache, err := store.NewFileCache[server.StoredResponse](filepath.Join(dir, "order_requests"), idempotencyTTL)
+		if err != nil {
+			panic(err)
+		}
+
+		requestCache = responseCache
+	} else {
+		responseCache := store.NewPostgresCache[server.StoredResponse](db.Client, "order_requests", idempotencyTTL)
+		requestCache = responseCache
+
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+
+			for {
+				if err := responseCache.Purge(background); err != nil {
+					fmt.Printf("Purging idempotency keys failed: %v\n", err)
+				}
+
+				select {
+				case <-background.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	orderHandler := handler.NewOrderHandler(orderRepository, handler.WithProductGRPCService(productsClient))
 
 	r := router.New()
+	r.Use(authz.Identify)
+	r.Use(server.Idempotency(requestCache))
 	r.Mount("/orders", orderHandler.Routes())
+	r.Get("/openapi.json", openapi.Handler(docs.OpenAPI))
 
-	grpcServer := grpc.NewServer()
-	grpcHandler := handler.NewOrderGRPCHandler(orderRepository)
-	orderpb.RegisterOrdersServer(grpcServer, grpcHandler)
+	grpcHandler := handler.NewOrderGRPCHandler(orderRepository, productsClient)
+	registerGRPC := func(s *grpc.Server) {
+		orderpb.RegisterOrdersServer(s, grpcHandler)
+	}
 
-	server, err := server.New(server.WithHTTPServer(r, os.Getenv("ORDER_PORT")), server.WithGRPCServer(grpcServer, os.Getenv("ORDER_GRPC_PORT")))
+	server, err := server.New(
+		server.WithHTTPServer(r, os.Getenv("ORDER_PORT")),
+		server.WithGRPCServer(registerGRPC, os.Getenv("ORDER_GRPC_PORT"), server.WithGRPCTLS(grpcTLS), server.WithGRPCInsecure(os.Getenv("GRPC_INSECURE") == "true"), server.WithGRPCCallers(handler.GRPCCallers)),
+	)
 	if err != nil {
 		panic(err)
 	}
@@ -58,6 +133,8 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -65,8 +142,6 @@ func main() {
 		panic(err)
 	}
 
-	grpcServer.GracefulStop()
-
 	fmt.Println("Service stopped")
 
 }
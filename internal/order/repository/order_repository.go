@@ -4,8 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/order/domain/order"
 	"github.com/jmoiron/sqlx"
@@ -19,12 +20,21 @@ func NewOrderRepository(db *sqlx.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
+// Create stores the order with its products, its initial status and the
+// OrderPlaced event in one transaction.
 func (r *OrderRepository) Create(ctx context.Context, o order.Order) (string, error) {
-	err := r.db.QueryRowContext(ctx, "INSERT INTO orders (id, user_id, ordered_date, total_price, status) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO orders (id, user_id, ordered_date, total_price, currency, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
 		o.ID,
 		o.UserID,
 		o.OrderedDate,
 		o.TotalPrice,
+		o.TotalPrice.Currency,
 		o.Status,
 	).Scan(&o.ID)
 	if err != nil {
@@ -35,75 +45,72 @@ func (r *OrderRepository) Create(ctx context.Context, o order.Order) (string, er
 		return "", err
 	}
 
-	ids := o.TotalAmount()
+	for _, item := range o.Items {
+		q := "INSERT INTO order_products (order_id, product_id, variant_id, quantity, unit_price, line_total) VALUES ($1, $2, $3, $4, $5, $6)"
 
-	for productID, amount := range ids {
-		_, err = r.db.ExecContext(ctx, "INSERT INTO order_products (order_id, product_id, amount) VALUES ($1, $2, $3)", o.ID, productID, amount)
+		_, err = tx.ExecContext(ctx, q, o.ID, item.ProductID, item.VariantID, item.Quantity, item.UnitPrice, item.LineTotal)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	return o.ID, err
+	err = insertStatusChange(ctx, tx, order.StatusChange{
+		OrderID: o.ID,
+		To:      o.Status,
+		Actor:   o.UserID,
+		Reason:  "order placed",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	items := make([]events.OrderPlacedItem, 0, len(o.Items))
+	for _, item := range o.Items {
+		items = append(items, events.OrderPlacedItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	e, err := events.New(events.OrderPlaced, o.ID, events.OrderPlacedPayload{
+		OrderID:    o.ID,
+		UserID:     o.UserID,
+		Items:      items,
+		TotalPrice: o.TotalPrice,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err = events.Add(ctx, tx, e); err != nil {
+		return "", err
+	}
+
+	return o.ID, tx.Commit()
 }
 
 func (r *OrderRepository) Get(ctx context.Context, id string) (order.Order, error) {
-	var o order.Order
-
 	query := `
         SELECT 
-            o.id, o.user_id, o.total_price, o.ordered_date, o.status, 
-            op.product_id, op.amount
+            o.id, o.user_id, o.total_price, o.currency, o.ordered_date, o.status, 
+            op.product_id, op.variant_id, op.quantity, op.unit_price, op.line_total
         FROM orders o
         JOIN order_products op ON o.id = op.order_id
         WHERE o.id = $1
     `
 
-	rows, err := r.db.QueryxContext(ctx, query, id)
+	orders, err := r.selectOrders(ctx, query, id)
 	if err != nil {
 		return order.Order{}, err
 	}
-	defer rows.Close()
-
-	var (
-		orderID     string
-		userID      string
-		productID   string
-		status      string
-		totalPrice  float64
-		orderedDate store.OnlyDate
-		amount      int
-	)
-
-	o.ProductID = []string{}
-
-	for rows.Next() {
-		err := rows.Scan(&orderID, &userID, &totalPrice, &orderedDate, &status, &productID, &amount)
-		if err != nil {
-			return order.Order{}, err
-		}
-
-		if o.ID == "" {
-			o = order.Order{
-				ID:          orderID,
-				UserID:      userID,
-				TotalPrice:  totalPrice,
-				OrderedDate: orderedDate,
-				Status:      status,
-				ProductID:   []string{},
-			}
-		}
-
-		for i := 0; i < amount; i++ {
-			o.AddProduct(productID)
-		}
-	}
 
-	if o.ID == "" {
+	if len(orders) == 0 {
 		return order.Order{}, order.ErrNotFound
 	}
 
-	return o, nil
+	return orders[0], nil
 }
 
 func (r *OrderRepository) Delete(ctx context.Context, id string) error {
@@ -119,126 +126,223 @@ func (r *OrderRepository) Delete(ctx context.Context, id string) error {
 	return err
 }
 
-func (r *OrderRepository) List(ctx context.Context) ([]order.Order, error) {
-	var orders []order.Order
+func (r *OrderRepository) List(ctx context.Context, req store.PageRequest) (store.Page[order.Order], error) {
+	return r.Search(ctx, nil, req)
+}
 
-	query := `
-        SELECT 
-            o.id, o.user_id, o.total_price, o.ordered_date, o.status, 
-            op.product_id, op.amount
-        FROM orders o
-        JOIN order_products op ON o.id = op.order_id
-    `
+func (r *OrderRepository) ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[order.Order], error) {
+	filters := []store.Filter{{Field: "user_id", Op: store.Eq, Values: []string{userID}}}
+
+	return r.Search(ctx, filters, req)
+}
 
-	rows, err := r.db.QueryxContext(ctx, query)
+// Update changes everything but the status, which only moves through the
+// status changes given with it or UpdateStatus. Nothing is written unless
+// every change applies.
+func (r *OrderRepository) Update(ctx context.Context, id string, o order.Order, changes ...order.StatusChange) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	orderMap := make(map[string]*order.Order)
+	q := "UPDATE orders SET user_id = $1, total_price = $2, ordered_date = $3 WHERE id = $4 RETURNING id"
 
-	for rows.Next() {
-		var id, userID, productID, status string
-		var totalPrice float64
-		var orderedDate store.OnlyDate
-		var amount int
+	args := []any{o.UserID, o.TotalPrice, o.OrderedDate, id}
 
-		err := rows.Scan(&id, &userID, &totalPrice, &orderedDate, &status, &productID, &amount)
-		if err != nil {
-			return nil, err
+	if err = tx.QueryRowContext(ctx, q, args...).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return order.ErrNotFound
 		}
 
-		if _, ok := orderMap[id]; !ok {
-			orderMap[id] = &order.Order{
-				ID:          id,
-				UserID:      userID,
-				TotalPrice:  totalPrice,
-				OrderedDate: orderedDate,
-				Status:      status,
-				ProductID:   []string{},
-			}
-		}
-		for i := 0; i < amount; i++ {
-			orderMap[id].AddProduct(productID)
+		return err
+	}
+
+	for _, c := range changes {
+		if err = updateStatus(ctx, tx, c); err != nil {
+			return err
 		}
 	}
 
-	for _, order := range orderMap {
-		orders = append(orders, *order)
+	return tx.Commit()
+}
+
+// UpdateStatus applies the change only if the order is still in the status
+// the change was made from, and records it in the history.
+func (r *OrderRepository) UpdateStatus(ctx context.Context, c order.StatusChange) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = updateStatus(ctx, tx, c); err != nil {
+		return err
 	}
 
-	return orders, nil
+	return tx.Commit()
 }
 
-func (r *OrderRepository) Update(ctx context.Context, id string, o order.Order) error {
-	q := "UPDATE orders SET user_id = $1, total_price = $2, ordered_date = $3, status = $4 WHERE id = $5 RETURNING id"
+func updateStatus(ctx context.Context, tx *sqlx.Tx, c order.StatusChange) error {
+	res, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2 AND status = $3", c.To, c.OrderID, c.From)
+	if err != nil {
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
 
-	args := []any{o.UserID, o.TotalPrice, o.OrderedDate, o.Status, id}
+	if updated == 0 {
+		var exists bool
 
-	fmt.Println(o)
+		if err = tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)", c.OrderID); err != nil {
+			return err
+		}
 
-	if err := r.db.QueryRowContext(ctx, q, args...).Scan(&id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if !exists {
 			return order.ErrNotFound
 		}
 
-		return err
+		return order.ErrStatusConflict
+	}
+
+	return insertStatusChange(ctx, tx, c)
+}
+
+func (r *OrderRepository) History(ctx context.Context, id string) ([]order.StatusChange, error) {
+	history := []order.StatusChange{}
+
+	q := `
+		SELECT order_id, from_status, to_status, actor, reason, changed_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id
+	`
+
+	if err := r.db.SelectContext(ctx, &history, q, id); err != nil {
+		return nil, err
+	}
+
+	if len(history) == 0 {
+		return nil, order.ErrNotFound
 	}
 
-	fmt.Println(o, "updated")
+	return history, nil
+}
+
+func insertStatusChange(ctx context.Context, tx *sqlx.Tx, c order.StatusChange) error {
+	q := "INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason) VALUES ($1, $2, $3, $4, $5)"
 
-	return nil
+	_, err := tx.ExecContext(ctx, q, c.OrderID, c.From, c.To, c.Actor, c.Reason)
+
+	return err
 }
 
-func (r *OrderRepository) Search(ctx context.Context, filter, value string) ([]order.Order, error) {
-	var orders []order.Order
+// searchColumns are the fields orders can be searched by.
+var searchColumns = store.Columns{
+	"user_id":      {Name: "o.user_id"},
+	"status":       {Name: "o.status"},
+	"currency":     {Name: "o.currency"},
+	"total_price":  {Name: "o.total_price", Type: store.Number},
+	"ordered_date": {Name: "o.ordered_date", Type: store.Date},
+}
+
+// sortKeys are the fields orders can be sorted by.
+var sortKeys = store.Keyset[order.Order]{
+	ID:   "o.id",
+	IDOf: func(o order.Order) string { return o.ID },
+	Sorts: map[string]store.SortKey[order.Order]{
+		"ordered_date": {Column: "o.ordered_date", Type: store.Date, Value: func(o order.Order) string { return string(o.OrderedDate) }},
+		"total_price":  {Column: "o.total_price", Type: store.Number, Value: func(o order.Order) string { return o.TotalPrice.Decimal() }},
+		"status":       {Column: "o.status", Value: func(o order.Order) string { return o.Status }},
+	},
+	Default: "ordered_date",
+}
+
+// Search pages the ids of the matching orders first, the join returns a row
+// per order line so it can't be limited itself.
+func (r *OrderRepository) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[order.Order], error) {
+	where, args, err := searchColumns.Where(filters, 0)
+	if err != nil {
+		return store.Page[order.Order]{}, err
+	}
+
+	after, orderBy, limit, afterArgs, err := sortKeys.Clause(req, len(args))
+	if err != nil {
+		return store.Page[order.Order]{}, err
+	}
+
+	var total int
+
+	if err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM orders o WHERE "+where, args...); err != nil {
+		return store.Page[order.Order]{}, err
+	}
 
 	query := `
         SELECT 
-            o.id, o.user_id, o.total_price, o.ordered_date, o.status, 
-            op.product_id
+            o.id, o.user_id, o.total_price, o.currency, o.ordered_date, o.status, 
+            op.product_id, op.variant_id, op.quantity, op.unit_price, op.line_total
         FROM orders o
         JOIN order_products op ON o.id = op.order_id
-		WHERE $1 = $2
-    `
+		WHERE o.id IN (
+			SELECT o.id FROM orders o WHERE ` + where + ` AND ` + after + `
+			` + orderBy + ` ` + limit + `
+		)
+		` + orderBy
 
-	rows, err := r.db.QueryxContext(ctx, query, filter, value)
+	orders, err := r.selectOrders(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return store.Page[order.Order]{}, err
+	}
+
+	return sortKeys.Page(req, orders, total)
+}
+
+// selectOrders runs a query returning one row per order line and groups the
+// lines into orders, keeping the order the rows came in.
+func (r *OrderRepository) selectOrders(ctx context.Context, query string, args ...any) ([]order.Order, error) {
+	rows, err := r.db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	orderMap := make(map[string]*order.Order)
+	orders := []order.Order{}
+	index := make(map[string]int)
 
 	for rows.Next() {
-		var id, userID, productID, status string
-		var totalPrice float64
-		var orderedDate store.OnlyDate
-
-		err := rows.Scan(&id, &userID, &totalPrice, &orderedDate, &status, &productID)
+		var (
+			o        order.Order
+			item     order.LineItem
+			currency string
+		)
+
+		err := rows.Scan(&o.ID, &o.UserID, &o.TotalPrice, &currency, &o.OrderedDate, &o.Status,
+			&item.ProductID, &item.VariantID, &item.Quantity, &item.UnitPrice, &item.LineTotal)
 		if err != nil {
 			return nil, err
 		}
 
-		if _, ok := orderMap[id]; !ok {
-			orderMap[id] = &order.Order{
-				ID:          id,
-				UserID:      userID,
-				TotalPrice:  totalPrice,
-				OrderedDate: orderedDate,
-				Status:      status,
-				ProductID:   []string{},
+		for _, m := range []*money.Money{&o.TotalPrice, &item.UnitPrice, &item.LineTotal} {
+			if *m, err = m.WithCurrency(currency); err != nil {
+				return nil, err
 			}
 		}
-		orderMap[id].ProductID = append(orderMap[id].ProductID, productID)
-	}
 
-	for _, order := range orderMap {
-		orders = append(orders, *order)
+		i, ok := index[o.ID]
+		if !ok {
+			o.Items = []order.LineItem{}
+			orders = append(orders, o)
+			i = len(orders) - 1
+			index[o.ID] = i
+		}
+
+		orders[i].Items = append(orders[i].Items, item)
 	}
 
-	return orders, nil
+	return orders, rows.Err()
 }
 
 // func (r *OrderRepository) prepareArgs(order Order) (sets []string, args []any) {
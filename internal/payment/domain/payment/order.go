@@ -0,0 +1,24 @@
+package payment
+
+import (
+	"context"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+var ErrOrderNotFound = &PaymentError{"order not found"}
+
+// Order is what payments need to know about an order, recorded from the
+// OrderPlaced events of the order service. An order's owner and total don't
+// change once it is placed.
+type Order struct {
+	ID     string      `db:"id"`
+	UserID string      `db:"user_id"`
+	Total  money.Money `db:"total"`
+}
+
+type OrderRepository interface {
+	// Save records an order, saving it again changes nothing.
+	Save(ctx context.Context, o Order) error
+	Get(ctx context.Context, id string) (Order, error)
+}
@@ -3,6 +3,7 @@ package payment
 import (
 	"context"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 )
 
@@ -10,16 +11,30 @@ type Payment struct {
 	ID           string         `db:"id" json:"id"`
 	UserID       string         `db:"user_id" json:"user_id"`
 	OrderID      string         `db:"order_id" json:"order_id"`
-	TotalPayment float64        `db:"total_payment" json:"total_payment"`
+	TotalPayment money.Money    `db:"total_payment" json:"total_payment"`
 	PaymentDate  store.OnlyDate `db:"payment_date" json:"payment_date"`
 	Status       string         `db:"status" json:"status"`
+	// Provider and TransactionID identify the charge at the payment
+	// processor once it has been authorized.
+	Provider      string `db:"provider" json:"provider"`
+	TransactionID string `db:"transaction_id" json:"transaction_id"`
 } // @name Payment
 
+const (
+	StatusPending           = "pending"
+	StatusSuccess           = "success"
+	StatusFailed            = "failed"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+)
+
 var (
 	ErrExists             = &PaymentError{"payment already exists"}
 	ErrNotFound           = &PaymentError{"payment not found"}
 	ErrSearch             = &PaymentError{"payment search error"}
 	ErrInsufficientAmount = &PaymentError{"insufficient amount"}
+	ErrForeignOrder       = &PaymentError{"order belongs to another user"}
+	ErrInProgress         = &PaymentError{"order already has a payment in progress"}
 )
 
 type PaymentError struct {
@@ -37,8 +52,10 @@ func (e *PaymentError) Is(err error) bool {
 type Repository interface {
 	Create(context.Context, Payment) (string, error)
 	Get(ctx context.Context, id string) (Payment, error)
+	GetByTransaction(ctx context.Context, provider, transactionID string) (Payment, error)
 	Update(ctx context.Context, id string, payment Payment) error
 	Delete(ctx context.Context, id string) error
-	List(ctx context.Context) ([]Payment, error)
-	Search(ctx context.Context, filter, value string) ([]Payment, error)
+	List(ctx context.Context, req store.PageRequest) (store.Page[Payment], error)
+	ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[Payment], error)
+	Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[Payment], error)
 }
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"context"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+const (
+	TransactionAuthorized = "authorized"
+	TransactionCaptured   = "captured"
+	TransactionRefunded   = "refunded"
+	TransactionVoided     = "voided"
+	TransactionDeclined   = "declined"
+)
+
+var (
+	ErrDeclined            = &PaymentError{"payment declined"}
+	ErrTransactionNotFound = &PaymentError{"transaction not found"}
+	ErrTransactionState    = &PaymentError{"operation not allowed in the current transaction state"}
+)
+
+type Customer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// Charge describes the money to take for a payment. Source is the opaque
+// payment method handed over by the client, e.g. an ePay card cryptogram.
+// Card details never pass through the service in plain text.
+type Charge struct {
+	PaymentID   string
+	OrderID     string
+	Amount      money.Money
+	Customer    Customer
+	Source      string
+	Description string
+}
+
+// Transaction is the state of a charge at the provider.
+type Transaction struct {
+	ID       string      `json:"id"`
+	Status   string      `json:"status"`
+	Amount   money.Money `json:"amount"`
+	Captured money.Money `json:"captured"`
+	Refunded money.Money `json:"refunded"`
+}
+
+// Provider moves money through a payment processor. Payments are two-step:
+// Authorize puts a hold on the funds and Capture takes them, an authorized
+// transaction that won't be captured is voided.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, c Charge) (Transaction, error)
+	Capture(ctx context.Context, transactionID string, amount money.Money) (Transaction, error)
+	Refund(ctx context.Context, transactionID string, amount money.Money) (Transaction, error)
+	Void(ctx context.Context, transactionID string) (Transaction, error)
+	Status(ctx context.Context, transactionID string) (Transaction, error)
+}
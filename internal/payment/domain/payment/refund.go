@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+var (
+	ErrRefundNotFound       = &PaymentError{"refund not found"}
+	ErrNotRefundable        = &PaymentError{"payment can't be refunded"}
+	ErrRefundExceedsPayment = &PaymentError{"refund exceeds the refundable amount"}
+	ErrRefundExceedsItems   = &PaymentError{"refund exceeds the refundable quantity"}
+)
+
+// Refund returns part or all of a payment. Items lists the products that
+// go back into stock with it.
+type Refund struct {
+	ID        string       `db:"id" json:"id"`
+	PaymentID string       `db:"payment_id" json:"payment_id"`
+	Amount    money.Money  `db:"amount" json:"amount"`
+	Reason    string       `db:"reason" json:"reason"`
+	Status    string       `db:"status" json:"status"`
+	CreatedAt time.Time    `db:"created_at" json:"created_at"`
+	Items     []RefundItem `db:"-" json:"items"`
+} // @name Refund
+
+// RefundItem is a quantity of a variant of a product put back into stock.
+type RefundItem struct {
+	VariantID string `db:"variant_id" json:"variant_id"`
+	Quantity  int    `db:"quantity" json:"quantity"`
+} // @name RefundItem
+
+type RefundRepository interface {
+	// Create stores a pending refund unless it would take the refunds of the
+	// payment over its total, in which case ErrRefundExceedsPayment is
+	// returned, or return more units of a variant than purchased lists
+	// minus the earlier refunds, in which case ErrRefundExceedsItems is.
+	Create(ctx context.Context, r Refund, purchased map[string]int) error
+	Get(ctx context.Context, id string) (Refund, error)
+	ListByPayment(ctx context.Context, paymentID string) ([]Refund, error)
+	SetStatus(ctx context.Context, id, status string) error
+}
+
+// Refunded sums the refunds that weren't rejected.
+func Refunded(total money.Money, refunds []Refund) (money.Money, error) {
+	refunded := money.New(0, total.Currency)
+
+	for _, r := range refunds {
+		if r.Status == RefundFailed {
+			continue
+		}
+
+		var err error
+		if refunded, err = refunded.Add(r.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+
+	return refunded, nil
+}
+
+// RefundableItems returns how many units of each purchased variant the
+// refunds that weren't rejected left to refund.
+func RefundableItems(purchased map[string]int, refunds []Refund) map[string]int {
+	refundable := make(map[string]int, len(purchased))
+	for variantID, quantity := range purchased {
+		refundable[variantID] = quantity
+	}
+
+	for _, r := range refunds {
+		if r.Status == RefundFailed {
+			continue
+		}
+
+		for _, item := range r.Items {
+			refundable[item.VariantID] -= item.Quantity
+		}
+	}
+
+	return refundable
+}
+
+// CheckRefundItems tells whether the items of r are left to refund after
+// the earlier refunds.
+func CheckRefundItems(r Refund, purchased map[string]int, refunds []Refund) error {
+	refundable := RefundableItems(purchased, refunds)
+
+	for _, item := range r.Items {
+		refundable[item.VariantID] -= item.Quantity
+
+		if refundable[item.VariantID] < 0 {
+			return ErrRefundExceedsItems
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRefundItems(t *testing.T) {
+	purchased := map[string]int{"variant1": 2, "variant2": 1}
+
+	earlier := []Refund{
+		{Status: RefundSucceeded, Items: []RefundItem{{VariantID: "variant1", Quantity: 1}}},
+		// Failed refunds returned nothing
+		{Status: RefundFailed, Items: []RefundItem{{VariantID: "variant2", Quantity: 1}}},
+	}
+
+	tests := []struct {
+		name  string
+		items []RefundItem
+		err   error
+	}{
+		{"rest of a variant", []RefundItem{{VariantID: "variant1", Quantity: 1}}, nil},
+		{"after a failed refund", []RefundItem{{VariantID: "variant2", Quantity: 1}}, nil},
+		{"refunded already", []RefundItem{{VariantID: "variant1", Quantity: 2}}, ErrRefundExceedsItems},
+		{"split across items", []RefundItem{{VariantID: "variant1", Quantity: 1}, {VariantID: "variant1", Quantity: 1}}, ErrRefundExceedsItems},
+		{"not purchased", []RefundItem{{VariantID: "variant3", Quantity: 1}}, ErrRefundExceedsItems},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRefundItems(Refund{Items: tt.items}, purchased, earlier)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+var (
+	ErrInvalidSignature = &PaymentError{"invalid webhook signature"}
+	ErrNoWebhooks       = &PaymentError{"provider doesn't send webhooks"}
+	ErrAmountMismatch   = &PaymentError{"notified amount doesn't match the payment"}
+)
+
+// Notification is a payment outcome the provider reports asynchronously.
+type Notification struct {
+	Provider      string
+	TransactionID string
+	// PaymentID is our payment ID if the provider echoes it back.
+	PaymentID string
+	Status    string
+	Amount    money.Money
+	Reason    string
+}
+
+// WebhookVerifier is implemented by providers that send webhooks.
+// ParseWebhook returns ErrInvalidSignature unless the request provably comes
+// from the provider.
+type WebhookVerifier interface {
+	ParseWebhook(header http.Header, body []byte) (Notification, error)
+}
+
+const (
+	WebhookApplied   = "applied"
+	WebhookDuplicate = "duplicate"
+	WebhookIgnored   = "ignored"
+	WebhookRejected  = "rejected"
+	WebhookFailed    = "failed"
+)
+
+// WebhookEvent is a received webhook request as it came in, kept for audits
+// and replays.
+type WebhookEvent struct {
+	ID            int64     `db:"id" json:"id"`
+	Provider      string    `db:"provider" json:"provider"`
+	TransactionID string    `db:"transaction_id" json:"transaction_id"`
+	Status        string    `db:"status" json:"status"`
+	Verified      bool      `db:"verified" json:"verified"`
+	Payload       string    `db:"payload" json:"payload"`
+	Outcome       string    `db:"outcome" json:"outcome"`
+	Error         string    `db:"error" json:"error"`
+	ReceivedAt    time.Time `db:"received_at" json:"received_at"`
+} // @name WebhookEvent
+
+type WebhookRepository interface {
+	Log(ctx context.Context, e WebhookEvent) (int64, error)
+	SetOutcome(ctx context.Context, id int64, outcome, errMessage string) error
+	// Claim marks the notification as being processed. It returns false if
+	// the same status of the transaction was already claimed.
+	Claim(ctx context.Context, n Notification) (bool, error)
+	// Unclaim lets a redelivery process the notification again after
+	// processing failed.
+	Unclaim(ctx context.Context, n Notification) error
+}
@@ -2,10 +2,14 @@ package epay
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -13,11 +17,38 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+)
+
+// Test environment of ePay, used unless configured otherwise.
+const (
+	TestOAuthURL     = "https://testoauth.homebank.kz/epay2/oauth2/token"
+	TestAPIURL       = "https://testepay.homebank.kz/api"
+	TestClientID     = "test"
+	TestClientSecret = "yF587AV9Ms94qN2QShFzVR3vFnWkhjbAK3sG"
+	TestTerminalID   = "67e34d63-102f-4bd1-898e-370781d0074d"
 )
 
+const scope = "webapi usermanagement email_send verification statement statistics payment"
+
+// Service is the ePay (Halyk Bank) payment provider. Payments are made with
+// a card cryptogram built by the client from ePay's public key.
 type Service struct {
 	client *http.Client
+
+	oauthURL     string
+	apiURL       string
+	clientID     string
+	clientSecret string
+	terminalID   string
+
+	postLink        string
+	failurePostLink string
+	webhookSecret   string
 }
 
 type TokenResponse struct {
@@ -38,34 +69,127 @@ type PaymentResponse struct {
 	InvoiceID string  `json:"invoice_id"`
 }
 
-var (
-	ClientID           = "test"
-	ClientSecret       = "yF587AV9Ms94qN2QShFzVR3vFnWkhjbAK3sG"
-	DefaultPaymentData = `{
- 		"hpan":"4405639704015096",
-		"expDate":"0125",
-		"cvc":"815",
-		"terminalId":
-		"67e34d63-102f-4bd1-898e-370781d0074d"
-	}`
-)
+type StatusResponse struct {
+	ResultCode    string `json:"resultCode"`
+	ResultMessage string `json:"resultMessage"`
+	Transaction   struct {
+		ID           string  `json:"id"`
+		StatusName   string  `json:"statusName"`
+		Amount       float64 `json:"amount"`
+		Currency     string  `json:"currency"`
+		ChargeAmount float64 `json:"chargeAmount"`
+		RefundAmount float64 `json:"refundAmount"`
+		InvoiceID    string  `json:"invoiceID"`
+		Reason       string  `json:"reason"`
+	} `json:"transaction"`
+}
+
+// Card is the data ePay expects inside a cryptogram.
+type Card struct {
+	Number     string `json:"hpan"`
+	Expiry     string `json:"expDate"`
+	CVC        string `json:"cvc"`
+	TerminalID string `json:"terminalId"`
+}
+
+func NewService(configs ...func(*Service)) *Service {
+	s := &Service{
+		client:       http.DefaultClient,
+		oauthURL:     TestOAuthURL,
+		apiURL:       TestAPIURL,
+		clientID:     TestClientID,
+		clientSecret: TestClientSecret,
+		terminalID:   TestTerminalID,
+	}
+
+	for _, cfg := range configs {
+		cfg(s)
+	}
+
+	return s
+}
+
+func WithHTTPClient(c *http.Client) func(*Service) {
+	return func(s *Service) {
+		s.client = c
+	}
+}
 
-func NewService() *Service {
-	return &Service{
-		client: http.DefaultClient,
+func WithCredentials(clientID, clientSecret string) func(*Service) {
+	return func(s *Service) {
+		if clientID != "" {
+			s.clientID = clientID
+		}
+		if clientSecret != "" {
+			s.clientSecret = clientSecret
+		}
 	}
 }
 
-func (s *Service) Token() (string, error) {
-	tokenURL := "https://testoauth.homebank.kz/epay2/oauth2/token"
+func WithTerminalID(id string) func(*Service) {
+	return func(s *Service) {
+		if id != "" {
+			s.terminalID = id
+		}
+	}
+}
+
+// WithEndpoints points the service at another ePay environment. Empty URLs
+// keep the defaults.
+func WithEndpoints(oauthURL, apiURL string) func(*Service) {
+	return func(s *Service) {
+		if oauthURL != "" {
+			s.oauthURL = oauthURL
+		}
+		if apiURL != "" {
+			s.apiURL = strings.TrimSuffix(apiURL, "/")
+		}
+	}
+}
+
+// WithPostLinks sets the URLs ePay notifies about the payment result.
+func WithPostLinks(success, failure string) func(*Service) {
+	return func(s *Service) {
+		s.postLink = success
+		s.failurePostLink = failure
+	}
+}
+
+// WithWebhookSecret enables webhooks. Every payment token carries a hash of
+// its invoice and amount keyed with the secret, ePay echoes it back in the
+// postLink request and ParseWebhook only accepts requests with the matching
+// hash.
+func WithWebhookSecret(secret string) func(*Service) {
+	return func(s *Service) {
+		s.webhookSecret = secret
+	}
+}
 
+func (s *Service) Name() string {
+	return "epay"
+}
+
+// Token requests an access token. Tokens for a payment are bound to its
+// invoice, amount and currency, pass an empty invoiceID for a general one.
+func (s *Service) Token(ctx context.Context, invoiceID string, amount money.Money) (string, error) {
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
-	data.Set("scope", "webapi usermanagement email_send verification statement statistics payment")
-	data.Set("client_id", ClientID)
-	data.Set("client_secret", ClientSecret)
+	data.Set("scope", scope)
+	data.Set("client_id", s.clientID)
+	data.Set("client_secret", s.clientSecret)
+
+	if invoiceID != "" {
+		data.Set("invoiceID", invoiceID)
+		data.Set("amount", amount.Decimal())
+		data.Set("currency", amount.Currency)
+		data.Set("terminal", s.terminalID)
+
+		if s.webhookSecret != "" {
+			data.Set("secret_hash", s.secretHash(invoiceID, amount))
+		}
+	}
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.oauthURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return "", err
 	}
@@ -91,10 +215,24 @@ func (s *Service) Token() (string, error) {
 	return token.AccessToken, nil
 }
 
-func (s *Service) encryptData(data string) (string, error) {
-	url := "https://testepay.homebank.kz/api/public.rsa"
+// Cryptogram encrypts card data with ePay's public key. Clients normally
+// build the cryptogram themselves, this is meant for test cards.
+func (s *Service) Cryptogram(ctx context.Context, card Card) (string, error) {
+	if card.TerminalID == "" {
+		card.TerminalID = s.terminalID
+	}
+
+	data, err := json.Marshal(card)
+	if err != nil {
+		return "", err
+	}
 
-	resp, err := s.client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/public.rsa", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -116,8 +254,12 @@ func (s *Service) encryptData(data string) (string, error) {
 		return "", err
 	}
 
-	// encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub.(*rsa.PublicKey), []byte(data), nil)
-	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, pub.(*rsa.PublicKey), []byte(data))
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return "", errors.New("public key is not an RSA key")
+	}
+
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, key, data)
 	if err != nil {
 		return "", err
 	}
@@ -125,63 +267,266 @@ func (s *Service) encryptData(data string) (string, error) {
 	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-func (s *Service) Pay(token string) (PaymentResponse, error) {
-	payURL := "https://testepay.homebank.kz/api/payment/cryptopay"
+// Authorize holds the charge amount on the card described by the cryptogram
+// in c.Source. The terminal has to be configured for two-step payments.
+func (s *Service) Authorize(ctx context.Context, c payment.Charge) (payment.Transaction, error) {
+	invoiceID := InvoiceID(c.PaymentID)
 
-	encryptedData, err := s.encryptData(DefaultPaymentData)
+	token, err := s.Token(ctx, invoiceID, c.Amount)
 	if err != nil {
-		return PaymentResponse{}, err
+		return payment.Transaction{}, err
 	}
 
-	requestData := map[string]interface{}{
-		"amount":          100,
-		"currency":        "KZT",
-		"name":            "JON JONSON",
-		"cryptogram":      encryptedData,
-		"invoiceId":       "000001",
-		"invoiceIdAlt":    "8564546",
-		"description":     "test payment",
-		"accountId":       "uuid000001",
-		"email":           "jj@example.com",
-		"phone":           "77777777777",
-		"cardSave":        true,
-		"data":            `{"statement":{"name":"Arman Ali","invoiceID":"80000016"}}`,
-		"postLink":        "https://testmerchant/order/1123",
-		"failurePostLink": "https://testmerchant/order/1123/fail",
+	statement, err := json.Marshal(map[string]any{
+		"statement": map[string]string{
+			"name":      c.Customer.Name,
+			"invoiceID": invoiceID,
+		},
+	})
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	requestData := map[string]any{
+		"amount":          c.Amount.Float(),
+		"currency":        c.Amount.Currency,
+		"name":            c.Customer.Name,
+		"cryptogram":      c.Source,
+		"invoiceId":       invoiceID,
+		"invoiceIdAlt":    c.PaymentID,
+		"description":     c.Description,
+		"accountId":       c.Customer.ID,
+		"email":           c.Customer.Email,
+		"phone":           c.Customer.Phone,
+		"cardSave":        false,
+		"data":            string(statement),
+		"postLink":        s.postLink,
+		"failurePostLink": s.failurePostLink,
 	}
 
 	reqBody, err := json.Marshal(requestData)
 	if err != nil {
-		return PaymentResponse{}, err
+		return payment.Transaction{}, err
+	}
+
+	p := PaymentResponse{}
+
+	if err := s.do(ctx, token, http.MethodPost, "/payment/cryptopay", bytes.NewReader(reqBody), &p); err != nil {
+		return payment.Transaction{}, err
+	}
+
+	tx := payment.Transaction{
+		ID:     p.ID,
+		Status: transactionStatus(p.Status),
+		Amount: c.Amount,
+	}
+
+	if tx.Status == payment.TransactionDeclined {
+		return tx, fmt.Errorf("%w: %s", payment.ErrDeclined, p.Message)
 	}
 
-	req, err := http.NewRequest("POST", payURL, bytes.NewBuffer(reqBody))
+	return tx, nil
+}
+
+func (s *Service) Capture(ctx context.Context, transactionID string, amount money.Money) (payment.Transaction, error) {
+	return s.operation(ctx, transactionID, "charge", &amount)
+}
+
+func (s *Service) Refund(ctx context.Context, transactionID string, amount money.Money) (payment.Transaction, error) {
+	return s.operation(ctx, transactionID, "refund", &amount)
+}
+
+func (s *Service) Void(ctx context.Context, transactionID string) (payment.Transaction, error) {
+	return s.operation(ctx, transactionID, "cancel", nil)
+}
+
+func (s *Service) Status(ctx context.Context, transactionID string) (payment.Transaction, error) {
+	token, err := s.Token(ctx, "", money.Money{})
 	if err != nil {
-		return PaymentResponse{}, err
+		return payment.Transaction{}, err
+	}
+
+	st := StatusResponse{}
+
+	path := "/check-status/payment/transaction/" + url.PathEscape(transactionID)
+
+	if err := s.do(ctx, token, http.MethodGet, path, nil, &st); err != nil {
+		return payment.Transaction{}, err
+	}
+
+	if st.Transaction.ID == "" {
+		return payment.Transaction{}, payment.ErrTransactionNotFound
+	}
+
+	tx := payment.Transaction{
+		ID:     st.Transaction.ID,
+		Status: transactionStatus(st.Transaction.StatusName),
+	}
+
+	for _, v := range []struct {
+		m      *money.Money
+		amount float64
+	}{
+		{&tx.Amount, st.Transaction.Amount},
+		{&tx.Captured, st.Transaction.ChargeAmount},
+		{&tx.Refunded, st.Transaction.RefundAmount},
+	} {
+		m, err := money.Parse(strconv.FormatFloat(v.amount, 'f', -1, 64), st.Transaction.Currency)
+		if err != nil {
+			return payment.Transaction{}, err
+		}
+
+		*v.m = m
+	}
+
+	return tx, nil
+}
+
+// operation runs a follow-up operation on an authorized transaction and
+// returns its state afterwards.
+func (s *Service) operation(ctx context.Context, transactionID, op string, amount *money.Money) (payment.Transaction, error) {
+	token, err := s.Token(ctx, "", money.Money{})
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	path := fmt.Sprintf("/operation/%s/%s", url.PathEscape(transactionID), op)
+	if amount != nil {
+		path += "?amount=" + amount.Decimal()
+	}
+
+	if err := s.do(ctx, token, http.MethodPost, path, nil, nil); err != nil {
+		return payment.Transaction{}, err
+	}
+
+	return s.Status(ctx, transactionID)
+}
+
+func (s *Service) do(ctx context.Context, token, method, path string, body io.Reader, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return PaymentResponse{}, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	data := json.RawMessage{}
-	json.NewDecoder(resp.Body).Decode(&data)
-	fmt.Println(string(data)) // error code 327 for some reason
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return PaymentResponse{}, errors.New("failed to pay, status code: " + resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return payment.ErrTransactionNotFound
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusPaymentRequired:
+		return fmt.Errorf("%w: %s %s: %s", payment.ErrDeclined, method, path, strings.TrimSpace(string(data)))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s %s failed, status code: %s", method, path, resp.Status)
 	}
 
-	payment := PaymentResponse{}
+	if v == nil || len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&payment)
+// Notification is the body of the postLink and failurePostLink requests.
+type Notification struct {
+	ID           string  `json:"id"`
+	DateTime     string  `json:"dateTime"`
+	InvoiceID    string  `json:"invoiceId"`
+	InvoiceIDAlt string  `json:"invoiceIdAlt"`
+	Amount       float64 `json:"amount"`
+	Currency     string  `json:"currency"`
+	Terminal     string  `json:"terminal"`
+	Code         string  `json:"code"`
+	Reason       string  `json:"reason"`
+	ReasonCode   int     `json:"reasonCode"`
+	SecretHash   string  `json:"secret_hash"`
+}
+
+// ParseWebhook checks the secret hash of a postLink request against its
+// invoice and amount. A successful payment is reported with code "ok" after
+// authorization, anything else is a decline. The code isn't known when the
+// hash is made, so it isn't covered and the outcome has to be confirmed with
+// Status before it is acted on.
+func (s *Service) ParseWebhook(header http.Header, body []byte) (payment.Notification, error) {
+	n := Notification{}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return payment.Notification{}, err
+	}
+
+	amount, err := money.Parse(strconv.FormatFloat(n.Amount, 'f', -1, 64), n.Currency)
 	if err != nil {
-		return PaymentResponse{}, err
+		return payment.Notification{}, payment.ErrInvalidSignature
+	}
+
+	if s.webhookSecret == "" || n.InvoiceID == "" ||
+		!hmac.Equal([]byte(n.SecretHash), []byte(s.secretHash(n.InvoiceID, amount))) {
+		return payment.Notification{}, payment.ErrInvalidSignature
+	}
+
+	status := payment.TransactionAuthorized
+	if n.Code != "ok" {
+		status = payment.TransactionDeclined
+	}
+
+	return payment.Notification{
+		Provider:      s.Name(),
+		TransactionID: n.ID,
+		PaymentID:     n.InvoiceIDAlt,
+		Status:        status,
+		Amount:        amount,
+		Reason:        n.Reason,
+	}, nil
+}
+
+func (s *Service) secretHash(invoiceID string, amount money.Money) string {
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(invoiceID + "|" + amount.Decimal() + "|" + amount.Currency))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// InvoiceID derives the numeric invoice number ePay requires from a payment
+// ID, so retries of the same payment reuse the invoice.
+func InvoiceID(paymentID string) string {
+	if len(paymentID) > 12 {
+		paymentID = paymentID[:12]
+	}
+
+	n, err := strconv.ParseUint(paymentID, 16, 64)
+	if err != nil {
+		n = 0
+		for _, c := range paymentID {
+			n = n*31 + uint64(c)
+		}
+		n %= 1e15
+	}
+
+	return fmt.Sprintf("%06d", n)
+}
+
+func transactionStatus(status string) string {
+	switch strings.ToUpper(status) {
+	case "AUTH", "NEW":
+		return payment.TransactionAuthorized
+	case "CHARGE":
+		return payment.TransactionCaptured
+	case "REFUND":
+		return payment.TransactionRefunded
+	case "CANCEL", "CANCEL_OLD":
+		return payment.TransactionVoided
 	}
 
-	return payment, nil
+	return payment.TransactionDeclined
 }
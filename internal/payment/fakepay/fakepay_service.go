@@ -0,0 +1,229 @@
+// Package fakepay is an in-memory payment provider for running the payment
+// flow locally and in tests without a real processor.
+package fakepay
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+)
+
+// Sources with special behaviour, any other source is authorized.
+const (
+	SourceDeclined      = "fake_declined"
+	SourceCaptureFailed = "fake_capture_failed"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the webhook body.
+const SignatureHeader = "X-Fakepay-Signature"
+
+type Service struct {
+	mu           sync.Mutex
+	transactions map[string]*transaction
+
+	webhookSecret string
+}
+
+type transaction struct {
+	payment.Transaction
+	source string
+}
+
+func NewService(configs ...func(*Service)) *Service {
+	s := &Service{
+		transactions: make(map[string]*transaction),
+	}
+
+	for _, cfg := range configs {
+		cfg(s)
+	}
+
+	return s
+}
+
+func WithWebhookSecret(secret string) func(*Service) {
+	return func(s *Service) {
+		s.webhookSecret = secret
+	}
+}
+
+func (s *Service) Name() string {
+	return "fake"
+}
+
+func (s *Service) Authorize(ctx context.Context, c payment.Charge) (payment.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &transaction{
+		Transaction: payment.Transaction{
+			ID:       store.GenerateID(),
+			Status:   payment.TransactionAuthorized,
+			Amount:   c.Amount,
+			Captured: money.New(0, c.Amount.Currency),
+			Refunded: money.New(0, c.Amount.Currency),
+		},
+		source: c.Source,
+	}
+
+	if c.Source == SourceDeclined {
+		tx.Status = payment.TransactionDeclined
+	}
+
+	s.transactions[tx.ID] = tx
+
+	if tx.Status == payment.TransactionDeclined {
+		return tx.Transaction, payment.ErrDeclined
+	}
+
+	return tx.Transaction, nil
+}
+
+func (s *Service) Capture(ctx context.Context, transactionID string, amount money.Money) (payment.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.get(transactionID)
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	if tx.Status == payment.TransactionCaptured {
+		return tx.Transaction, nil
+	}
+
+	if tx.Status != payment.TransactionAuthorized {
+		return tx.Transaction, payment.ErrTransactionState
+	}
+
+	if tx.source == SourceCaptureFailed {
+		return tx.Transaction, payment.ErrDeclined
+	}
+
+	if cmp, err := amount.Cmp(tx.Amount); err != nil || cmp > 0 {
+		return tx.Transaction, fmt.Errorf("%w: capture of %s exceeds %s", payment.ErrTransactionState, amount, tx.Amount)
+	}
+
+	tx.Captured = amount
+	tx.Status = payment.TransactionCaptured
+
+	return tx.Transaction, nil
+}
+
+func (s *Service) Refund(ctx context.Context, transactionID string, amount money.Money) (payment.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.get(transactionID)
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	if tx.Status != payment.TransactionCaptured && tx.Status != payment.TransactionRefunded {
+		return tx.Transaction, payment.ErrTransactionState
+	}
+
+	refunded, err := tx.Refunded.Add(amount)
+	if err != nil {
+		return tx.Transaction, err
+	}
+
+	if cmp, _ := refunded.Cmp(tx.Captured); cmp > 0 {
+		return tx.Transaction, fmt.Errorf("%w: refunds of %s exceed the captured %s", payment.ErrTransactionState, refunded, tx.Captured)
+	}
+
+	tx.Refunded = refunded
+	if cmp, _ := refunded.Cmp(tx.Captured); cmp == 0 {
+		tx.Status = payment.TransactionRefunded
+	}
+
+	return tx.Transaction, nil
+}
+
+func (s *Service) Void(ctx context.Context, transactionID string) (payment.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.get(transactionID)
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	switch tx.Status {
+	case payment.TransactionVoided:
+		return tx.Transaction, nil
+	case payment.TransactionAuthorized:
+		tx.Status = payment.TransactionVoided
+		return tx.Transaction, nil
+	}
+
+	return tx.Transaction, payment.ErrTransactionState
+}
+
+func (s *Service) Status(ctx context.Context, transactionID string) (payment.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.get(transactionID)
+	if err != nil {
+		return payment.Transaction{}, err
+	}
+
+	return tx.Transaction, nil
+}
+
+// Notification is the webhook body, sign it with Sign to simulate the
+// provider reporting an outcome.
+type Notification struct {
+	TransactionID string      `json:"transaction_id"`
+	PaymentID     string      `json:"payment_id"`
+	Status        string      `json:"status"`
+	Amount        money.Money `json:"amount"`
+	Reason        string      `json:"reason"`
+}
+
+// Sign returns the signature of a webhook body.
+func (s *Service) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) ParseWebhook(header http.Header, body []byte) (payment.Notification, error) {
+	if s.webhookSecret == "" || !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(s.Sign(body))) {
+		return payment.Notification{}, payment.ErrInvalidSignature
+	}
+
+	n := Notification{}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return payment.Notification{}, err
+	}
+
+	return payment.Notification{
+		Provider:      s.Name(),
+		TransactionID: n.TransactionID,
+		PaymentID:     n.PaymentID,
+		Status:        n.Status,
+		Amount:        n.Amount,
+		Reason:        n.Reason,
+	}, nil
+}
+
+func (s *Service) get(transactionID string) (*transaction, error) {
+	tx, ok := s.transactions[transactionID]
+	if !ok {
+		return nil, payment.ErrTransactionNotFound
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/order"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
+)
+
+const checkoutSaga = "checkout"
+
+// checkoutDefinition describes the checkout flow. Steps run in order and, if
+// one of them keeps failing, the completed ones are compensated in reverse.
+func (h *PaymentHandler) checkoutDefinition() saga.Definition {
+	return saga.Definition{
+		Name: checkoutSaga,
+		Steps: []saga.Step{
+			{Name: "create_payment", Action: h.createPayment, Compensate: h.failPayment},
+			{Name: "mark_order_awaiting_payment", Action: h.markOrderAwaitingPayment, Compensate: h.cancelOrder},
+			{Name: "commit_stock", Action: h.commitStock, Compensate: h.restoreStock},
+			{Name: "charge", Action: h.authorize, Compensate: h.releaseCharge},
+			{Name: "complete_order", Action: h.completeOrder},
+		},
+	}
+}
+
+// checkoutData is persisted with the saga. The source is a provider token or
+// cryptogram, never raw card data.
+func checkoutData(p payment.Payment, customer payment.Customer, source string) saga.Data {
+	return saga.Data{
+		"payment_id":     p.ID,
+		"user_id":        p.UserID,
+		"order_id":       p.OrderID,
+		"total_payment":  p.TotalPayment.Decimal(),
+		"currency":       p.TotalPayment.Currency,
+		"payment_date":   p.PaymentDate.String(),
+		"source":         source,
+		"customer_name":  customer.Name,
+		"customer_email": customer.Email,
+		"customer_phone": customer.Phone,
+	}
+}
+
+func (h *PaymentHandler) createPayment(ctx context.Context, data saga.Data) error {
+	if _, err := h.repo.Get(ctx, data["payment_id"]); err == nil {
+		return nil
+	} else if !errors.Is(err, payment.ErrNotFound) {
+		return err
+	}
+
+	total, err := money.Parse(data["total_payment"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	_, err = h.repo.Create(ctx, payment.Payment{
+		ID:           data["payment_id"],
+		UserID:       data["user_id"],
+		OrderID:      data["order_id"],
+		TotalPayment: total,
+		PaymentDate:  store.OnlyDate(data["payment_date"]),
+		Status:       payment.StatusPending,
+	})
+
+	// Another checkout of the order is running, retrying won't help and
+	// running on would charge twice
+	if errors.Is(err, payment.ErrInProgress) {
+		return saga.Permanent(err)
+	}
+
+	return err
+}
+
+func (h *PaymentHandler) failPayment(ctx context.Context, data saga.Data) error {
+	return h.setPaymentStatus(ctx, data["payment_id"], payment.StatusFailed)
+}
+
+func (h *PaymentHandler) markOrderAwaitingPayment(ctx context.Context, data saga.Data) error {
+	return h.setOrderStatus(ctx, data["order_id"], "awaiting_payment", "payment "+data["payment_id"]+" started")
+}
+
+func (h *PaymentHandler) cancelOrder(ctx context.Context, data saga.Data) error {
+	return h.setOrderStatus(ctx, data["order_id"], "cancelled", "payment "+data["payment_id"]+" failed")
+}
+
+// commitStock makes the reservation taken at order placement final.
+func (h *PaymentHandler) commitStock(ctx context.Context, data saga.Data) error {
+	reservation, err := h.productGRPCService.CommitReservation(ctx, &product.ReservationRequest{
+		OrderId: data["order_id"],
+	})
+	if err != nil {
+		return err
+	}
+
+	if !reservation.GetSuccess() {
+		return errors.New(reservation.GetMessage())
+	}
+
+	return nil
+}
+
+// restoreStock returns the committed reservation. The product service
+// marks it returned as it restocks, so a retried or resumed compensation
+// doesn't put the units back twice.
+func (h *PaymentHandler) restoreStock(ctx context.Context, data saga.Data) error {
+	reservation, err := h.productGRPCService.ReturnReservation(ctx, &product.ReservationRequest{
+		OrderId: data["order_id"],
+	})
+	if err != nil {
+		return err
+	}
+
+	if !reservation.GetSuccess() {
+		return errors.New(reservation.GetMessage())
+	}
+
+	return nil
+}
+
+// authorize puts a hold on the payment amount. The money is only taken by
+// completeOrder, so a checkout failing in between just releases the hold.
+func (h *PaymentHandler) authorize(ctx context.Context, data saga.Data) error {
+	if data["transaction_id"] != "" {
+		return nil
+	}
+
+	p, err := h.repo.Get(ctx, data["payment_id"])
+	if err != nil {
+		return err
+	}
+
+	// A webhook reported the hold of an earlier attempt that never returned
+	if p.TransactionID != "" {
+		data["transaction_id"] = p.TransactionID
+		return nil
+	}
+
+	total, err := money.Parse(data["total_payment"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.provider.Authorize(ctx, payment.Charge{
+		PaymentID: data["payment_id"],
+		OrderID:   data["order_id"],
+		Amount:    total,
+		Customer: payment.Customer{
+			ID:    data["user_id"],
+			Name:  data["customer_name"],
+			Email: data["customer_email"],
+			Phone: data["customer_phone"],
+		},
+		Source:      data["source"],
+		Description: "Order " + data["order_id"],
+	})
+	if errors.Is(err, payment.ErrDeclined) {
+		return saga.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	data["transaction_id"] = tx.ID
+
+	return h.updatePayment(ctx, data["payment_id"], func(p *payment.Payment) {
+		p.Provider = h.provider.Name()
+		p.TransactionID = tx.ID
+	})
+}
+
+// releaseCharge voids the hold, or refunds the money if it was captured
+// before a later step failed.
+func (h *PaymentHandler) releaseCharge(ctx context.Context, data saga.Data) error {
+	if data["transaction_id"] == "" {
+		return nil
+	}
+
+	if data["captured"] == "" {
+		_, err := h.provider.Void(ctx, data["transaction_id"])
+		return err
+	}
+
+	total, err := money.Parse(data["total_payment"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	_, err = h.provider.Refund(ctx, data["transaction_id"], total)
+
+	return err
+}
+
+func (h *PaymentHandler) capture(ctx context.Context, data saga.Data) error {
+	if data["captured"] != "" {
+		return nil
+	}
+
+	total, err := money.Parse(data["total_payment"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.provider.Capture(ctx, data["transaction_id"], total); err != nil {
+		return err
+	}
+
+	data["captured"] = "true"
+
+	return nil
+}
+
+func (h *PaymentHandler) completeOrder(ctx context.Context, data saga.Data) error {
+	if err := h.capture(ctx, data); err != nil {
+		return err
+	}
+
+	if err := h.setOrderStatus(ctx, data["order_id"], "paid", "payment "+data["payment_id"]+" succeeded"); err != nil {
+		return err
+	}
+
+	return h.setPaymentStatus(ctx, data["payment_id"], payment.StatusSuccess)
+}
+
+func (h *PaymentHandler) setOrderStatus(ctx context.Context, orderID, status, reason string) error {
+	resp, err := h.orderGRPCService.UpdateOrderStatus(ctx, &order.UpdateOrderStatusRequest{
+		OrderId: orderID,
+		Status:  status,
+		Actor:   "payment",
+		Reason:  reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.GetSuccess() {
+		return errors.New("failed to update order status to " + status)
+	}
+
+	return nil
+}
+
+func (h *PaymentHandler) setPaymentStatus(ctx context.Context, id, status string) error {
+	return h.updatePayment(ctx, id, func(p *payment.Payment) {
+		p.Status = status
+	})
+}
+
+func (h *PaymentHandler) updatePayment(ctx context.Context, id string, update func(*payment.Payment)) error {
+	p, err := h.repo.Get(ctx, id)
+	if errors.Is(err, payment.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	update(&p)
+
+	return h.repo.Update(ctx, id, p)
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/erazr/ecommerce-microservices/internal/payment/fakepay"
+)
+
+func TestCheckout(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		status      int
+		payment     string
+		transaction string
+		orders      []string
+		stock       int
+	}{
+		{"approved", "token", http.StatusOK, payment.StatusSuccess, payment.TransactionCaptured, []string{"awaiting_payment", "paid"}, 0},
+		{"declined", fakepay.SourceDeclined, http.StatusBadRequest, payment.StatusFailed, "", []string{"awaiting_payment", "cancelled"}, 1},
+		{"capture failed", fakepay.SourceCaptureFailed, http.StatusBadRequest, payment.StatusFailed, payment.TransactionVoided, []string{"awaiting_payment", "cancelled"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService()
+
+			rec := serve(t, s.router, newRequest(http.MethodPost, "/payments", "user1", authz.RoleClient, checkoutBody("order1", tt.source)))
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if len(s.payments.payments) != 1 {
+				t.Fatalf("got %d payments, want 1", len(s.payments.payments))
+			}
+
+			for _, p := range s.payments.payments {
+				if p.Status != tt.payment {
+					t.Errorf("got payment status %s, want %s", p.Status, tt.payment)
+				}
+
+				// A declined charge never makes it onto the payment
+				if tt.transaction == "" {
+					if p.TransactionID != "" {
+						t.Errorf("got transaction %s of a declined charge", p.TransactionID)
+					}
+					continue
+				}
+
+				if tx, err := s.provider.Status(context.Background(), p.TransactionID); err != nil {
+					t.Error(err)
+				} else if tx.Status != tt.transaction {
+					t.Errorf("got transaction status %s, want %s", tx.Status, tt.transaction)
+				}
+			}
+
+			if got := s.orders.statuses["order1"]; !reflect.DeepEqual(got, tt.orders) {
+				t.Errorf("got order statuses %v, want %v", got, tt.orders)
+			}
+
+			if !reflect.DeepEqual(s.products.committed, []string{"order1"}) {
+				t.Errorf("got committed reservations %v, want order1", s.products.committed)
+			}
+
+			// A failed checkout puts the committed stock back
+			for _, variantID := range []string{"variant1", "variant2"} {
+				if got := s.products.stock[variantID]; got != tt.stock {
+					t.Errorf("got stock %d of %s, want %d", got, variantID, tt.stock)
+				}
+			}
+		})
+	}
+}
+
+func TestRefund(t *testing.T) {
+	s := newTestService()
+
+	rec := serve(t, s.router, newRequest(http.MethodPost, "/payments", "user1", authz.RoleClient, checkoutBody("order1", "token")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("checkout: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	paymentID := rec.Body.String()
+
+	refunds := []struct {
+		body        string
+		amount      string
+		payment     string
+		transaction string
+		stock       map[string]int
+	}{
+		{`{"amount":{"amount":"20.00","currency":"KZT"},"reason":"damaged","items":[{"variant_id":"variant1","quantity":1}]}`, "20.00", payment.StatusPartiallyRefunded, payment.TransactionCaptured, map[string]int{"variant1": 1, "variant2": 0}},
+		// Without an amount the rest is refunded
+		{`{"items":[{"variant_id":"variant2","quantity":1}]}`, "30.00", payment.StatusRefunded, payment.TransactionRefunded, map[string]int{"variant1": 1, "variant2": 1}},
+	}
+
+	for _, r := range refunds {
+		rec := serve(t, s.router, newRequest(http.MethodPost, "/payments/"+paymentID+"/refunds", "admin1", authz.RoleAdmin, r.body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refund: got status %d: %s", rec.Code, rec.Body)
+		}
+
+		refund := payment.Refund{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &refund); err != nil {
+			t.Fatal(err)
+		}
+
+		if refund.Amount.Decimal() != r.amount || refund.Status != payment.RefundSucceeded {
+			t.Errorf("got refund of %s %s, want %s %s", refund.Amount.Decimal(), refund.Status, r.amount, payment.RefundSucceeded)
+		}
+
+		p := s.payments.payments[paymentID]
+		if p.Status != r.payment {
+			t.Errorf("got payment status %s, want %s", p.Status, r.payment)
+		}
+
+		tx, err := s.provider.Status(context.Background(), p.TransactionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tx.Status != r.transaction {
+			t.Errorf("got transaction status %s, want %s", tx.Status, r.transaction)
+		}
+
+		if !reflect.DeepEqual(s.products.stock, r.stock) {
+			t.Errorf("got stock %v, want %v", s.products.stock, r.stock)
+		}
+	}
+
+	rec = serve(t, s.router, newRequest(http.MethodPost, "/payments/"+paymentID+"/refunds", "admin1", authz.RoleAdmin, `{}`))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("refunding a refunded payment: got status %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+
+	if got := s.orders.statuses["order1"]; !reflect.DeepEqual(got, []string{"awaiting_payment", "paid", "partially_refunded", "refunded"}) {
+		t.Errorf("got order statuses %v", got)
+	}
+}
+
+func TestRefundDeclinedKeepsStock(t *testing.T) {
+	s := newTestService()
+
+	rec := serve(t, s.router, newRequest(http.MethodPost, "/payments", "user1", authz.RoleClient, checkoutBody("order1", "token")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("checkout: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	p := s.payments.payments[rec.Body.String()]
+
+	// Refunded at the provider behind our back, so it declines another refund
+	if _, err := s.provider.Refund(context.Background(), p.TransactionID, p.TotalPayment); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"amount":{"amount":"20.00","currency":"KZT"},"items":[{"variant_id":"variant1","quantity":1}]}`
+
+	rec = serve(t, s.router, newRequest(http.MethodPost, "/payments/"+p.ID+"/refunds", "admin1", authz.RoleAdmin, body))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	if s.products.stock["variant1"] != 0 {
+		t.Errorf("got stock %d of variant1 after a declined refund, want 0", s.products.stock["variant1"])
+	}
+
+	for _, refund := range s.refunds.refunds {
+		if refund.Status != payment.RefundFailed {
+			t.Errorf("got refund status %s, want %s", refund.Status, payment.RefundFailed)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	gatewaydocs "github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/docs"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+)
+
+// contractDocument merges the payment document into the gateway's, as the
+// gateway does for the paths it routes to the payment service.
+func contractDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+
+	doc, err := openapi.Parse(gatewaydocs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := openapi.Parse(docs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Merge("payment", service, isPaymentPath); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func isPaymentPath(path string) bool {
+	return strings.HasPrefix(path, "/payments")
+}
+
+func TestContract(t *testing.T) {
+	s := newTestService()
+
+	s.payments.payments["payment2"] = payment.Payment{
+		ID:           "payment2",
+		UserID:       "user1",
+		OrderID:      "order2",
+		TotalPayment: money.New(5000, "KZT"),
+		PaymentDate:  store.OnlyDate("2024-01-02"),
+		Status:       payment.StatusPending,
+	}
+
+	contract := openapi.NewContract(contractDocument(t), s.router)
+
+	const (
+		client = authz.RoleClient
+		admin  = authz.RoleAdmin
+	)
+
+	rec, err := contract.Do(newRequest(http.MethodPost, "/payments", "user1", client, checkoutBody("order1", "token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("checkout: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	paid := s.payments.payments[rec.Body.String()]
+
+	notification := func(status, amount string) string {
+		return `{"transaction_id":"` + paid.TransactionID + `","payment_id":"` + paid.ID + `","status":"` + status + `","amount":{"amount":"` + amount + `","currency":"KZT"}}`
+	}
+
+	updateBody := `{"user_id":"user1","order_id":"order1","total_payment":{"amount":"50.00","currency":"KZT"},"payment_date":"2024-01-02","status":"success"}`
+
+	reqs := []*http.Request{
+		newRequest(http.MethodGet, "/payments", "user1", client, ""),
+		newRequest(http.MethodGet, "/payments/search?status=success", "user1", client, ""),
+		newRequest(http.MethodGet, "/payments/"+paid.ID, "user1", client, ""),
+		s.webhookRequest(notification(payment.TransactionCaptured, "50.00")),
+		newRequest(http.MethodPost, "/payments/"+paid.ID+"/refunds", "admin1", admin, `{"amount":{"amount":"10.00","currency":"KZT"},"items":[{"variant_id":"variant1","quantity":1}]}`),
+		newRequest(http.MethodGet, "/payments/"+paid.ID+"/refunds", "user1", client, ""),
+		newRequest(http.MethodPut, "/payments/"+paid.ID, "admin1", admin, updateBody),
+		newRequest(http.MethodDelete, "/payments/payment2", "admin1", admin, ""),
+	}
+
+	for _, req := range reqs {
+		rec, err := contract.Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if rec.Code >= http.StatusBadRequest {
+			t.Errorf("%s %s: got status %d: %s", req.Method, req.URL.Path, rec.Code, rec.Body)
+		}
+	}
+
+	if unserved := contract.Unserved(isPaymentPath); len(unserved) > 0 {
+		t.Errorf("operations without a test: %v", unserved)
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+)
+
+type PaymentEventHandler struct {
+	orders payment.OrderRepository
+}
+
+func NewPaymentEventHandler(orders payment.OrderRepository) *PaymentEventHandler {
+	return &PaymentEventHandler{orders: orders}
+}
+
+func (h *PaymentEventHandler) Subscribe(s events.Subscriber) {
+	s.Subscribe(events.OrderPlaced, h.orderPlaced)
+}
+
+// orderPlaced records who owes what for the order, so paying for it doesn't
+// have to ask the order service.
+func (h *PaymentEventHandler) orderPlaced(ctx context.Context, e events.Event) error {
+	payload := events.OrderPlacedPayload{}
+	if err := e.Decode(&payload); err != nil {
+		return err
+	}
+
+	return h.orders.Save(ctx, payment.Order{
+		ID:     payload.OrderID,
+		UserID: payload.UserID,
+		Total:  payload.TotalPrice,
+	})
+}
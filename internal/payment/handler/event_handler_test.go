@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+func TestOrderPlacedRecordsOrder(t *testing.T) {
+	s := newTestService()
+
+	bus := events.NewInProcessBus()
+	NewPaymentEventHandler(s.recorded).Subscribe(bus)
+
+	// The order service doesn't know order4, only the event tells about it
+	e, err := events.New(events.OrderPlaced, "order4", events.OrderPlacedPayload{
+		OrderID:    "order4",
+		UserID:     "user2",
+		TotalPrice: money.New(5000, "KZT"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bus.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serve(t, s.router, newRequest(http.MethodPost, "/payments", "user1", authz.RoleClient, checkoutBody("order4", "token"))); rec.Code != http.StatusForbidden {
+		t.Errorf("paying for someone else's order: got status %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+
+	if rec := serve(t, s.router, newRequest(http.MethodPost, "/payments", "user2", authz.RoleClient, checkoutBody("order4", "token"))); rec.Code != http.StatusOK {
+		t.Errorf("paying for the order: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
@@ -0,0 +1,461 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/order"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/common/router"
+	"github.com/erazr/ecommerce-microservices/internal/common/server"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/erazr/ecommerce-microservices/internal/payment/fakepay"
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+const webhookSecret = "secret"
+
+// paymentRepository keeps payments in memory. Like the unique index on
+// pending payments, it refuses a second pending payment of an order.
+type paymentRepository struct {
+	payments map[string]payment.Payment
+}
+
+func (r *paymentRepository) Create(ctx context.Context, p payment.Payment) (string, error) {
+	for _, existing := range r.payments {
+		if existing.OrderID == p.OrderID && existing.Status == payment.StatusPending && p.Status == payment.StatusPending {
+			return "", payment.ErrInProgress
+		}
+	}
+
+	r.payments[p.ID] = p
+
+	return p.ID, nil
+}
+
+func (r *paymentRepository) Get(ctx context.Context, id string) (payment.Payment, error) {
+	p, ok := r.payments[id]
+	if !ok {
+		return payment.Payment{}, payment.ErrNotFound
+	}
+
+	return p, nil
+}
+
+func (r *paymentRepository) GetByTransaction(ctx context.Context, provider, transactionID string) (payment.Payment, error) {
+	for _, p := range r.payments {
+		if p.Provider == provider && p.TransactionID == transactionID {
+			return p, nil
+		}
+	}
+
+	return payment.Payment{}, payment.ErrNotFound
+}
+
+func (r *paymentRepository) Update(ctx context.Context, id string, p payment.Payment) error {
+	if _, ok := r.payments[id]; !ok {
+		return payment.ErrNotFound
+	}
+
+	r.payments[id] = p
+
+	return nil
+}
+
+func (r *paymentRepository) Delete(ctx context.Context, id string) error {
+	if _, ok := r.payments[id]; !ok {
+		return payment.ErrNotFound
+	}
+
+	delete(r.payments, id)
+
+	return nil
+}
+
+func (r *paymentRepository) page(keep func(payment.Payment) bool) store.Page[payment.Payment] {
+	page := store.Page[payment.Payment]{Items: []payment.Payment{}}
+
+	for _, p := range r.payments {
+		if keep(p) {
+			page.Items = append(page.Items, p)
+		}
+	}
+
+	page.Total = len(page.Items)
+
+	return page
+}
+
+func (r *paymentRepository) List(ctx context.Context, req store.PageRequest) (store.Page[payment.Payment], error) {
+	return r.page(func(payment.Payment) bool { return true }), nil
+}
+
+func (r *paymentRepository) ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[payment.Payment], error) {
+	return r.page(func(p payment.Payment) bool { return p.UserID == userID }), nil
+}
+
+func (r *paymentRepository) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[payment.Payment], error) {
+	return r.page(func(p payment.Payment) bool {
+		for _, f := range filters {
+			if f.Field == "user_id" && p.UserID != f.Values[0] {
+				return false
+			}
+		}
+
+		return true
+	}), nil
+}
+
+type refundRepository struct {
+	refunds  map[string]payment.Refund
+	payments *paymentRepository
+}
+
+func (r *refundRepository) Create(ctx context.Context, refund payment.Refund, purchased map[string]int) error {
+	p, err := r.payments.Get(ctx, refund.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	refunds, _ := r.ListByPayment(ctx, refund.PaymentID)
+
+	refunded, err := payment.Refunded(p.TotalPayment, append(refunds, refund))
+	if err != nil {
+		return err
+	}
+
+	if cmp, _ := refunded.Cmp(p.TotalPayment); cmp > 0 {
+		return payment.ErrRefundExceedsPayment
+	}
+
+	if err := payment.CheckRefundItems(refund, purchased, refunds); err != nil {
+		return err
+	}
+
+	r.refunds[refund.ID] = refund
+
+	return nil
+}
+
+func (r *refundRepository) Get(ctx context.Context, id string) (payment.Refund, error) {
+	refund, ok := r.refunds[id]
+	if !ok {
+		return payment.Refund{}, payment.ErrRefundNotFound
+	}
+
+	return refund, nil
+}
+
+func (r *refundRepository) ListByPayment(ctx context.Context, paymentID string) ([]payment.Refund, error) {
+	refunds := []payment.Refund{}
+	for _, refund := range r.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, refund)
+		}
+	}
+
+	return refunds, nil
+}
+
+func (r *refundRepository) SetStatus(ctx context.Context, id, status string) error {
+	refund, ok := r.refunds[id]
+	if !ok {
+		return payment.ErrRefundNotFound
+	}
+
+	refund.Status = status
+	r.refunds[id] = refund
+
+	return nil
+}
+
+type webhookRepository struct {
+	events  []payment.WebhookEvent
+	claimed map[string]bool
+}
+
+func (r *webhookRepository) Log(ctx context.Context, e payment.WebhookEvent) (int64, error) {
+	e.ID = int64(len(r.events) + 1)
+	r.events = append(r.events, e)
+
+	return e.ID, nil
+}
+
+func (r *webhookRepository) SetOutcome(ctx context.Context, id int64, outcome, errMessage string) error {
+	r.events[id-1].Outcome = outcome
+	r.events[id-1].Error = errMessage
+
+	return nil
+}
+
+func (r *webhookRepository) Claim(ctx context.Context, n payment.Notification) (bool, error) {
+	key := n.Provider + "/" + n.TransactionID + "/" + n.Status
+	if r.claimed[key] {
+		return false, nil
+	}
+
+	r.claimed[key] = true
+
+	return true, nil
+}
+
+func (r *webhookRepository) Unclaim(ctx context.Context, n payment.Notification) error {
+	delete(r.claimed, n.Provider+"/"+n.TransactionID+"/"+n.Status)
+
+	return nil
+}
+
+type orderRepository struct {
+	orders map[string]payment.Order
+}
+
+func (r *orderRepository) Save(ctx context.Context, o payment.Order) error {
+	if _, ok := r.orders[o.ID]; !ok {
+		r.orders[o.ID] = o
+	}
+
+	return nil
+}
+
+func (r *orderRepository) Get(ctx context.Context, id string) (payment.Order, error) {
+	o, ok := r.orders[id]
+	if !ok {
+		return payment.Order{}, payment.ErrOrderNotFound
+	}
+
+	return o, nil
+}
+
+// sagaRepository keeps sagas in memory, the orchestrator touches them from
+// another goroutine.
+type sagaRepository struct {
+	mu    sync.Mutex
+	sagas map[string]saga.State
+}
+
+func (r *sagaRepository) Create(ctx context.Context, s saga.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	r.sagas[s.ID] = s
+
+	return nil
+}
+
+func (r *sagaRepository) Update(ctx context.Context, s saga.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.UpdatedAt = time.Now()
+	r.sagas[s.ID] = s
+
+	return nil
+}
+
+func (r *sagaRepository) Claim(ctx context.Context, staleAfter time.Duration) (saga.State, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.sagas {
+		if (s.Status == saga.StatusRunning || s.Status == saga.StatusCompensating) && time.Since(s.UpdatedAt) >= staleAfter {
+			s.UpdatedAt = time.Now()
+			r.sagas[id] = s
+
+			return s, true, nil
+		}
+	}
+
+	return saga.State{}, false, nil
+}
+
+func (r *sagaRepository) Touch(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sagas[id]
+	s.UpdatedAt = time.Now()
+	r.sagas[id] = s
+
+	return nil
+}
+
+// ordersClient serves the orders of the tests, each order holds one unit
+// of the variants listed for it.
+type ordersClient struct {
+	order.OrdersClient
+
+	owners   map[string]string
+	totals   map[string]money.Money
+	variants map[string][]string
+	statuses map[string][]string
+}
+
+func (c *ordersClient) GetOrderOwner(ctx context.Context, in *order.GetOrderOwnerRequest, opts ...grpc.CallOption) (*order.GetOrderOwnerResponse, error) {
+	return &order.GetOrderOwnerResponse{
+		UserId:     c.owners[in.GetOrderId()],
+		TotalPrice: c.totals[in.GetOrderId()].Proto(),
+	}, nil
+}
+
+func (c *ordersClient) GetOrderVariantIDs(ctx context.Context, in *order.GetOrderVariantIDsRequest, opts ...grpc.CallOption) (*order.GetOrderVariantIDsResponse, error) {
+	return &order.GetOrderVariantIDsResponse{VariantIds: c.variants[in.GetOrderId()]}, nil
+}
+
+func (c *ordersClient) UpdateOrderStatus(ctx context.Context, in *order.UpdateOrderStatusRequest, opts ...grpc.CallOption) (*order.UpdateOrderStatusResponse, error) {
+	c.statuses[in.GetOrderId()] = append(c.statuses[in.GetOrderId()], in.GetStatus())
+
+	return &order.UpdateOrderStatusResponse{Success: true}, nil
+}
+
+// productsClient keeps the stock of variants and the variants reserved
+// for each order.
+type productsClient struct {
+	product.ProductsClient
+
+	stock     map[string]int
+	reserved  map[string][]string
+	committed []string
+	returned  []string
+
+	stockReturns map[string]bool
+}
+
+func (c *productsClient) CommitReservation(ctx context.Context, in *product.ReservationRequest, opts ...grpc.CallOption) (*product.ReservationResponse, error) {
+	c.committed = append(c.committed, in.GetOrderId())
+
+	return &product.ReservationResponse{Success: true}, nil
+}
+
+// ReturnReservation restocks the reserved variants once per order, like the
+// product service does.
+func (c *productsClient) ReturnReservation(ctx context.Context, in *product.ReservationRequest, opts ...grpc.CallOption) (*product.ReservationResponse, error) {
+	c.returned = append(c.returned, in.GetOrderId())
+
+	for _, variantID := range c.reserved[in.GetOrderId()] {
+		c.stock[variantID]++
+	}
+	delete(c.reserved, in.GetOrderId())
+
+	return &product.ReservationResponse{Success: true}, nil
+}
+
+// ReturnStock restocks the items once per return id, like the product
+// service does.
+func (c *productsClient) ReturnStock(ctx context.Context, in *product.ReturnStockRequest, opts ...grpc.CallOption) (*product.ReturnStockResponse, error) {
+	if !c.stockReturns[in.GetReturnId()] {
+		c.stockReturns[in.GetReturnId()] = true
+
+		for _, item := range in.GetItems() {
+			c.stock[item.GetVariantId()] += int(item.GetQuantity())
+		}
+	}
+
+	return &product.ReturnStockResponse{Success: true}, nil
+}
+
+// testService is the payment service wired to in-memory fakes and fakepay.
+type testService struct {
+	router   chi.Router
+	provider *fakepay.Service
+	payments *paymentRepository
+	refunds  *refundRepository
+	webhooks *webhookRepository
+	recorded *orderRepository
+	orders   *ordersClient
+	products *productsClient
+}
+
+// newTestService serves the orders order1 and order2 of user1 and order3 of
+// user2, each with one unit of variant1 and one of variant2 at 50.00 KZT
+// together.
+func newTestService() *testService {
+	payments := &paymentRepository{payments: make(map[string]payment.Payment)}
+
+	s := &testService{
+		provider: fakepay.NewService(fakepay.WithWebhookSecret(webhookSecret)),
+		payments: payments,
+		refunds:  &refundRepository{refunds: make(map[string]payment.Refund), payments: payments},
+		webhooks: &webhookRepository{claimed: make(map[string]bool)},
+		recorded: &orderRepository{orders: make(map[string]payment.Order)},
+		orders: &ordersClient{
+			owners:   map[string]string{"order1": "user1", "order2": "user1", "order3": "user2"},
+			totals:   make(map[string]money.Money),
+			variants: make(map[string][]string),
+			statuses: make(map[string][]string),
+		},
+		products: &productsClient{stock: map[string]int{"variant1": 0, "variant2": 0}, reserved: make(map[string][]string), stockReturns: make(map[string]bool)},
+	}
+
+	for id := range s.orders.owners {
+		s.orders.totals[id] = money.New(5000, "KZT")
+		s.orders.variants[id] = []string{"variant1", "variant2"}
+		s.products.reserved[id] = []string{"variant1", "variant2"}
+	}
+
+	orchestrator := saga.NewOrchestrator(&sagaRepository{sagas: make(map[string]saga.State)}, saga.WithRetries(1, 0))
+
+	h := NewPaymentHandler(s.payments, s.provider,
+		WithWebhookRepository(s.webhooks),
+		WithRefundRepository(s.refunds),
+		WithOrderRepository(s.recorded),
+		WithOrderGRPCService(s.orders),
+		WithProductGRPCService(s.products),
+		WithSagaOrchestrator(orchestrator),
+	)
+
+	r := router.New()
+	r.Use(authz.Identify)
+	r.Use(server.Idempotency(store.NewInMemoryIdempotencyCache[server.StoredResponse](time.Hour)))
+	r.Mount("/payments", h.Routes())
+
+	s.router = r
+
+	return s
+}
+
+func newRequest(method, target, userID, role, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if userID != "" {
+		req.Header.Set(auth.UserIDHeader, userID)
+		req.Header.Set(auth.UserRoleHeader, role)
+	}
+
+	return req
+}
+
+// webhookRequest is a fakepay notification signed with the test secret.
+func (s *testService) webhookRequest(body string) *http.Request {
+	req := newRequest(http.MethodPost, "/payments/webhooks/fake", "", "", body)
+	req.Header.Set(fakepay.SignatureHeader, s.provider.Sign([]byte(body)))
+
+	return req
+}
+
+// checkoutBody pays for an order with the source, at 50.00 KZT.
+func checkoutBody(orderID, source string) string {
+	return `{"order_id":"` + orderID + `","total_payment":{"amount":"50.00","currency":"KZT"},"payment_date":"2024-01-02","status":"pending","source":"` + source + `"}`
+}
+
+func serve(t *testing.T, h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
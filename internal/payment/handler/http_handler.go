@@ -5,45 +5,73 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/order"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
-	"github.com/erazr/ecommerce-microservices/internal/payment/epay"
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type PaymentHandler struct {
 	repo payment.Repository
 
-	ePayService epay.Service
+	provider payment.Provider
 
-	idempotencyCache store.Cache[payment.Payment]
+	webhooks payment.WebhookRepository
+
+	refunds payment.RefundRepository
+
+	orders payment.OrderRepository
 
 	orderGRPCService   order.OrdersClient
 	productGRPCService product.ProductsClient
+
+	saga *saga.Orchestrator
 }
 
-func NewPaymentHandler(repo payment.Repository, ePayService epay.Service, configs ...func(*PaymentHandler)) *PaymentHandler {
+func NewPaymentHandler(repo payment.Repository, provider payment.Provider, configs ...func(*PaymentHandler)) *PaymentHandler {
 	h := &PaymentHandler{
-		repo:        repo,
-		ePayService: ePayService,
+		repo:     repo,
+		provider: provider,
 	}
 
 	for _, config := range configs {
 		config(h)
 	}
 
+	if h.saga != nil {
+		h.saga.Register(h.checkoutDefinition())
+		h.saga.Register(h.refundDefinition())
+	}
+
 	return h
 }
 
-func WithIdempotencyCache(c store.Cache[payment.Payment]) func(*PaymentHandler) {
+func WithWebhookRepository(r payment.WebhookRepository) func(*PaymentHandler) {
+	return func(h *PaymentHandler) {
+		h.webhooks = r
+	}
+}
+
+func WithRefundRepository(r payment.RefundRepository) func(*PaymentHandler) {
 	return func(h *PaymentHandler) {
-		h.idempotencyCache = c
+		h.refunds = r
+	}
+}
+
+// WithOrderRepository lets checkouts find the orders recorded from events
+// before asking the order service.
+func WithOrderRepository(r payment.OrderRepository) func(*PaymentHandler) {
+	return func(h *PaymentHandler) {
+		h.orders = r
 	}
 }
 
@@ -59,31 +87,103 @@ func WithProductGRPCService(s product.ProductsClient) func(*PaymentHandler) {
 	}
 }
 
+func WithSagaOrchestrator(o *saga.Orchestrator) func(*PaymentHandler) {
+	return func(h *PaymentHandler) {
+		h.saga = o
+	}
+}
+
 func (h *PaymentHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", h.ListPayment)
-	r.Post("/", h.MakePayment)
+	admin := authz.Require(authz.Admin)
+	owner := authz.Require(authz.Owner(h.paymentOwner))
+
+	authenticated := authz.Require(authz.Authenticated)
+
+	r.With(authenticated).Get("/", h.ListPayment)
+	r.With(authenticated).Post("/", h.MakePayment)
+
+	// Providers sign their webhooks instead of authenticating
+	r.Post("/webhooks/{provider}", h.Webhook)
 
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", h.GetPayment)
-		r.Put("/", h.UpdatePayment)
-		r.Delete("/", h.DeletePayment)
+		r.With(owner).Get("/", h.GetPayment)
+		r.With(admin).Put("/", h.UpdatePayment)
+		r.With(admin).Delete("/", h.DeletePayment)
+		r.With(owner).Get("/refunds", h.ListRefunds)
+		r.With(admin).Post("/refunds", h.RefundPayment)
 	})
 
-	r.Get("/search", h.SearchPayment)
+	r.With(authenticated).Get("/search", h.SearchPayment)
 
 	return r
 }
 
+// paymentOwner returns the user who made the requested payment.
+func (h *PaymentHandler) paymentOwner(r *http.Request) (string, error) {
+	p, err := h.repo.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, payment.ErrNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return p.UserID, nil
+}
+
+// orderTotal makes sure the order exists and belongs to the user paying for
+// it, and returns what the order costs.
+func (h *PaymentHandler) orderTotal(ctx context.Context, orderID, userID string) (money.Money, error) {
+	o, err := h.order(ctx, orderID)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	if o.UserID != userID {
+		return money.Money{}, payment.ErrForeignOrder
+	}
+
+	return o.Total, nil
+}
+
+// order returns the recorded order, or asks the order service about orders
+// whose OrderPlaced event hasn't arrived yet.
+func (h *PaymentHandler) order(ctx context.Context, id string) (payment.Order, error) {
+	if h.orders != nil {
+		o, err := h.orders.Get(ctx, id)
+		if !errors.Is(err, payment.ErrOrderNotFound) {
+			return o, err
+		}
+	}
+
+	resp, err := h.orderGRPCService.GetOrderOwner(ctx, &order.GetOrderOwnerRequest{
+		OrderId: id,
+	})
+	if err != nil {
+		return payment.Order{}, err
+	}
+
+	return payment.Order{
+		ID:     id,
+		UserID: resp.UserId,
+		Total:  money.FromProto(resp.TotalPrice),
+	}, nil
+}
+
 // @Summary		Make payment
-// @Description	make a payment
+// @Description	make a payment for an order, total_payment must be the order total
 // @Tags			payments
 // @Accept			json
 // @Produce		json
-// @Param			body	body					request	true	"request"
-// @Success		200		epay.PaymentResponse	"payment response"
-// @Failure		400		{array}					response.ErrorResponse
+// @Param			body			body		request	true	"request"
+// @Param			Idempotency-Key	header		string	false	"replays the response of an earlier request with the same key"
+// @Success		200		{string}	string	"payment id"
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		403		{string}	string
+// @Failure		409		{string}	string
 // @Failure		500
 // @Router			/payments [post]
 func (h *PaymentHandler) MakePayment(w http.ResponseWriter, r *http.Request) {
@@ -93,56 +193,93 @@ func (h *PaymentHandler) MakePayment(w http.ResponseWriter, r *http.Request) {
 			Message: err.Error(),
 			Field:   "body",
 		}})
+		return
 	}
 
-	if errs := req.Validate(); errs != nil {
+	// Payments are made by the caller, only admins pay for someone else
+	userID, err := authz.FromContext(r.Context()).OnBehalfOf(req.UserID)
+	if err != nil {
+		response.Forbidden(w, r, err)
+		return
+	}
+
+	req.UserID = userID
+
+	errs := req.Validate()
+	if req.Source == "" {
+		errs = append(errs, response.ErrorResponse{
+			Message: "empty source",
+			Field:   "source",
+		})
+	}
+
+	if errs != nil {
 		response.BadRequest(w, r, errs)
 		return
 	}
 
-	if val, has := h.idempotencyCache.Get(req.OrderID); has {
-		render.PlainText(w, r, val.ID)
+	total, err := h.orderTotal(r.Context(), req.OrderID, req.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, payment.ErrForeignOrder):
+			response.Forbidden(w, r, err)
+		case status.Code(err) == codes.NotFound:
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: status.Convert(err).Message(),
+				Field:   "order_id",
+			}})
+		default:
+			response.InternalServerError(w, r, err)
+		}
 		return
 	}
 
-	payment := payment.Payment{
+	// The client states what it expects to pay, the order decides what
+	// is charged
+	if cmp, err := req.TotalPayment.Cmp(total); err != nil || cmp != 0 {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: "total_payment must equal the order total of " + total.String(),
+			Field:   "total_payment",
+		}})
+		return
+	}
+
+	p := payment.Payment{
 		ID:           store.GenerateID(),
 		UserID:       req.UserID,
 		OrderID:      req.OrderID,
-		TotalPayment: req.TotalPayment,
+		TotalPayment: total,
 		PaymentDate:  store.OnlyDate(req.PaymentDate),
-		Status:       req.Status,
+		Status:       payment.StatusPending,
 	}
 
-	token, err := h.ePayService.Token()
-	if err != nil {
-		response.InternalServerError(w, r, err)
-		return
-	}
+	customer := req.Customer
+	customer.ID = req.UserID
 
-	id, err := h.repo.Create(r.Context(), payment)
+	state, err := h.saga.Execute(r.Context(), checkoutSaga, p.ID, checkoutData(p, customer, req.Source))
 	if err != nil {
-		response.InternalServerError(w, r, err)
-		return
-	}
+		if errors.Is(err, payment.ErrDeclined) {
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: state.Error,
+				Field:   "source",
+			}})
+			return
+		}
 
-	h.idempotencyCache.Set(req.OrderID, payment)
+		if errors.Is(err, payment.ErrInProgress) {
+			response.Conflict(w, r, err)
+			return
+		}
 
-	time.Sleep(150 * time.Millisecond)
-	_, err = h.orderGRPCService.UpdateOrderStatus(r.Context(), &order.UpdateOrderStatusRequest{
-		OrderId: payment.OrderID,
-		Status:  "pending",
-	})
-	if err != nil {
 		response.InternalServerError(w, r, err)
 		return
 	}
 
-	h.simulateOrderProccess(w, r, payment)
+	p.Status = payment.StatusSuccess
+	p.Provider = h.provider.Name()
+	p.TransactionID = state.Data["transaction_id"]
 
-	h.ePayService.Pay(token)
-
-	render.PlainText(w, r, id)
+	render.PlainText(w, r, p.ID)
 }
 
 // @Summary		Get payment
@@ -152,6 +289,7 @@ func (h *PaymentHandler) MakePayment(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Param			id	path		string	true	"payment id"
 // @Success		200	{object}	payment.Payment
+// @Failure		403	{string}	string
 // @Failure		404	{string}	string
 // @Failure		500
 // @Router			/payments/{id} [get]
@@ -201,14 +339,23 @@ func (h *PaymentHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p := payment.Payment{
-		UserID:       req.UserID,
-		OrderID:      req.OrderID,
-		TotalPayment: req.TotalPayment,
-		PaymentDate:  store.OnlyDate(req.PaymentDate),
-		Status:       req.Status,
+	p, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, payment.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
 	}
 
+	p.UserID = req.UserID
+	p.OrderID = req.OrderID
+	p.TotalPayment = req.TotalPayment
+	p.PaymentDate = store.OnlyDate(req.PaymentDate)
+	p.Status = req.Status
+
 	if err := h.repo.Update(r.Context(), id, p); err != nil {
 		if errors.Is(err, payment.ErrNotFound) {
 			response.NotFound(w, r, err)
@@ -247,130 +394,98 @@ func (h *PaymentHandler) DeletePayment(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary		List payment
-// @Description	list all payments
+// @Description	list the caller's payments, or all payments for admins, a page at a time
 // @Tags			payments
 // @Accept			json
 // @Produce		json
-// @Success		200	{array}	payment.Payment
+// @Param			limit		query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort		query		string	false	"Sort field: payment_date (default), total_payment or status"
+// @Param			order		query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor		query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[payment.Payment]
+// @Failure		400		{array}		response.ErrorResponse
 // @Failure		500
 // @Router			/payments [get]
 func (h *PaymentHandler) ListPayment(w http.ResponseWriter, r *http.Request) {
-	payments, err := h.repo.List(r.Context())
+	req, err := store.PageRequestFromQuery(r.URL.Query())
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	response.OK(w, r, payments)
+	var payments store.Page[payment.Payment]
+
+	if p := authz.FromContext(r.Context()); p.IsAdmin() {
+		payments, err = h.repo.List(r.Context(), req)
+	} else {
+		payments, err = h.repo.ListByUser(r.Context(), p.UserID, req)
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	response.Paginated(w, r, payments.Items, payments.Next, payments.Prev, payments.Total)
 }
 
 // @Summary		Search payments
-// @Description	Search payments by user, order, or status
+// @Description	Search the caller's payments, or all payments for admins, with field=value, field[in]=a,b or field[range]=low,high filters combined with AND. Fields: user_id, order_id, status, provider, transaction_id, currency, total_payment, payment_date
 // @Tags			payments
 // @Accept			json
 // @Produce		json
-// @Param			user	path		string	false	"user id"
-// @Param			order	path		string	false	"order id"
-// @Param			status	path		string	false	"status"
-// @Success		200		{array}		payment.Payment
-// @Failure		404		{string}	string
+// @Param			user_id		query		string	false	"user id"
+// @Param			order_id	query		string	false	"order id"
+// @Param			status		query		string	false	"status"
+// @Param			limit		query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort		query		string	false	"Sort field: payment_date (default), total_payment or status"
+// @Param			order		query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor		query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[payment.Payment]
 // @Failure		400		{array}		response.ErrorResponse
 // @Failure		500
 // @Router			/payments/search [get]
 func (h *PaymentHandler) SearchPayment(w http.ResponseWriter, r *http.Request) {
-	user := chi.URLParam(r, "user")
-	order := chi.URLParam(r, "order")
-	status := chi.URLParam(r, "status")
+	query := r.URL.Query()
 
-	if user == "" && order == "" && status == "" {
-		response.BadRequest(w, r, []response.ErrorResponse{{
-			Message: "empty query",
-			Field:   "query",
-		}})
+	req, err := store.PageRequestFromQuery(query)
+	if err != nil {
+		queryError(w, r, err)
 		return
 	}
 
-	if user != "" {
-		payments, err := h.repo.Search(r.Context(), "user_id", user)
-		if err != nil {
-			if errors.Is(err, payment.ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
-
-			response.InternalServerError(w, r, err)
-			return
-		}
-		response.OK(w, r, payments)
+	filters, err := store.FiltersFromQuery(query, store.PageParams...)
+	if err == nil && len(filters) == 0 {
+		err = &store.FilterError{Field: "query", Message: "empty query"}
 	}
-	if order != "" {
-		payments, err := h.repo.Search(r.Context(), "order_id", order)
-		if err != nil {
-			if errors.Is(err, payment.ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
-
-			response.InternalServerError(w, r, err)
-			return
-		}
-		response.OK(w, r, payments)
-	}
-	if status != "" {
-		payments, err := h.repo.Search(r.Context(), "status", status)
-		if err != nil {
-			if errors.Is(err, payment.ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
-
-			response.InternalServerError(w, r, err)
-			return
-		}
-		response.OK(w, r, payments)
-	}
-
-}
-
-func (h *PaymentHandler) simulateOrderProccess(w http.ResponseWriter, r *http.Request, payment payment.Payment) {
-	resp, err := h.orderGRPCService.GetOrderProductIDs(r.Context(), &order.GetOrderProductIDsRequest{
-		OrderId: payment.OrderID,
-	})
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	updates := []*product.UpdateProduct{}
-
-	mapProductIDs := make(map[string]int)
-
-	for _, productID := range resp.ProductIds {
-		mapProductIDs[productID]++
+	if p := authz.FromContext(r.Context()); !p.IsAdmin() {
+		filters = append(filters, store.Filter{Field: "user_id", Op: store.Eq, Values: []string{p.UserID}})
 	}
 
-	for productID, amount := range mapProductIDs {
-		updates = append(updates, &product.UpdateProduct{
-			ProductId:  productID,
-			Quantity:   int32(amount),
-			UpdateType: product.UpdateType_DECREMENT,
-		})
-	}
-
-	_, err = h.productGRPCService.UpdateProductStock(r.Context(), &product.UpdateProductStockRequest{
-		Updates: updates,
-	})
+	payments, err := h.repo.Search(r.Context(), filters, req)
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	time.Sleep(150 * time.Millisecond)
-	_, err = h.orderGRPCService.UpdateOrderStatus(context.Background(), &order.UpdateOrderStatusRequest{
-		OrderId: payment.OrderID,
-		Status:  "completed",
-	})
-	if err != nil {
+	response.Paginated(w, r, payments.Items, payments.Next, payments.Prev, payments.Total)
+}
+
+// queryError answers filters and page requests the repository doesn't take
+// with 400.
+func queryError(w http.ResponseWriter, r *http.Request, err error) {
+	var filterErr *store.FilterError
+	if errors.As(err, &filterErr) {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: filterErr.Message,
+			Field:   filterErr.Field,
+		}})
 		return
 	}
+
+	response.InternalServerError(w, r, err)
 }
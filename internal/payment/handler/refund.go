@@ -0,0 +1,430 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/order"
+	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
+	"github.com/go-chi/chi/v5"
+)
+
+const refundSaga = "refund"
+
+// refundDefinition returns money from a captured payment and puts the
+// returned items back into stock. Once the money is refunded there is no
+// going back, so the steps after it are retried until they succeed instead
+// of being compensated.
+func (h *PaymentHandler) refundDefinition() saga.Definition {
+	return saga.Definition{
+		Name: refundSaga,
+		Steps: []saga.Step{
+			{Name: "create_refund", Action: h.createRefund, Compensate: h.failRefund},
+			{Name: "refund_payment", Action: h.refundPayment},
+			{Name: "restock", Action: h.restockRefundItems, Retriable: true},
+			{Name: "complete_refund", Action: h.completeRefund, Retriable: true},
+		},
+	}
+}
+
+func refundData(p payment.Payment, r payment.Refund, purchased map[string]int) (saga.Data, error) {
+	items, err := json.Marshal(r.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	purchasedItems, err := json.Marshal(purchased)
+	if err != nil {
+		return nil, err
+	}
+
+	return saga.Data{
+		"refund_id":      r.ID,
+		"payment_id":     p.ID,
+		"order_id":       p.OrderID,
+		"transaction_id": p.TransactionID,
+		"amount":         r.Amount.Decimal(),
+		"currency":       r.Amount.Currency,
+		"reason":         r.Reason,
+		"items":          string(items),
+		"purchased":      string(purchasedItems),
+	}, nil
+}
+
+func refundItems(data saga.Data) (map[string]int, error) {
+	items := []payment.RefundItem{}
+	if err := json.Unmarshal([]byte(data["items"]), &items); err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[string]int, len(items))
+	for _, item := range items {
+		quantities[item.VariantID] += item.Quantity
+	}
+
+	return quantities, nil
+}
+
+// createRefund stores the refund as pending. It is the step that guards
+// against refunding more than was paid or bought.
+func (h *PaymentHandler) createRefund(ctx context.Context, data saga.Data) error {
+	if _, err := h.refunds.Get(ctx, data["refund_id"]); err == nil {
+		return nil
+	} else if !errors.Is(err, payment.ErrRefundNotFound) {
+		return err
+	}
+
+	amount, err := money.Parse(data["amount"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	items := []payment.RefundItem{}
+	if err := json.Unmarshal([]byte(data["items"]), &items); err != nil {
+		return err
+	}
+
+	purchased := map[string]int{}
+	if err := json.Unmarshal([]byte(data["purchased"]), &purchased); err != nil {
+		return err
+	}
+
+	err = h.refunds.Create(ctx, payment.Refund{
+		ID:        data["refund_id"],
+		PaymentID: data["payment_id"],
+		Amount:    amount,
+		Reason:    data["reason"],
+		Status:    payment.RefundPending,
+		CreatedAt: time.Now().UTC(),
+		Items:     items,
+	}, purchased)
+	if errors.Is(err, payment.ErrRefundExceedsPayment) || errors.Is(err, payment.ErrRefundExceedsItems) {
+		return saga.Permanent(err)
+	}
+
+	return err
+}
+
+func (h *PaymentHandler) failRefund(ctx context.Context, data saga.Data) error {
+	err := h.refunds.SetStatus(ctx, data["refund_id"], payment.RefundFailed)
+	if errors.Is(err, payment.ErrRefundNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// restockRefundItems returns the refunded items under the refund id, so the
+// product service puts them back once however often the step runs.
+func (h *PaymentHandler) restockRefundItems(ctx context.Context, data saga.Data) error {
+	quantities, err := refundItems(data)
+	if err != nil {
+		return err
+	}
+
+	if len(quantities) == 0 {
+		return nil
+	}
+
+	items := make([]*product.ReserveProduct, 0, len(quantities))
+	for variantID, quantity := range quantities {
+		items = append(items, &product.ReserveProduct{VariantId: variantID, Quantity: int32(quantity)})
+	}
+
+	resp, err := h.productGRPCService.ReturnStock(ctx, &product.ReturnStockRequest{
+		ReturnId: data["refund_id"],
+		Items:    items,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Retrying won't bring back a deleted variant, the money is returned
+	// regardless
+	if !resp.GetSuccess() {
+		fmt.Printf("Restocking refund %s failed: %s\n", data["refund_id"], resp.GetMessage())
+	}
+
+	return nil
+}
+
+func (h *PaymentHandler) refundPayment(ctx context.Context, data saga.Data) error {
+	if data["refunded"] != "" {
+		return nil
+	}
+
+	amount, err := money.Parse(data["amount"], data["currency"])
+	if err != nil {
+		return err
+	}
+
+	_, err = h.provider.Refund(ctx, data["transaction_id"], amount)
+	if errors.Is(err, payment.ErrDeclined) || errors.Is(err, payment.ErrTransactionState) {
+		return saga.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	data["refunded"] = "true"
+
+	return nil
+}
+
+// completeRefund marks the payment and the order refunded once refunds
+// cover the whole payment, and partially refunded until then.
+func (h *PaymentHandler) completeRefund(ctx context.Context, data saga.Data) error {
+	if err := h.refunds.SetStatus(ctx, data["refund_id"], payment.RefundSucceeded); err != nil {
+		return err
+	}
+
+	p, err := h.repo.Get(ctx, data["payment_id"])
+	if err != nil {
+		return err
+	}
+
+	refunds, err := h.refunds.ListByPayment(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+
+	refunded := money.New(0, p.TotalPayment.Currency)
+	for _, r := range refunds {
+		if r.Status != payment.RefundSucceeded {
+			continue
+		}
+
+		if refunded, err = refunded.Add(r.Amount); err != nil {
+			return err
+		}
+	}
+
+	status := payment.StatusPartiallyRefunded
+	if cmp, _ := refunded.Cmp(p.TotalPayment); cmp >= 0 {
+		status = payment.StatusRefunded
+	}
+
+	if err := h.setOrderStatus(ctx, data["order_id"], status, "refund "+data["refund_id"]+" of payment "+p.ID); err != nil {
+		return err
+	}
+
+	if p.Status == status {
+		return nil
+	}
+
+	p.Status = status
+
+	return h.repo.Update(ctx, p.ID, p)
+}
+
+// purchasedItems returns how many units of each variant the order holds.
+func (h *PaymentHandler) purchasedItems(ctx context.Context, orderID string) (map[string]int, error) {
+	resp, err := h.orderGRPCService.GetOrderVariantIDs(ctx, &order.GetOrderVariantIDsRequest{
+		OrderId: orderID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[string]int)
+	for _, variantID := range resp.VariantIds {
+		quantities[variantID]++
+	}
+
+	return quantities, nil
+}
+
+// @Summary		Refund payment
+// @Description	refund a payment fully or partially. Without an amount the rest of the payment is refunded, the given items are put back into stock.
+// @Tags			payments
+// @Accept			json
+// @Produce		json
+// @Param			id		path		string			true	"payment id"
+// @Param			body			body		refundRequest	true	"request"
+// @Param			Idempotency-Key	header		string			false	"replays the response of an earlier request with the same key"
+// @Success		200		{object}	payment.Refund
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		404		{string}	string
+// @Failure		409		{string}	string
+// @Failure		500
+// @Router			/payments/{id}/refunds [post]
+func (h *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	req := refundRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	p, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, payment.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if (p.Status != payment.StatusSuccess && p.Status != payment.StatusPartiallyRefunded) || p.TransactionID == "" {
+		response.Conflict(w, r, payment.ErrNotRefundable)
+		return
+	}
+
+	refunds, err := h.refunds.ListByPayment(r.Context(), p.ID)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	refunded, err := payment.Refunded(p.TotalPayment, refunds)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	remaining, err := p.TotalPayment.Sub(refunded)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	purchased, err := h.purchasedItems(r.Context(), p.OrderID)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	// Checked again when the refund is stored, under a lock of the payment
+	refundable := payment.RefundableItems(purchased, refunds)
+
+	refund := payment.Refund{
+		ID:        store.GenerateID(),
+		PaymentID: p.ID,
+		Amount:    req.Amount,
+		Reason:    req.Reason,
+		Status:    payment.RefundPending,
+		Items:     req.Items,
+	}
+
+	// Refunding the rest of the payment returns the rest of the items too
+	if refund.Amount.IsZero() {
+		refund.Amount = remaining
+
+		if len(refund.Items) == 0 {
+			for variantID, quantity := range refundable {
+				if quantity > 0 {
+					refund.Items = append(refund.Items, payment.RefundItem{VariantID: variantID, Quantity: quantity})
+				}
+			}
+		}
+	}
+
+	if cmp, err := refund.Amount.Cmp(remaining); err != nil || cmp > 0 || !refund.Amount.IsPositive() {
+		message := payment.ErrRefundExceedsPayment.Error() + " of " + remaining.String()
+		if err != nil {
+			message = err.Error()
+		}
+
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: message,
+			Field:   "amount",
+		}})
+		return
+	}
+
+	for _, item := range refund.Items {
+		if item.Quantity > refundable[item.VariantID] {
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: "quantity of variant " + item.VariantID + " exceeds the refundable quantity",
+				Field:   "items",
+			}})
+			return
+		}
+	}
+
+	data, err := refundData(p, refund, purchased)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	state, err := h.saga.Execute(r.Context(), refundSaga, refund.ID, data)
+	if err != nil {
+		if errors.Is(err, payment.ErrRefundExceedsPayment) || errors.Is(err, payment.ErrRefundExceedsItems) {
+			response.Conflict(w, r, err)
+			return
+		}
+
+		if errors.Is(err, payment.ErrDeclined) || errors.Is(err, payment.ErrTransactionState) {
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: state.Error,
+				Field:   "amount",
+			}})
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	refund, err = h.refunds.Get(r.Context(), refund.ID)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	response.OK(w, r, refund)
+}
+
+// @Summary		List refunds
+// @Description	list the refunds of a payment
+// @Tags			payments
+// @Accept			json
+// @Produce		json
+// @Param			id	path		string	true	"payment id"
+// @Success		200	{array}		payment.Refund
+// @Failure		403	{string}	string
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/payments/{id}/refunds [get]
+func (h *PaymentHandler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.repo.Get(r.Context(), id); err != nil {
+		if errors.Is(err, payment.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	refunds, err := h.refunds.ListByPayment(r.Context(), id)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	response.OK(w, r, refunds)
+}
@@ -1,15 +1,21 @@
 package handler
 
 import (
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
 )
 
 type request struct {
-	UserID       string  `json:"user_id"`
-	OrderID      string  `json:"order_id"`
-	TotalPayment float64 `json:"total_payment"`
-	PaymentDate  string  `json:"payment_date"`
-	Status       string  `json:"status"`
+	UserID       string      `json:"user_id"`
+	OrderID      string      `json:"order_id"`
+	TotalPayment money.Money `json:"total_payment"`
+	PaymentDate  string      `json:"payment_date"`
+	Status       string      `json:"status"`
+	// Source is the payment method from the client, e.g. an ePay card
+	// cryptogram. Only needed to make a payment.
+	Source   string           `json:"source"`
+	Customer payment.Customer `json:"customer"`
 } // @name PaymentRequest
 
 func (req *request) Validate() []response.ErrorResponse {
@@ -27,9 +33,9 @@ func (req *request) Validate() []response.ErrorResponse {
 			Field:   "order_id",
 		})
 	}
-	if req.TotalPayment == 0 {
+	if !req.TotalPayment.IsPositive() {
 		errs = append(errs, response.ErrorResponse{
-			Message: "empty total_payment",
+			Message: "total_payment must be greater than 0",
 			Field:   "total_payment",
 		})
 	}
@@ -48,3 +54,41 @@ func (req *request) Validate() []response.ErrorResponse {
 
 	return errs
 }
+
+type refundRequest struct {
+	// Amount defaults to the part of the payment that isn't refunded yet.
+	Amount money.Money          `json:"amount"`
+	Reason string               `json:"reason"`
+	Items  []payment.RefundItem `json:"items"`
+} // @name RefundRequest
+
+func (req *refundRequest) Validate() []response.ErrorResponse {
+	var errs []response.ErrorResponse
+
+	if req.Amount.IsNegative() {
+		errs = append(errs, response.ErrorResponse{
+			Message: "amount must be greater than 0",
+			Field:   "amount",
+		})
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for _, item := range req.Items {
+		if item.VariantID == "" || seen[item.VariantID] {
+			errs = append(errs, response.ErrorResponse{
+				Message: "empty or duplicate variant_id",
+				Field:   "items",
+			})
+		}
+		if item.Quantity <= 0 {
+			errs = append(errs, response.ErrorResponse{
+				Message: "quantity must be greater than 0",
+				Field:   "items",
+			})
+		}
+
+		seen[item.VariantID] = true
+	}
+
+	return errs
+}
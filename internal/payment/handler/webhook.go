@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxWebhookSize = 1 << 20
+
+// @Summary		Payment provider webhook
+// @Description	receive an asynchronous payment outcome (ePay postLink). Deliveries are deduplicated, so providers can safely retry.
+// @Tags			payments
+// @Accept			json
+// @Produce		json
+// @Param			provider	path	string	true	"provider name"
+// @Success		200
+// @Failure		400	{array}		response.ErrorResponse
+// @Failure		401	{string}	string
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/payments/webhooks/{provider} [post]
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	verifier, ok := h.provider.(payment.WebhookVerifier)
+	if !ok || h.webhooks == nil || chi.URLParam(r, "provider") != h.provider.Name() {
+		response.NotFound(w, r, payment.ErrNoWebhooks)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	n, parseErr := verifier.ParseWebhook(r.Header, body)
+
+	// Every delivery is logged as received, including the rejected ones
+	event := payment.WebhookEvent{
+		Provider:      h.provider.Name(),
+		TransactionID: n.TransactionID,
+		Status:        n.Status,
+		Verified:      parseErr == nil,
+		Payload:       string(body),
+	}
+	if parseErr != nil {
+		event.Outcome = payment.WebhookRejected
+		event.Error = parseErr.Error()
+	}
+
+	id, err := h.webhooks.Log(r.Context(), event)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if errors.Is(parseErr, payment.ErrInvalidSignature) {
+		response.Unauthorized(w, r, parseErr)
+		return
+	}
+
+	if parseErr != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: parseErr.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	outcome, err := h.handleNotification(r.Context(), n)
+
+	errMessage := ""
+	switch {
+	case errors.Is(err, payment.ErrAmountMismatch):
+		outcome = payment.WebhookRejected
+		errMessage = err.Error()
+	case err != nil:
+		outcome = payment.WebhookFailed
+		errMessage = err.Error()
+	}
+
+	if err := h.webhooks.SetOutcome(r.Context(), id, outcome, errMessage); err != nil {
+		fmt.Printf("Recording outcome of webhook %d failed: %v\n", id, err)
+	}
+
+	if errors.Is(err, payment.ErrAmountMismatch) {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "amount",
+		}})
+		return
+	}
+
+	// A failure makes the provider deliver the notification again
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleNotification applies each status of a transaction once. The claim is
+// given up again if applying fails, so a redelivery gets another chance.
+func (h *PaymentHandler) handleNotification(ctx context.Context, n payment.Notification) (string, error) {
+	claimed, err := h.webhooks.Claim(ctx, n)
+	if err != nil {
+		return "", err
+	}
+
+	if !claimed {
+		return payment.WebhookDuplicate, nil
+	}
+
+	outcome, err := h.applyNotification(ctx, n)
+	if err != nil {
+		if uerr := h.webhooks.Unclaim(ctx, n); uerr != nil {
+			fmt.Printf("Releasing webhook claim for transaction %s failed: %v\n", n.TransactionID, uerr)
+		}
+
+		return "", err
+	}
+
+	return outcome, nil
+}
+
+// applyNotification updates the payment. The repository publishes the
+// payment events the order service moves the order on. The state of the
+// transaction is taken from the provider rather than the notification, whose
+// signature may not cover it.
+func (h *PaymentHandler) applyNotification(ctx context.Context, n payment.Notification) (string, error) {
+	p, err := h.repo.GetByTransaction(ctx, n.Provider, n.TransactionID)
+	if errors.Is(err, payment.ErrNotFound) && n.PaymentID != "" {
+		p, err = h.repo.Get(ctx, n.PaymentID)
+	}
+	if errors.Is(err, payment.ErrNotFound) {
+		return payment.WebhookIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	updated := p
+
+	// The checkout may not have stored the transaction yet
+	if p.TransactionID == "" {
+		updated.Provider = n.Provider
+		updated.TransactionID = n.TransactionID
+	} else if p.TransactionID != n.TransactionID {
+		return payment.WebhookIgnored, nil
+	}
+
+	if cmp, err := n.Amount.Cmp(p.TotalPayment); err != nil || cmp != 0 {
+		return "", fmt.Errorf("%w: notified %s for a payment of %s", payment.ErrAmountMismatch, n.Amount, p.TotalPayment)
+	}
+
+	tx, err := h.provider.Status(ctx, n.TransactionID)
+	if errors.Is(err, payment.ErrTransactionNotFound) {
+		return payment.WebhookIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch p.Status {
+	case payment.StatusPending:
+		switch tx.Status {
+		case payment.TransactionCaptured:
+			updated.Status = payment.StatusSuccess
+		case payment.TransactionDeclined, payment.TransactionVoided:
+			updated.Status = payment.StatusFailed
+		}
+
+		// An authorized transaction only gets recorded, the checkout
+		// captures it instead of authorizing again
+	case payment.StatusFailed:
+		// The hold came in after the checkout gave up on the payment
+		if tx.Status == payment.TransactionAuthorized {
+			if _, err := h.provider.Void(ctx, tx.ID); err != nil {
+				return "", err
+			}
+
+			return payment.WebhookApplied, nil
+		}
+	}
+
+	if updated == p {
+		return payment.WebhookIgnored, nil
+	}
+
+	if err := h.repo.Update(ctx, p.ID, updated); err != nil {
+		return "", err
+	}
+
+	return payment.WebhookApplied, nil
+}
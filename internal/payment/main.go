@@ -5,22 +5,31 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/order"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/common/router"
 	"github.com/erazr/ecommerce-microservices/internal/common/server"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/payment/docs"
 	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
 	"github.com/erazr/ecommerce-microservices/internal/payment/epay"
+	"github.com/erazr/ecommerce-microservices/internal/payment/fakepay"
 	"github.com/erazr/ecommerce-microservices/internal/payment/handler"
 	"github.com/erazr/ecommerce-microservices/internal/payment/repository"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
 )
 
+//	@title			E-commerce Microservices Payment Service
+//	@version		1.0
+//	@description	Takes payments for orders and refunds them.
+
 func main() {
 	db, err := store.New(os.Getenv("DB_URL"))
 	if err != nil {
@@ -28,32 +37,136 @@ func main() {
 	}
 
 	paymentRepository := repository.NewPaymentRepository(db.Client)
+	sagaRepository := repository.NewSagaRepository(db.Client)
+	webhookRepository := repository.NewWebhookRepository(db.Client)
+	refundRepository := repository.NewRefundRepository(db.Client)
+	orderRepository := repository.NewOrderRepository(db.Client)
+
+	grpcTLS, err := server.LoadGRPCTLS(os.Getenv("GRPC_TLS_DIR"), "payment")
+	if err != nil {
+		panic(err)
+	}
 
-	orderConn, err := grpc.NewClient("order:"+os.Getenv("ORDER_GRPC_PORT"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	orderConn, err := server.DialGRPC("order:"+os.Getenv("ORDER_GRPC_PORT"), "payment", grpcTLS)
 	if err != nil {
 		panic(err)
 	}
 	defer orderConn.Close()
 
-	productConn, err := grpc.NewClient("product:"+os.Getenv("PRODUCT_GRPC_PORT"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	productConn, err := server.DialGRPC("product:"+os.Getenv("PRODUCT_GRPC_PORT"), "payment", grpcTLS)
 	if err != nil {
 		panic(err)
 	}
 	defer productConn.Close()
 
-	ePayService := epay.NewService()
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	bus := events.NewPostgresBus(db.Client, os.Getenv("DB_URL"), "payment")
+	handler.NewPaymentEventHandler(orderRepository).Subscribe(bus)
+
+	relayConfigs := []func(*events.Relay){}
+	if retention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil {
+		relayConfigs = append(relayConfigs, events.WithRetention(retention))
+	}
+
+	go events.NewRelay(db.Client, bus, relayConfigs...).Run(background)
+	go func() {
+		if err := bus.Listen(background); err != nil {
+			fmt.Printf("Event listener stopped: %v\n", err)
+		}
+	}()
+
+	var provider payment.Provider
+
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "fake":
+		provider = fakepay.NewService(
+			fakepay.WithWebhookSecret(os.Getenv("PAYMENT_WEBHOOK_SECRET")),
+		)
+	default:
+		provider = epay.NewService(
+			epay.WithCredentials(os.Getenv("EPAY_CLIENT_ID"), os.Getenv("EPAY_CLIENT_SECRET")),
+			epay.WithTerminalID(os.Getenv("EPAY_TERMINAL_ID")),
+			epay.WithEndpoints(os.Getenv("EPAY_OAUTH_URL"), os.Getenv("EPAY_API_URL")),
+			epay.WithPostLinks(os.Getenv("EPAY_POST_LINK"), os.Getenv("EPAY_FAILURE_POST_LINK")),
+			epay.WithWebhookSecret(os.Getenv("PAYMENT_WEBHOOK_SECRET")),
+		)
+	}
+
+	fmt.Printf("Using %s payment provider\n", provider.Name())
+
+	idempotencyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil {
+		idempotencyTTL = 24 * time.Hour
+	}
+
+	var requestCache server.IdempotencyCache
+
+	if dir := os.Getenv("IDEMPOTENCY_DIR"); dir != "" {
+		responseCache, err := store.NewFileCache[server.StoredResponse](filepath.Join(dir, "payment_requests"), idempotencyTTL)
+		if err != nil {
+			panic(err)
+		}
+
+		requestCache = responseCache
+	} else {
+		responseCache := store.NewPostgresCache[server.StoredResponse](db.Client, "payment_requests", idempotencyTTL)
+		requestCache = responseCache
+
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+
+			for {
+				if err := responseCache.Purge(background); err != nil {
+					fmt.Printf("Purging idempotency keys failed: %v\n", err)
+				}
+
+				select {
+				case <-background.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
 
-	idempotencyCache := store.NewInMemoryIdempotencyCache[payment.Payment]()
+	orchestrator := saga.NewOrchestrator(sagaRepository)
 
-	paymentHandler := handler.NewPaymentHandler(paymentRepository, *ePayService,
-		handler.WithIdempotencyCache(idempotencyCache),
+	paymentHandler := handler.NewPaymentHandler(paymentRepository, provider,
+		handler.WithWebhookRepository(webhookRepository),
+		handler.WithRefundRepository(refundRepository),
+		handler.WithOrderRepository(orderRepository),
 		handler.WithOrderGRPCService(order.NewOrdersClient(orderConn)),
 		handler.WithProductGRPCService(product.NewProductsClient(productConn)),
+		handler.WithSagaOrchestrator(orchestrator),
 	)
 
+	// Pick up checkouts interrupted by a crash or a failed compensation
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			if err := orchestrator.Resume(background); err != nil {
+				fmt.Printf("Resuming sagas failed: %v\n", err)
+			}
+
+			select {
+			case <-background.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
 	r := router.New()
+	r.Use(authz.Identify)
+	r.Use(server.Idempotency(requestCache))
 
 	r.Mount("/payments", paymentHandler.Routes())
+	r.Get("/openapi.json", openapi.Handler(docs.OpenAPI))
 
 	server, err := server.New(server.WithHTTPServer(r, os.Getenv("PAYMENT_PORT")))
 	if err != nil {
@@ -70,6 +183,8 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+type OrderRepository struct {
+	db *sqlx.DB
+}
+
+func NewOrderRepository(db *sqlx.DB) *OrderRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &OrderRepository{
+		db: db,
+	}
+}
+
+func (r *OrderRepository) Save(ctx context.Context, o payment.Order) error {
+	q := `
+		INSERT INTO payment_orders (id, user_id, total, currency) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, q, o.ID, o.UserID, o.Total, o.Total.Currency)
+
+	return err
+}
+
+func (r *OrderRepository) Get(ctx context.Context, id string) (payment.Order, error) {
+	row := struct {
+		payment.Order
+		Currency string `db:"currency"`
+	}{}
+
+	err := r.db.GetContext(ctx, &row, "SELECT id, user_id, total, currency FROM payment_orders WHERE id = $1", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return payment.Order{}, payment.ErrOrderNotFound
+		}
+
+		return payment.Order{}, err
+	}
+
+	o := row.Order
+
+	if o.Total, err = o.Total.WithCurrency(row.Currency); err != nil {
+		return payment.Order{}, err
+	}
+
+	return o, nil
+}
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type PaymentRepository struct {
@@ -23,58 +26,176 @@ func NewPaymentRepository(db *sqlx.DB) *PaymentRepository {
 	}
 }
 
-func (r *PaymentRepository) Create(ctx context.Context, payment payment.Payment) (string, error) {
-	q := `INSERT INTO payments (id, user_id, order_id, total_payment, payment_date, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+// paymentRow is a payments row, the currency of the total is stored in its
+// own column and folded into TotalPayment by toPayment.
+type paymentRow struct {
+	payment.Payment
+	Currency string `db:"currency"`
+}
+
+func (row paymentRow) toPayment() (payment.Payment, error) {
+	p := row.Payment
+
+	total, err := p.TotalPayment.WithCurrency(row.Currency)
+	if err != nil {
+		return payment.Payment{}, err
+	}
+
+	p.TotalPayment = total
+
+	return p, nil
+}
+
+func toPayments(rows []paymentRow) ([]payment.Payment, error) {
+	payments := make([]payment.Payment, 0, len(rows))
+
+	for _, row := range rows {
+		p, err := row.toPayment()
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, p)
+	}
+
+	return payments, nil
+}
+
+// pendingPaymentIndex keeps orders to one pending payment.
+const pendingPaymentIndex = "idx_payments_order_id_pending"
+
+// Create fails with ErrInProgress while another payment of the order is
+// pending.
+func (r *PaymentRepository) Create(ctx context.Context, p payment.Payment) (string, error) {
+	q := `
+		INSERT INTO payments (id, user_id, order_id, total_payment, currency, payment_date, status, provider, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id
+	`
 
 	err := r.db.QueryRowContext(ctx, q,
-		payment.ID,
-		payment.UserID,
-		payment.OrderID,
-		payment.TotalPayment,
-		payment.PaymentDate,
-		payment.Status,
-	).Scan(&payment.ID)
+		p.ID,
+		p.UserID,
+		p.OrderID,
+		p.TotalPayment,
+		p.TotalPayment.Currency,
+		p.PaymentDate,
+		p.Status,
+		p.Provider,
+		p.TransactionID,
+	).Scan(&p.ID)
 	if err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Constraint == pendingPaymentIndex {
+			return "", payment.ErrInProgress
+		}
+
 		return "", err
 	}
 
-	return payment.ID, nil
+	return p.ID, nil
 }
 
 func (r *PaymentRepository) Get(ctx context.Context, id string) (payment.Payment, error) {
-	p := payment.Payment{}
+	row := paymentRow{}
 
-	err := r.db.GetContext(ctx, &p, "SELECT * FROM payments WHERE id = $1", id)
+	err := r.db.GetContext(ctx, &row, "SELECT * FROM payments WHERE id = $1", id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return p, payment.ErrNotFound
+			return payment.Payment{}, payment.ErrNotFound
 		}
-		return p, err
+		return payment.Payment{}, err
 	}
 
-	return p, nil
+	return row.toPayment()
 }
 
+// Update writes a PaymentSucceeded event in the same transaction when the
+// payment transitions to success.
 func (r *PaymentRepository) Update(ctx context.Context, id string, p payment.Payment) error {
-	q := `UPDATE payments SET user_id=$1, order_id=$2, total_payment=$3, payment_date=$4, status=$5 WHERE id=$6 RETURNING id`
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	err := r.db.QueryRowContext(ctx, q,
+	var status string
+
+	if err = tx.GetContext(ctx, &status, "SELECT status FROM payments WHERE id = $1 FOR UPDATE", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return payment.ErrNotFound
+		}
+
+		return err
+	}
+
+	q := `
+		UPDATE payments SET user_id=$1, order_id=$2, total_payment=$3, currency=$4, payment_date=$5, status=$6,
+			provider=$7, transaction_id=$8
+		WHERE id=$9
+	`
+
+	_, err = tx.ExecContext(ctx, q,
 		p.UserID,
 		p.OrderID,
 		p.TotalPayment,
+		p.TotalPayment.Currency,
 		p.PaymentDate,
 		p.Status,
+		p.Provider,
+		p.TransactionID,
 		id,
-	).Scan(&p.ID)
+	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return payment.ErrNotFound
+		return err
+	}
+
+	if p.Status == payment.StatusFailed && status != payment.StatusFailed {
+		e, err := events.New(events.PaymentFailed, id, events.PaymentFailedPayload{
+			PaymentID: id,
+			OrderID:   p.OrderID,
+			UserID:    p.UserID,
+		})
+		if err != nil {
+			return err
 		}
 
-		return err
+		if err = events.Add(ctx, tx, e); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	if p.Status == payment.StatusSuccess && status != payment.StatusSuccess {
+		e, err := events.New(events.PaymentSucceeded, id, events.PaymentSucceededPayload{
+			PaymentID: id,
+			OrderID:   p.OrderID,
+			UserID:    p.UserID,
+			Amount:    p.TotalPayment,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = events.Add(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *PaymentRepository) GetByTransaction(ctx context.Context, provider, transactionID string) (payment.Payment, error) {
+	row := paymentRow{}
+
+	q := "SELECT * FROM payments WHERE provider = $1 AND transaction_id = $2"
+
+	err := r.db.GetContext(ctx, &row, q, provider, transactionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return payment.Payment{}, payment.ErrNotFound
+		}
+		return payment.Payment{}, err
+	}
+
+	return row.toPayment()
 }
 
 func (r *PaymentRepository) Delete(ctx context.Context, id string) error {
@@ -90,28 +211,70 @@ func (r *PaymentRepository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *PaymentRepository) List(ctx context.Context) ([]payment.Payment, error) {
-	payments := []payment.Payment{}
+func (r *PaymentRepository) List(ctx context.Context, req store.PageRequest) (store.Page[payment.Payment], error) {
+	return r.Search(ctx, nil, req)
+}
+
+func (r *PaymentRepository) ListByUser(ctx context.Context, userID string, req store.PageRequest) (store.Page[payment.Payment], error) {
+	filters := []store.Filter{{Field: "user_id", Op: store.Eq, Values: []string{userID}}}
+
+	return r.Search(ctx, filters, req)
+}
+
+// searchColumns are the fields payments can be searched by.
+var searchColumns = store.Columns{
+	"user_id":        {Name: "user_id"},
+	"order_id":       {Name: "order_id"},
+	"status":         {Name: "status"},
+	"provider":       {Name: "provider"},
+	"transaction_id": {Name: "transaction_id"},
+	"currency":       {Name: "currency"},
+	"total_payment":  {Name: "total_payment", Type: store.Number},
+	"payment_date":   {Name: "payment_date", Type: store.Date},
+}
+
+// sortKeys are the fields payments can be sorted by.
+var sortKeys = store.Keyset[payment.Payment]{
+	ID:   "id",
+	IDOf: func(p payment.Payment) string { return p.ID },
+	Sorts: map[string]store.SortKey[payment.Payment]{
+		"payment_date":  {Column: "payment_date", Type: store.Date, Value: func(p payment.Payment) string { return string(p.PaymentDate) }},
+		"total_payment": {Column: "total_payment", Type: store.Number, Value: func(p payment.Payment) string { return p.TotalPayment.Decimal() }},
+		"status":        {Column: "status", Value: func(p payment.Payment) string { return p.Status }},
+	},
+	Default: "payment_date",
+}
+
+func (r *PaymentRepository) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[payment.Payment], error) {
+	where, args, err := searchColumns.Where(filters, 0)
+	if err != nil {
+		return store.Page[payment.Payment]{}, err
+	}
 
-	err := r.db.SelectContext(ctx, &payments, "SELECT * FROM payments")
+	after, orderBy, limit, afterArgs, err := sortKeys.Clause(req, len(args))
 	if err != nil {
-		return payments, err
+		return store.Page[payment.Payment]{}, err
 	}
 
-	return payments, nil
-}
+	var total int
 
-func (r *PaymentRepository) Search(ctx context.Context, filter, value string) ([]payment.Payment, error) {
-	payments := []payment.Payment{}
+	if err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM payments WHERE "+where, args...); err != nil {
+		return store.Page[payment.Payment]{}, err
+	}
+
+	rows := []paymentRow{}
+
+	q := "SELECT * FROM payments WHERE " + where + " AND " + after + " " + orderBy + " " + limit
 
-	err := r.db.SelectContext(ctx, &payments, "SELECT * FROM payments WHERE $1 = $2", filter, value)
+	err = r.db.SelectContext(ctx, &rows, q, append(args, afterArgs...)...)
 	if err != nil {
-		return payments, err
+		return store.Page[payment.Payment]{}, err
 	}
 
-	if len(payments) == 0 {
-		return payments, payment.ErrNotFound
+	payments, err := toPayments(rows)
+	if err != nil {
+		return store.Page[payment.Payment]{}, err
 	}
 
-	return payments, nil
+	return sortKeys.Page(req, payments, total)
 }
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+type RefundRepository struct {
+	db *sqlx.DB
+}
+
+func NewRefundRepository(db *sqlx.DB) *RefundRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &RefundRepository{
+		db: db,
+	}
+}
+
+type refundRow struct {
+	payment.Refund
+	Currency string `db:"currency"`
+}
+
+// Create locks the payment while checking the refunds against its total and
+// the purchased items, so concurrent refunds can't add up to more than was
+// paid or return the same units twice.
+func (r *RefundRepository) Create(ctx context.Context, refund payment.Refund, purchased map[string]int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	total := struct {
+		Amount   money.Money `db:"total_payment"`
+		Currency string      `db:"currency"`
+	}{}
+
+	q := "SELECT total_payment, currency FROM payments WHERE id = $1 FOR UPDATE"
+
+	if err = tx.GetContext(ctx, &total, q, refund.PaymentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return payment.ErrNotFound
+		}
+
+		return err
+	}
+
+	paid, err := total.Amount.WithCurrency(total.Currency)
+	if err != nil {
+		return err
+	}
+
+	refunds, err := r.list(ctx, tx, refund.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	refunded, err := payment.Refunded(paid, refunds)
+	if err != nil {
+		return err
+	}
+
+	if refunded, err = refunded.Add(refund.Amount); err != nil {
+		return err
+	}
+
+	if cmp, _ := refunded.Cmp(paid); cmp > 0 {
+		return payment.ErrRefundExceedsPayment
+	}
+
+	if err = payment.CheckRefundItems(refund, purchased, refunds); err != nil {
+		return err
+	}
+
+	q = `
+		INSERT INTO refunds (id, payment_id, amount, currency, reason, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, q,
+		refund.ID,
+		refund.PaymentID,
+		refund.Amount,
+		refund.Amount.Currency,
+		refund.Reason,
+		refund.Status,
+		refund.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range refund.Items {
+		q := "INSERT INTO refund_items (refund_id, variant_id, quantity) VALUES ($1, $2, $3)"
+
+		if _, err = tx.ExecContext(ctx, q, refund.ID, item.VariantID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *RefundRepository) Get(ctx context.Context, id string) (payment.Refund, error) {
+	refunds, err := r.selectRefunds(ctx, r.db, "SELECT * FROM refunds WHERE id = $1", id)
+	if err != nil {
+		return payment.Refund{}, err
+	}
+
+	if len(refunds) == 0 {
+		return payment.Refund{}, payment.ErrRefundNotFound
+	}
+
+	return refunds[0], nil
+}
+
+func (r *RefundRepository) ListByPayment(ctx context.Context, paymentID string) ([]payment.Refund, error) {
+	return r.list(ctx, r.db, paymentID)
+}
+
+func (r *RefundRepository) SetStatus(ctx context.Context, id, status string) error {
+	err := r.db.QueryRowContext(ctx, "UPDATE refunds SET status = $1 WHERE id = $2 RETURNING id", status, id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return payment.ErrRefundNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *RefundRepository) list(ctx context.Context, q sqlx.QueryerContext, paymentID string) ([]payment.Refund, error) {
+	return r.selectRefunds(ctx, q, "SELECT * FROM refunds WHERE payment_id = $1 ORDER BY created_at", paymentID)
+}
+
+// selectRefunds loads the refunds matched by query together with their
+// items.
+func (r *RefundRepository) selectRefunds(ctx context.Context, q sqlx.QueryerContext, query string, args ...any) ([]payment.Refund, error) {
+	rows := []refundRow{}
+
+	if err := sqlx.SelectContext(ctx, q, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	refunds := make([]payment.Refund, 0, len(rows))
+
+	for _, row := range rows {
+		refund := row.Refund
+
+		amount, err := refund.Amount.WithCurrency(row.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		refund.Amount = amount
+		refund.Items = []payment.RefundItem{}
+
+		err = sqlx.SelectContext(ctx, q, &refund.Items, "SELECT variant_id, quantity FROM refund_items WHERE refund_id = $1", refund.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, nil
+}
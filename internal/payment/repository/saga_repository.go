@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/payment/saga"
+	"github.com/jmoiron/sqlx"
+)
+
+type SagaRepository struct {
+	db *sqlx.DB
+}
+
+func NewSagaRepository(db *sqlx.DB) *SagaRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &SagaRepository{
+		db: db,
+	}
+}
+
+func (r *SagaRepository) Create(ctx context.Context, s saga.State) error {
+	q := `INSERT INTO sagas (id, name, status, step, data, error) VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := r.db.ExecContext(ctx, q, s.ID, s.Name, s.Status, s.Step, s.Data, s.Error)
+
+	return err
+}
+
+func (r *SagaRepository) Update(ctx context.Context, s saga.State) error {
+	q := `UPDATE sagas SET status = $1, step = $2, data = $3, error = $4, updated_at = NOW() WHERE id = $5 RETURNING id`
+
+	err := r.db.QueryRowContext(ctx, q, s.Status, s.Step, s.Data, s.Error, s.ID).Scan(&s.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("saga with id %s not found", s.ID)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Claim takes the oldest stale saga, rows locked by a concurrent claim are
+// skipped rather than waited for.
+func (r *SagaRepository) Claim(ctx context.Context, staleAfter time.Duration) (s saga.State, ok bool, err error) {
+	q := `
+		UPDATE sagas SET updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM sagas
+			WHERE status IN ($1, $2) AND updated_at <= $3
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	err = r.db.GetContext(ctx, &s, q, saga.StatusRunning, saga.StatusCompensating, time.Now().Add(-staleAfter))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, false, nil
+		}
+
+		return s, false, err
+	}
+
+	return s, true, nil
+}
+
+func (r *SagaRepository) Touch(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sagas SET updated_at = NOW() WHERE id = $1", id)
+
+	return err
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/erazr/ecommerce-microservices/internal/payment/domain/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+type WebhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) *WebhookRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+func (r *WebhookRepository) Log(ctx context.Context, e payment.WebhookEvent) (id int64, err error) {
+	q := `
+		INSERT INTO payment_webhook_events (provider, transaction_id, status, verified, payload, outcome, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`
+
+	err = r.db.QueryRowContext(ctx, q, e.Provider, e.TransactionID, e.Status, e.Verified, e.Payload, e.Outcome, e.Error).Scan(&id)
+
+	return
+}
+
+func (r *WebhookRepository) SetOutcome(ctx context.Context, id int64, outcome, errMessage string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE payment_webhook_events SET outcome = $1, error = $2 WHERE id = $3", outcome, errMessage, id)
+
+	return err
+}
+
+func (r *WebhookRepository) Claim(ctx context.Context, n payment.Notification) (bool, error) {
+	q := `
+		INSERT INTO payment_webhook_deliveries (provider, transaction_id, status) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	res, err := r.db.ExecContext(ctx, q, n.Provider, n.TransactionID, n.Status)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return claimed == 1, nil
+}
+
+func (r *WebhookRepository) Unclaim(ctx context.Context, n payment.Notification) error {
+	q := "DELETE FROM payment_webhook_deliveries WHERE provider = $1 AND transaction_id = $2 AND status = $3"
+
+	_, err := r.db.ExecContext(ctx, q, n.Provider, n.TransactionID, n.Status)
+
+	return err
+}
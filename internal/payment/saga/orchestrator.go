@@ -0,0 +1,245 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Orchestrator struct {
+	repo Repository
+
+	definitions map[string]Definition
+
+	attempts   int
+	backoff    time.Duration
+	staleAfter time.Duration
+}
+
+func NewOrchestrator(repo Repository, configs ...func(*Orchestrator)) *Orchestrator {
+	if repo == nil {
+		panic("repo is required")
+	}
+
+	o := &Orchestrator{
+		repo:        repo,
+		definitions: make(map[string]Definition),
+		attempts:    3,
+		backoff:     200 * time.Millisecond,
+		staleAfter:  time.Minute,
+	}
+
+	for _, cfg := range configs {
+		cfg(o)
+	}
+
+	return o
+}
+
+// WithRetries sets how many times a step is attempted and the initial delay
+// between attempts, the delay doubles after every attempt.
+func WithRetries(attempts int, backoff time.Duration) func(*Orchestrator) {
+	return func(o *Orchestrator) {
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
+// WithStaleAfter sets how long a saga goes without being updated before
+// Resume takes it over. Sagas being run are touched well within that time,
+// however long their steps take.
+func WithStaleAfter(d time.Duration) func(*Orchestrator) {
+	return func(o *Orchestrator) {
+		o.staleAfter = d
+	}
+}
+
+func (o *Orchestrator) Register(def Definition) {
+	o.definitions[def.Name] = def
+}
+
+// Execute starts a new saga and runs it to the end. It returns an error
+// wrapping ErrCompensated if the saga failed and was rolled back, any other
+// error means the saga is still in flight and will be picked up by Resume.
+func (o *Orchestrator) Execute(ctx context.Context, name, id string, data Data) (State, error) {
+	def, ok := o.definitions[name]
+	if !ok {
+		return State{}, ErrUnknownDefinition
+	}
+
+	// The saga must not be abandoned halfway because the caller went away
+	ctx = context.WithoutCancel(ctx)
+
+	s := State{
+		ID:     id,
+		Name:   name,
+		Status: StatusRunning,
+		Data:   data,
+	}
+
+	if err := o.repo.Create(ctx, s); err != nil {
+		return s, err
+	}
+
+	return o.run(ctx, def, s)
+}
+
+// Resume continues sagas left unfinished by a crash or a failed compensation.
+// Sagas are claimed one at a time, so runners on other replicas never pick up
+// the same saga.
+func (o *Orchestrator) Resume(ctx context.Context) error {
+	for {
+		s, ok, err := o.repo.Claim(ctx, o.staleAfter)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+
+		def, ok := o.definitions[s.Name]
+		if !ok {
+			continue
+		}
+
+		if _, err := o.run(ctx, def, s); err != nil {
+			fmt.Printf("Resuming saga %s with id %s: %v\n", s.Name, s.ID, err)
+		}
+	}
+}
+
+func (o *Orchestrator) run(ctx context.Context, def Definition, s State) (State, error) {
+	stop := o.keepClaimed(ctx, s.ID)
+	defer stop()
+
+	// cause is the error of the failed step, only known when it failed in
+	// this run rather than before a resume
+	var cause error
+
+	for s.Status == StatusRunning {
+		if s.Step >= len(def.Steps) {
+			s.Status = StatusCompleted
+
+			return s, o.repo.Update(ctx, s)
+		}
+
+		step := def.Steps[s.Step]
+
+		if err := o.retry(ctx, step.Action, s.Data); err != nil {
+			if step.Retriable {
+				s.Error = fmt.Sprintf("%s: %v", step.Name, err)
+
+				if uerr := o.repo.Update(ctx, s); uerr != nil {
+					return s, uerr
+				}
+
+				return s, err
+			}
+
+			cause = err
+			s.Status = StatusCompensating
+			s.Error = fmt.Sprintf("%s: %v", step.Name, err)
+		} else {
+			s.Step++
+		}
+
+		if err := o.repo.Update(ctx, s); err != nil {
+			return s, err
+		}
+	}
+
+	for s.Status == StatusCompensating {
+		if s.Step == 0 {
+			s.Status = StatusCompensated
+
+			if err := o.repo.Update(ctx, s); err != nil {
+				return s, err
+			}
+
+			if cause != nil {
+				return s, fmt.Errorf("%w: %w", ErrCompensated, cause)
+			}
+
+			return s, fmt.Errorf("%w: %s", ErrCompensated, s.Error)
+		}
+
+		step := def.Steps[s.Step-1]
+
+		if step.Compensate != nil {
+			if err := o.retry(ctx, step.Compensate, s.Data); err != nil {
+				s.Error = fmt.Sprintf("compensating %s: %v", step.Name, err)
+
+				if uerr := o.repo.Update(ctx, s); uerr != nil {
+					return s, uerr
+				}
+
+				return s, err
+			}
+		}
+
+		s.Step--
+
+		if err := o.repo.Update(ctx, s); err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// keepClaimed touches the saga until stop is called, so a slow step doesn't
+// let it go stale and be resumed by another runner meanwhile.
+func (o *Orchestrator) keepClaimed(ctx context.Context, id string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(o.staleAfter / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := o.repo.Touch(ctx, id); err != nil {
+					fmt.Printf("Touching saga %s: %v\n", id, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (o *Orchestrator) retry(ctx context.Context, fn func(context.Context, Data) error, data Data) (err error) {
+	backoff := o.backoff
+
+	for attempt := 1; attempt <= o.attempts; attempt++ {
+		if err = fn(ctx, data); err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if attempt == o.attempts || errors.As(err, &permanent) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	return err
+}
@@ -0,0 +1,285 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRepository keeps sagas in memory.
+type memoryRepository struct {
+	mu    sync.Mutex
+	sagas map[string]State
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{sagas: make(map[string]State)}
+}
+
+func (r *memoryRepository) Create(ctx context.Context, s State) error {
+	return r.Update(ctx, s)
+}
+
+func (r *memoryRepository) Update(ctx context.Context, s State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.UpdatedAt = time.Now()
+	r.sagas[s.ID] = s
+
+	return nil
+}
+
+func (r *memoryRepository) Claim(ctx context.Context, staleAfter time.Duration) (State, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.sagas {
+		if s.Status != StatusRunning && s.Status != StatusCompensating {
+			continue
+		}
+
+		if time.Since(s.UpdatedAt) < staleAfter {
+			continue
+		}
+
+		s.UpdatedAt = time.Now()
+		r.sagas[id] = s
+
+		return s, true, nil
+	}
+
+	return State{}, false, nil
+}
+
+func (r *memoryRepository) Touch(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sagas[id]
+	s.UpdatedAt = time.Now()
+	r.sagas[id] = s
+
+	return nil
+}
+
+func (r *memoryRepository) get(id string) State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sagas[id]
+}
+
+// stale is how long sagas in the tests go without updates before Resume
+// takes them over.
+const stale = 20 * time.Millisecond
+
+// journal records the actions and compensations steps ran, failing the ones
+// in failing.
+type journal struct {
+	ran     []string
+	failing map[string]error
+}
+
+func (j *journal) step(name string, retriable bool) Step {
+	return Step{
+		Name: name,
+		Action: func(ctx context.Context, data Data) error {
+			j.ran = append(j.ran, name)
+			return j.failing[name]
+		},
+		Compensate: func(ctx context.Context, data Data) error {
+			j.ran = append(j.ran, "undo "+name)
+			return j.failing["undo "+name]
+		},
+		Retriable: retriable,
+	}
+}
+
+func TestRetriableStepIsNotCompensated(t *testing.T) {
+	repo := newMemoryRepository()
+	o := NewOrchestrator(repo, WithRetries(1, 0), WithStaleAfter(stale))
+
+	j := &journal{failing: map[string]error{"restock": errors.New("product service unavailable")}}
+
+	o.Register(Definition{Name: "refund", Steps: []Step{
+		j.step("refund_payment", false),
+		j.step("restock", true),
+		j.step("complete", true),
+	}})
+
+	s, err := o.Execute(context.Background(), "refund", "saga1", Data{})
+	if err == nil || errors.Is(err, ErrCompensated) {
+		t.Fatalf("got error %v, want the saga left in flight", err)
+	}
+
+	if s.Status != StatusRunning || s.Step != 1 {
+		t.Errorf("got status %s at step %d, want %s at step 1", s.Status, s.Step, StatusRunning)
+	}
+
+	delete(j.failing, "restock")
+	time.Sleep(2 * stale)
+
+	if err := o.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := repo.get("saga1").Status; got != StatusCompleted {
+		t.Errorf("got status %s after resuming, want %s", got, StatusCompleted)
+	}
+
+	want := []string{"refund_payment", "restock", "restock", "complete"}
+	if !slices.Equal(j.ran, want) {
+		t.Errorf("ran %v, want %v", j.ran, want)
+	}
+}
+
+func TestCompensation(t *testing.T) {
+	cause := errors.New("card declined")
+
+	repo := newMemoryRepository()
+	o := NewOrchestrator(repo, WithRetries(1, 0), WithStaleAfter(stale))
+
+	j := &journal{failing: map[string]error{"charge": cause}}
+
+	o.Register(Definition{Name: "checkout", Steps: []Step{
+		j.step("create", false),
+		j.step("reserve", false),
+		j.step("charge", false),
+	}})
+
+	s, err := o.Execute(context.Background(), "checkout", "saga1", Data{})
+	if !errors.Is(err, ErrCompensated) || !errors.Is(err, cause) {
+		t.Fatalf("got error %v, want the compensated cause", err)
+	}
+
+	if s.Status != StatusCompensated || repo.get("saga1").Status != StatusCompensated {
+		t.Errorf("got status %s, want %s", s.Status, StatusCompensated)
+	}
+
+	// The failed step didn't happen, so only the ones before it are undone
+	want := []string{"create", "reserve", "charge", "undo reserve", "undo create"}
+	if !slices.Equal(j.ran, want) {
+		t.Errorf("ran %v, want %v", j.ran, want)
+	}
+}
+
+func TestResume(t *testing.T) {
+	t.Run("crashed while running", func(t *testing.T) {
+		repo := newMemoryRepository()
+		o := NewOrchestrator(repo, WithRetries(1, 0), WithStaleAfter(stale))
+
+		j := &journal{}
+
+		o.Register(Definition{Name: "checkout", Steps: []Step{
+			j.step("create", false),
+			j.step("reserve", false),
+			j.step("charge", false),
+		}})
+
+		// Left by a runner that did create and went away
+		repo.Create(context.Background(), State{ID: "saga1", Name: "checkout", Status: StatusRunning, Step: 1, Data: Data{}})
+
+		if err := o.Resume(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := repo.get("saga1").Status; got != StatusRunning {
+			t.Fatalf("got status %s, want a saga updated just now left alone", got)
+		}
+
+		time.Sleep(2 * stale)
+
+		if err := o.Resume(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := repo.get("saga1").Status; got != StatusCompleted {
+			t.Errorf("got status %s, want %s", got, StatusCompleted)
+		}
+
+		want := []string{"reserve", "charge"}
+		if !slices.Equal(j.ran, want) {
+			t.Errorf("ran %v, want %v", j.ran, want)
+		}
+	})
+
+	t.Run("failed compensation", func(t *testing.T) {
+		repo := newMemoryRepository()
+		o := NewOrchestrator(repo, WithRetries(1, 0), WithStaleAfter(stale))
+
+		j := &journal{failing: map[string]error{
+			"charge":       errors.New("card declined"),
+			"undo reserve": errors.New("product service unavailable"),
+		}}
+
+		o.Register(Definition{Name: "checkout", Steps: []Step{
+			j.step("create", false),
+			j.step("reserve", false),
+			j.step("charge", false),
+		}})
+
+		_, err := o.Execute(context.Background(), "checkout", "saga1", Data{})
+		if err == nil || errors.Is(err, ErrCompensated) {
+			t.Fatalf("got error %v, want the saga left compensating", err)
+		}
+
+		if s := repo.get("saga1"); s.Status != StatusCompensating || s.Step != 2 {
+			t.Fatalf("got status %s at step %d, want %s at step 2", s.Status, s.Step, StatusCompensating)
+		}
+
+		delete(j.failing, "undo reserve")
+		time.Sleep(2 * stale)
+
+		if err := o.Resume(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := repo.get("saga1").Status; got != StatusCompensated {
+			t.Errorf("got status %s, want %s", got, StatusCompensated)
+		}
+
+		want := []string{"create", "reserve", "charge", "undo reserve", "undo reserve", "undo create"}
+		if !slices.Equal(j.ran, want) {
+			t.Errorf("ran %v, want %v", j.ran, want)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"transient", errors.New("timeout"), 3},
+		{"permanent", Permanent(errors.New("refund exceeds payment")), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOrchestrator(newMemoryRepository(), WithRetries(3, 0), WithStaleAfter(stale))
+
+			calls := 0
+
+			o.Register(Definition{Name: "refund", Steps: []Step{{
+				Name: "create",
+				Action: func(ctx context.Context, data Data) error {
+					calls++
+					return tt.err
+				},
+			}}})
+
+			if _, err := o.Execute(context.Background(), "refund", "saga1", Data{}); !errors.Is(err, ErrCompensated) {
+				t.Fatalf("got error %v, want %v", err, ErrCompensated)
+			}
+
+			if calls != tt.calls {
+				t.Errorf("step ran %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package saga runs multi-step workflows that span several services. Every
+// step is persisted before the next one starts, failed steps are retried and,
+// once retries are exhausted, the already completed steps are undone in
+// reverse order by their compensations.
+package saga
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	StatusRunning      = "running"
+	StatusCompensating = "compensating"
+	StatusCompleted    = "completed"
+	StatusCompensated  = "compensated"
+)
+
+var (
+	ErrCompensated       = errors.New("saga failed and was compensated")
+	ErrUnknownDefinition = errors.New("unknown saga definition")
+)
+
+// Data is the state shared between the steps of a saga, it is persisted
+// together with the saga so a resumed saga sees what earlier steps stored.
+type Data map[string]string
+
+// method of [driver.Valuer] interface
+func (d Data) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(d)
+}
+
+// method of [sql.Scanner] interface
+func (d *Data) Scan(val interface{}) error {
+	var raw []byte
+
+	switch v := val.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("expected []byte or string, got %T", val)
+	}
+
+	return json.Unmarshal(raw, d)
+}
+
+// Permanent marks an error that retrying won't fix, the step fails without
+// further attempts.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Step is a single action of a saga. Actions may run more than once when
+// retried or resumed after a crash, so they have to be idempotent.
+// Compensate undoes a completed action and may be nil if there is nothing
+// to undo.
+//
+// Retriable steps come after the point of no return, such as money that has
+// left. When one of them fails the saga isn't compensated but left running,
+// so Resume tries it again until it succeeds.
+type Step struct {
+	Name       string
+	Action     func(ctx context.Context, data Data) error
+	Compensate func(ctx context.Context, data Data) error
+	Retriable  bool
+}
+
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// State is the persisted progress of a saga. While running, Step is the
+// index of the next action. While compensating, it is the number of actions
+// that still have to be undone.
+type State struct {
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Status    string    `db:"status" json:"status"`
+	Step      int       `db:"step" json:"step"`
+	Data      Data      `db:"data" json:"data"`
+	Error     string    `db:"error" json:"error"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, s State) error
+	Update(ctx context.Context, s State) error
+	// Claim takes a running or compensating saga that hasn't been updated for
+	// at least staleAfter and marks it updated, so no other runner claims it
+	// until it goes stale again. ok is false when there is none left.
+	Claim(ctx context.Context, staleAfter time.Duration) (s State, ok bool, err error)
+	// Touch marks a saga updated without changing it.
+	Touch(ctx context.Context, id string) error
+}
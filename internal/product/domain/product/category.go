@@ -0,0 +1,65 @@
+package product
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Category groups products. Categories form a tree, top level categories
+// have no parent, and a product in a category is also in all its ancestors.
+type Category struct {
+	ID          string  `db:"id" json:"id"`
+	ParentID    *string `db:"parent_id" json:"parent_id,omitempty"`
+	Name        string  `db:"name" json:"name"`
+	Slug        string  `db:"slug" json:"slug"`
+	Description string  `db:"description" json:"description"`
+} // @name Category
+
+var (
+	ErrCategoryNotFound = &ProductError{"category not found"}
+	ErrParentNotFound   = &ProductError{"parent category not found"}
+	ErrCategoryExists   = &ProductError{"category slug already taken"}
+	ErrCategoryCycle    = &ProductError{"category can't be moved under itself"}
+	ErrCategoryInUse    = &ProductError{"category has subcategories or products"}
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidSlug reports whether s is lower case letters and digits in words
+// joined by single hyphens.
+func ValidSlug(s string) bool {
+	return slugPattern.MatchString(s)
+}
+
+// Slugify makes a slug of a name, like the categories schema migration
+// does for the categories products had.
+func Slugify(name string) string {
+	var b strings.Builder
+
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+
+		hyphen = true
+	}
+
+	return b.String()
+}
+
+type CategoryRepository interface {
+	// List returns every category, parents before their children.
+	List(ctx context.Context) ([]Category, error)
+	Get(ctx context.Context, id string) (Category, error)
+	Create(ctx context.Context, c Category) (string, error)
+	Update(ctx context.Context, id string, c Category) error
+	Delete(ctx context.Context, id string) error
+}
@@ -3,26 +3,60 @@ package product
 import (
 	"context"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 )
 
+// Product is what the catalog lists. It is sold as its variants, its Amount
+// is the stock of all of them together.
 type Product struct {
 	ID          string         `db:"id" json:"id"`
 	Name        string         `db:"name" json:"name"`
 	Description string         `db:"description" json:"description"`
-	Price       float64        `db:"price" json:"price"`
-	Category    string         `db:"category" json:"category"`
+	Price       money.Money    `db:"price" json:"price"`
+	CategoryID  string         `db:"category_id" json:"category_id"`
 	Amount      int            `db:"amount" json:"amount"`
 	AddedAt     store.OnlyDate `db:"added_at"`
 } // @name Product
 
+// Facet counts the products of a category among the matches of a search.
+type Facet struct {
+	CategoryID string `db:"category_id" json:"category_id"`
+	Name       string `db:"name" json:"name"`
+	Count      int    `db:"count" json:"count"`
+} // @name Facet
+
+// SearchResult is a page of the products matching a search, and how many
+// match in every category.
+type SearchResult struct {
+	store.Page[Product]
+	Facets []Facet
+}
+
 var (
 	ErrExists             = &ProductError{"product already exists"}
 	ErrNotFound           = &ProductError{"product not found"}
 	ErrSearch             = &ProductError{"product search error"}
 	ErrInsufficientAmount = &ProductError{"insufficient amount"}
+	ErrVariantPrices      = &ProductError{"currency can't change while variants have prices of their own"}
 )
 
+// StockUpdate changes the stock of a variant by Delta units,
+// a negative Delta decrements the stock.
+type StockUpdate struct {
+	VariantID string
+	Delta     int
+}
+
+// StockResult is the outcome of a single StockUpdate. Stock holds the
+// amount after the update or the current amount if the update failed.
+type StockResult struct {
+	VariantID string
+	Delta     int
+	Stock     int
+	Err       error
+}
+
 type ProductError struct {
 	message string
 }
@@ -36,11 +70,16 @@ func (e *ProductError) Is(err error) bool {
 }
 
 type Repository interface {
-	List(ctx context.Context) ([]Product, error)
-	Search(ctx context.Context, filter, value string) ([]Product, error)
+	List(ctx context.Context, req store.PageRequest) (store.Page[Product], error)
+	ListByCategory(ctx context.Context, categoryID string, req store.PageRequest) (store.Page[Product], error)
+	// Search matches text against names and descriptions, an empty text
+	// matches every product, and applies the filters to the other fields.
+	Search(ctx context.Context, text string, filters []store.Filter, req store.PageRequest) (SearchResult, error)
 	Get(ctx context.Context, id string) (Product, error)
-	GetPriceByID(ctx context.Context, id string) (float64, error)
-	Create(ctx context.Context, p Product) (string, error)
+	// Create makes the product with its default variant, which has the
+	// given SKU and holds the product amount.
+	Create(ctx context.Context, p Product, sku string) (string, error)
+	// Update sets the stock of the default variant to the product amount.
 	Update(ctx context.Context, id string, p Product) error
 	Delete(ctx context.Context, id string) error
 }
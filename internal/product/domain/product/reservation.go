@@ -0,0 +1,50 @@
+package product
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultReservationTTL is used when the caller doesn't ask for a specific
+// hold duration.
+const DefaultReservationTTL = 15 * time.Minute
+
+const (
+	ReservationHeld      = "held"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationReturned  = "returned"
+)
+
+// Reservation holds stock for an order until it is paid for. The reserved
+// units are taken out of the stock of their variants right away and are
+// returned when the reservation is released or expires.
+type Reservation struct {
+	ID        string            `db:"id" json:"id"`
+	OrderID   string            `db:"order_id" json:"order_id"`
+	Status    string            `db:"status" json:"status"`
+	ExpiresAt time.Time         `db:"expires_at" json:"expires_at"`
+	CreatedAt time.Time         `db:"created_at" json:"created_at"`
+	Items     []ReservationItem `db:"-" json:"items"`
+} // @name Reservation
+
+type ReservationItem struct {
+	VariantID string `db:"variant_id" json:"variant_id"`
+	Quantity  int    `db:"quantity" json:"quantity"`
+}
+
+var (
+	ErrReservationExists    = &ProductError{"reservation for order already exists"}
+	ErrReservationNotFound  = &ProductError{"reservation not found"}
+	ErrReservationExpired   = &ProductError{"reservation expired"}
+	ErrReservationReleased  = &ProductError{"reservation already released"}
+	ErrReservationCommitted = &ProductError{"reservation already committed"}
+)
+
+type ReservationRepository interface {
+	Reserve(ctx context.Context, r Reservation) ([]StockResult, error)
+	Commit(ctx context.Context, orderID string) error
+	Release(ctx context.Context, orderID string) error
+	Return(ctx context.Context, orderID string) error
+	ReleaseExpired(ctx context.Context) (int, error)
+}
@@ -0,0 +1,102 @@
+package product
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+)
+
+// Variant is a version of a product stocked and sold on its own, like a
+// size or color of a T-shirt. Every product has a default variant with the
+// product's id, made together with the product, that can't be deleted. A
+// variant without a price sells at the product price.
+type Variant struct {
+	ID        string       `db:"id" json:"id"`
+	ProductID string       `db:"product_id" json:"product_id"`
+	SKU       string       `db:"sku" json:"sku"`
+	Options   Options      `db:"options" json:"options"`
+	Price     *money.Money `db:"price" json:"price,omitempty"`
+	Amount    int          `db:"amount" json:"amount"`
+} // @name ProductVariant
+
+// Options are the attributes telling the variants of a product apart, like
+// size or color.
+type Options map[string]string
+
+// method of [driver.Valuer] interface
+func (o Options) Value() (driver.Value, error) {
+	if o == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(o)
+}
+
+// method of [sql.Scanner] interface
+func (o *Options) Scan(val interface{}) error {
+	var raw []byte
+
+	switch v := val.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("expected []byte or string, got %T", val)
+	}
+
+	return json.Unmarshal(raw, o)
+}
+
+var (
+	ErrVariantNotFound = &ProductError{"variant not found"}
+	ErrVariantExists   = &ProductError{"sku already taken"}
+	ErrDefaultVariant  = &ProductError{"default variant can't be deleted"}
+	ErrVariantInUse    = &ProductError{"variant has been ordered"}
+)
+
+// IsDefault reports whether v is the default variant of its product.
+func (v Variant) IsDefault() bool {
+	return v.ID == v.ProductID
+}
+
+// DefaultSKU is the SKU of the default variant of a product created without
+// one, the variants schema migration gives existing products the same.
+func DefaultSKU(productID string) string {
+	return "SKU-" + strings.ToUpper(productID)
+}
+
+// VariantPrice is what a variant sells at, its own price or the product
+// price.
+type VariantPrice struct {
+	ProductID string
+	Price     money.Money
+}
+
+// VariantStock is the stock of a variant along with the name of its
+// product.
+type VariantStock struct {
+	ProductID string `db:"product_id"`
+	SKU       string `db:"sku"`
+	Name      string `db:"name"`
+	Amount    int    `db:"amount"`
+}
+
+type VariantRepository interface {
+	List(ctx context.Context, productID string) ([]Variant, error)
+	Get(ctx context.Context, id string) (Variant, error)
+	GetPrice(ctx context.Context, id string) (VariantPrice, error)
+	GetStock(ctx context.Context, id string) (VariantStock, error)
+	Create(ctx context.Context, v Variant) (string, error)
+	Update(ctx context.Context, id string, v Variant) error
+	// UpdateStock changes the stock of variants and of their products.
+	UpdateStock(ctx context.Context, updates []StockUpdate) ([]StockResult, error)
+	// ReturnStock puts returned units back into stock once per return id,
+	// returning the same id again changes nothing.
+	ReturnStock(ctx context.Context, returnID string, updates []StockUpdate) ([]StockResult, error)
+	Delete(ctx context.Context, id string) error
+}
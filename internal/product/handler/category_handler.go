@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type CategoryHandler struct {
+	repo     product.CategoryRepository
+	products product.Repository
+}
+
+func NewCategoryHandler(repo product.CategoryRepository, products product.Repository) CategoryHandler {
+	return CategoryHandler{repo: repo, products: products}
+}
+
+func (h *CategoryHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	admin := authz.Require(authz.Admin)
+
+	r.Get("/", h.listCategories)
+	r.With(admin).Post("/", h.createCategory)
+
+	r.Route("/{id}", func(r chi.Router) {
+		r.Get("/", h.getCategory)
+		r.With(admin).Put("/", h.updateCategory)
+		r.With(admin).Delete("/", h.deleteCategory)
+
+		r.Get("/products", h.listCategoryProducts)
+	})
+
+	return r
+}
+
+// @Summary		List categories
+// @Description	list every category, parents before their children, to build the tree from parent_id
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}	product.Category
+// @Failure		500
+// @Router			/categories [get]
+func (h *CategoryHandler) listCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.repo.List(r.Context())
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, categories)
+}
+
+// @Summary		Create category
+// @Description	create a category, top level without parent_id. The slug is made from the name when empty
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Param			body	body		categoryRequest	true	"Category data"
+// @Success		200		{string}	string			"Category ID"
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		409		{string}	string
+// @Failure		500
+// @Router			/categories [post]
+func (h *CategoryHandler) createCategory(w http.ResponseWriter, r *http.Request) {
+	req := categoryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	req.normalize()
+
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	id, err := h.repo.Create(r.Context(), product.Category{
+		ID:          store.GenerateID(),
+		ParentID:    req.ParentID,
+		Name:        req.Name,
+		Slug:        req.Slug,
+		Description: req.Description,
+	})
+	if err != nil {
+		categoryWriteError(w, r, err)
+		return
+	}
+
+	render.PlainText(w, r, id)
+}
+
+// @Summary		Get category
+// @Description	get category by id
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Param			id	path		string	true	"Category ID"
+// @Success		200	{object}	product.Category
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/categories/{id} [get]
+func (h *CategoryHandler) getCategory(w http.ResponseWriter, r *http.Request) {
+	c, err := h.repo.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, product.ErrCategoryNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, c)
+}
+
+// @Summary		Update category
+// @Description	update category by id, moving it under another parent or to the top level without parent_id
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Param			id		path	string			true	"Category ID"
+// @Param			body	body	categoryRequest	true	"Category data"
+// @Success		200
+// @Failure		400	{array}		response.ErrorResponse
+// @Failure		404	{string}	string
+// @Failure		409	{string}	string
+// @Failure		500
+// @Router			/categories/{id} [put]
+func (h *CategoryHandler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	req := categoryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	req.normalize()
+
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	err := h.repo.Update(r.Context(), chi.URLParam(r, "id"), product.Category{
+		ParentID:    req.ParentID,
+		Name:        req.Name,
+		Slug:        req.Slug,
+		Description: req.Description,
+	})
+	if err != nil {
+		categoryWriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary		Delete category
+// @Description	delete a category without subcategories or products
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Param			id	path	string	true	"Category ID"
+// @Success		200
+// @Failure		404	{string}	string
+// @Failure		409	{string}	string
+// @Failure		500
+// @Router			/categories/{id} [delete]
+func (h *CategoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	err := h.repo.Delete(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, product.ErrCategoryNotFound):
+			response.NotFound(w, r, err)
+		case errors.Is(err, product.ErrCategoryInUse):
+			response.Conflict(w, r, err)
+		default:
+			response.InternalServerError(w, r, err)
+		}
+		return
+	}
+}
+
+// @Summary		List category products
+// @Description	list the products of a category and of all its subcategories a page at a time
+// @Tags			categories
+// @Accept			json
+// @Produce		json
+// @Param			id		path		string	true	"Category ID"
+// @Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort	query		string	false	"Sort field: name (default), price or amount"
+// @Param			order	query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[product.Product]
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		404		{string}	string
+// @Failure		500
+// @Router			/categories/{id}/products [get]
+func (h *CategoryHandler) listCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	req, err := store.PageRequestFromQuery(r.URL.Query())
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	if _, err := h.repo.Get(r.Context(), id); err != nil {
+		if errors.Is(err, product.ErrCategoryNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	p, err := h.products.ListByCategory(r.Context(), id, req)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	response.Paginated(w, r, p.Items, p.Next, p.Prev, p.Total)
+}
+
+// categoryWriteError answers the errors of creating or updating a category.
+func categoryWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, product.ErrCategoryNotFound):
+		response.NotFound(w, r, err)
+	case errors.Is(err, product.ErrCategoryExists):
+		response.Conflict(w, r, err)
+	case errors.Is(err, product.ErrParentNotFound), errors.Is(err, product.ErrCategoryCycle):
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "parent_id",
+		}})
+	default:
+		response.InternalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gatewaydocs "github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	"github.com/erazr/ecommerce-microservices/internal/common/router"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/product/docs"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+)
+
+// productRepository keeps products in memory. Methods the tests don't
+// reach panic on the nil embedded interface.
+type productRepository struct {
+	product.Repository
+
+	products map[string]product.Product
+}
+
+func (r *productRepository) page(keep func(product.Product) bool) store.Page[product.Product] {
+	page := store.Page[product.Product]{Items: []product.Product{}}
+
+	for _, p := range r.products {
+		if keep(p) {
+			page.Items = append(page.Items, p)
+		}
+	}
+
+	page.Total = len(page.Items)
+
+	return page
+}
+
+func (r *productRepository) List(ctx context.Context, req store.PageRequest) (store.Page[product.Product], error) {
+	return r.page(func(product.Product) bool { return true }), nil
+}
+
+func (r *productRepository) ListByCategory(ctx context.Context, categoryID string, req store.PageRequest) (store.Page[product.Product], error) {
+	return r.page(func(p product.Product) bool { return p.CategoryID == categoryID }), nil
+}
+
+func (r *productRepository) Search(ctx context.Context, text string, filters []store.Filter, req store.PageRequest) (product.SearchResult, error) {
+	page := r.page(func(p product.Product) bool { return strings.Contains(p.Name, text) })
+
+	return product.SearchResult{Page: page, Facets: []product.Facet{}}, nil
+}
+
+func (r *productRepository) Get(ctx context.Context, id string) (product.Product, error) {
+	p, ok := r.products[id]
+	if !ok {
+		return product.Product{}, product.ErrNotFound
+	}
+
+	return p, nil
+}
+
+func (r *productRepository) Create(ctx context.Context, p product.Product, sku string) (string, error) {
+	r.products[p.ID] = p
+
+	return p.ID, nil
+}
+
+func (r *productRepository) Update(ctx context.Context, id string, p product.Product) error {
+	p.ID = id
+	r.products[id] = p
+
+	return nil
+}
+
+func (r *productRepository) Delete(ctx context.Context, id string) error {
+	delete(r.products, id)
+
+	return nil
+}
+
+type categoryRepository struct {
+	categories map[string]product.Category
+}
+
+func (r *categoryRepository) List(ctx context.Context) ([]product.Category, error) {
+	categories := []product.Category{}
+	for _, c := range r.categories {
+		categories = append(categories, c)
+	}
+
+	return categories, nil
+}
+
+func (r *categoryRepository) Get(ctx context.Context, id string) (product.Category, error) {
+	c, ok := r.categories[id]
+	if !ok {
+		return product.Category{}, product.ErrCategoryNotFound
+	}
+
+	return c, nil
+}
+
+func (r *categoryRepository) Create(ctx context.Context, c product.Category) (string, error) {
+	r.categories[c.ID] = c
+
+	return c.ID, nil
+}
+
+func (r *categoryRepository) Update(ctx context.Context, id string, c product.Category) error {
+	c.ID = id
+	r.categories[id] = c
+
+	return nil
+}
+
+func (r *categoryRepository) Delete(ctx context.Context, id string) error {
+	delete(r.categories, id)
+
+	return nil
+}
+
+// variantRepository keeps variants in memory, the product stock isn't
+// followed. Options are stored as {} when missing, like the column default.
+type variantRepository struct {
+	product.VariantRepository
+
+	variants map[string]product.Variant
+}
+
+func (r *variantRepository) List(ctx context.Context, productID string) ([]product.Variant, error) {
+	variants := []product.Variant{}
+	for _, v := range r.variants {
+		if v.ProductID == productID {
+			variants = append(variants, v)
+		}
+	}
+
+	return variants, nil
+}
+
+func (r *variantRepository) Get(ctx context.Context, id string) (product.Variant, error) {
+	v, ok := r.variants[id]
+	if !ok {
+		return product.Variant{}, product.ErrVariantNotFound
+	}
+
+	return v, nil
+}
+
+func (r *variantRepository) Create(ctx context.Context, v product.Variant) (string, error) {
+	r.variants[v.ID] = withOptions(v)
+
+	return v.ID, nil
+}
+
+func (r *variantRepository) Update(ctx context.Context, id string, v product.Variant) error {
+	v.ID = id
+	r.variants[id] = withOptions(v)
+
+	return nil
+}
+
+func (r *variantRepository) Delete(ctx context.Context, id string) error {
+	delete(r.variants, id)
+
+	return nil
+}
+
+func withOptions(v product.Variant) product.Variant {
+	if v.Options == nil {
+		v.Options = product.Options{}
+	}
+
+	return v
+}
+
+// contractDocument merges the product document into the gateway's, as the
+// gateway does for the paths it routes to the product service.
+func contractDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+
+	doc, err := openapi.Parse(gatewaydocs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := openapi.Parse(docs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Merge("product", service, isProductPath); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func isProductPath(path string) bool {
+	return strings.HasPrefix(path, "/products") || strings.HasPrefix(path, "/categories")
+}
+
+func newRequest(method, target, role, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if role != "" {
+		req.Header.Set(auth.UserIDHeader, "user1")
+		req.Header.Set(auth.UserRoleHeader, role)
+	}
+
+	return req
+}
+
+func TestContract(t *testing.T) {
+	clothes := "clothes"
+
+	categories := &categoryRepository{categories: map[string]product.Category{
+		"clothes": {ID: "clothes", Name: "Clothes", Slug: "clothes"},
+		"shirts":  {ID: "shirts", ParentID: &clothes, Name: "Shirts", Slug: "shirts"},
+		"empty":   {ID: "empty", Name: "Empty", Slug: "empty"},
+	}}
+
+	products := &productRepository{
+		products: map[string]product.Product{
+			"tshirt": {ID: "tshirt", Name: "T-shirt", Price: money.New(500000, "KZT"), CategoryID: "shirts", Amount: 10, AddedAt: store.OnlyDate("2024-01-02")},
+			"hoodie": {ID: "hoodie", Name: "Hoodie", Price: money.New(900000, "KZT"), CategoryID: "shirts", Amount: 3, AddedAt: store.OnlyDate("2024-01-02")},
+		},
+	}
+
+	variants := &variantRepository{
+		variants: map[string]product.Variant{
+			"tshirt":   {ID: "tshirt", ProductID: "tshirt", SKU: "SKU-TSHIRT", Options: product.Options{}, Amount: 4},
+			"tshirt-l": {ID: "tshirt-l", ProductID: "tshirt", SKU: "TSHIRT-L", Options: product.Options{"size": "L"}, Amount: 6},
+			"hoodie":   {ID: "hoodie", ProductID: "hoodie", SKU: "SKU-HOODIE", Options: product.Options{}, Amount: 3},
+		},
+	}
+
+	variantHandler := NewVariantHandler(variants, products)
+	productHandler := NewProductHandler(products, variantHandler)
+	categoryHandler := NewCategoryHandler(categories, products)
+
+	r := router.New()
+	r.Use(authz.Identify)
+	r.Mount("/products", productHandler.Routes())
+	r.Mount("/categories", categoryHandler.Routes())
+
+	contract := openapi.NewContract(contractDocument(t), r)
+
+	const (
+		anonymous = ""
+		admin     = authz.RoleAdmin
+	)
+
+	productBody := `{"name":"Cap","price":{"amount":"1500.00","currency":"KZT"},"category_id":"clothes","amount":5,"added_at":"2024-01-03"}`
+
+	tests := []struct {
+		method string
+		target string
+		role   string
+		body   string
+	}{
+		{http.MethodGet, "/products", anonymous, ""},
+		{http.MethodPost, "/products", admin, productBody},
+		{http.MethodGet, "/products/search?q=shirt", anonymous, ""},
+		{http.MethodGet, "/products/tshirt", anonymous, ""},
+		{http.MethodPut, "/products/tshirt", admin, productBody},
+		{http.MethodDelete, "/products/hoodie", admin, ""},
+		{http.MethodGet, "/products/tshirt/variants", anonymous, ""},
+		{http.MethodPost, "/products/tshirt/variants", admin, `{"sku":"TSHIRT-M","options":{"size":"M"},"amount":2}`},
+		{http.MethodGet, "/products/tshirt/variants/tshirt-l", anonymous, ""},
+		{http.MethodPut, "/products/tshirt/variants/tshirt-l", admin, `{"sku":"TSHIRT-L","price":{"amount":"5500.00","currency":"KZT"},"amount":7}`},
+		{http.MethodDelete, "/products/tshirt/variants/tshirt-l", admin, ""},
+		{http.MethodGet, "/categories", anonymous, ""},
+		{http.MethodPost, "/categories", admin, `{"name":"Hats","parent_id":"clothes"}`},
+		{http.MethodGet, "/categories/shirts", anonymous, ""},
+		{http.MethodPut, "/categories/empty", admin, `{"name":"Empty","description":"nothing yet"}`},
+		{http.MethodDelete, "/categories/empty", admin, ""},
+		{http.MethodGet, "/categories/shirts/products", anonymous, ""},
+	}
+
+	for _, tt := range tests {
+		rec, err := contract.Do(newRequest(tt.method, tt.target, tt.role, tt.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if rec.Code >= http.StatusBadRequest {
+			t.Errorf("%s %s: got status %d: %s", tt.method, tt.target, rec.Code, rec.Body)
+		}
+	}
+
+	if unserved := contract.Unserved(isProductPath); len(unserved) > 0 {
+		t.Errorf("operations without a test: %v", unserved)
+	}
+}
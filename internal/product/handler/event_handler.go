@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+)
+
+type ProductEventHandler struct {
+	reservations product.ReservationRepository
+}
+
+func NewProductEventHandler(reservations product.ReservationRepository) *ProductEventHandler {
+	return &ProductEventHandler{
+		reservations: reservations,
+	}
+}
+
+func (h *ProductEventHandler) Subscribe(s events.Subscriber) {
+	s.Subscribe(events.PaymentSucceeded, h.paymentSucceeded)
+}
+
+// paymentSucceeded makes sure the stock of a paid order is committed even if
+// the checkout didn't get to it.
+func (h *ProductEventHandler) paymentSucceeded(ctx context.Context, e events.Event) error {
+	payload := events.PaymentSucceededPayload{}
+	if err := e.Decode(&payload); err != nil {
+		return err
+	}
+
+	err := h.reservations.Commit(ctx, payload.OrderID)
+
+	var perr *product.ProductError
+	if errors.As(err, &perr) {
+		fmt.Printf("Committing reservation for paid order %s: %v\n", payload.OrderID, err)
+		return nil
+	}
+
+	return err
+}
@@ -2,94 +2,109 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	moneypb "github.com/erazr/ecommerce-microservices/internal/common/pb/money"
 	productProto "github.com/erazr/ecommerce-microservices/internal/common/pb/product"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ProductGRPCHandler struct {
-	repo product.Repository
+	variants product.VariantRepository
+
+	reservations product.ReservationRepository
 
 	productProto.UnimplementedProductsServer
 }
 
-func NewProductGRPCHandler(repo product.Repository) *ProductGRPCHandler {
+func NewProductGRPCHandler(variants product.VariantRepository, reservations product.ReservationRepository) *ProductGRPCHandler {
 	return &ProductGRPCHandler{
-		repo: repo,
+		variants:     variants,
+		reservations: reservations,
 	}
 }
 
+// GRPCCallers lists the services allowed to call each RPC.
+var GRPCCallers = map[string][]string{
+	"/api.proto.Products/GetProductPrices":   {"order"},
+	"/api.proto.Products/ProductsAvailable":  {"order", "payment"},
+	"/api.proto.Products/ReserveStock":       {"order"},
+	"/api.proto.Products/ReleaseReservation": {"order"},
+	"/api.proto.Products/CommitReservation":  {"payment"},
+	"/api.proto.Products/ReturnReservation":  {"payment"},
+	"/api.proto.Products/ReturnStock":        {"payment"},
+	"/api.proto.Products/UpdateProductStock": {"payment"},
+}
+
+// UpdateProductStock applies the whole batch atomically: if any variant is
+// missing or would go below zero nothing is changed and every item is
+// reported as failed, with the offending ones carrying the reason.
 func (h *ProductGRPCHandler) UpdateProductStock(ctx context.Context, req *productProto.UpdateProductStockRequest) (*productProto.UpdateProductStockResponse, error) {
-	var (
-		success bool
-		message string
-	)
+	updates := make([]product.StockUpdate, 0, len(req.Updates))
 
 	for _, u := range req.Updates {
-		p, err := h.repo.Get(ctx, u.ProductId)
-		if err != nil {
-			return nil, err
+		if u.GetQuantity() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity for variant with id %s must be greater than 0", u.VariantId)
 		}
 
-		switch u.UpdateType {
-		case productProto.UpdateType_INCREMENT:
-			p.Amount += int(u.GetQuantity())
-
-			err = h.repo.Update(ctx, p.ID, p)
-			if err != nil {
-				return nil, err
-			}
-
-			success = true
-			message = fmt.Sprintf("stock for product with id %s incremented by %d", u.ProductId, u.GetQuantity())
-
-		case productProto.UpdateType_DECREMENT:
-			if p.Amount < int(u.GetQuantity()) {
-				return &productProto.UpdateProductStockResponse{
-					Success: false,
-					Message: fmt.Sprintf("not enough stock for product with id %s", u.ProductId),
-				}, nil
-			}
+		delta := int(u.GetQuantity())
+		if u.UpdateType == productProto.UpdateType_DECREMENT {
+			delta = -delta
+		}
 
-			err = h.repo.Update(ctx, p.ID, p)
-			if err != nil {
-				return nil, err
-			}
+		updates = append(updates, product.StockUpdate{
+			VariantID: u.VariantId,
+			Delta:     delta,
+		})
+	}
 
-			p.Amount -= int(u.GetQuantity())
-			success = true
-			message = fmt.Sprintf("stock for product with id %s decremented by %d", u.ProductId, u.GetQuantity())
-		}
+	results, err := h.variants.UpdateStock(ctx, updates)
+	if err != nil && !errors.Is(err, product.ErrVariantNotFound) && !errors.Is(err, product.ErrInsufficientAmount) {
+		return nil, err
+	}
 
+	resp := &productProto.UpdateProductStockResponse{
+		Success: err == nil,
 	}
 
-	return &productProto.UpdateProductStockResponse{
-		Success: success,
-		Message: message,
-	}, nil
+	resp.Results, resp.Message = stockResults(results, err)
+
+	return resp, nil
 }
 
+// ProductsAvailable tells whether each variant has as many units in stock as
+// it is listed in the request.
 func (h *ProductGRPCHandler) ProductsAvailable(ctx context.Context, req *productProto.ProductsAvailableRequest) (*productProto.ProductsAvailableResponse, error) {
-	products := make(map[string]int)
+	variants := make(map[string]int)
 
 	availables := make([]*productProto.ProductAvailability, 0)
 
-	for _, id := range req.ProductIds {
-		products[id]++
+	for _, id := range req.VariantIds {
+		variants[id]++
 	}
 
-	for _, id := range req.ProductIds {
-		p, err := h.repo.Get(ctx, id)
+	for _, id := range req.VariantIds {
+		s, err := h.variants.GetStock(ctx, id)
 		if err != nil {
+			if errors.Is(err, product.ErrVariantNotFound) {
+				return nil, status.Errorf(codes.NotFound, "variant %s not found", id)
+			}
+
 			return nil, err
 		}
 
 		availables = append(availables, &productProto.ProductAvailability{
-			ProductId: id,
-			Available: p.Amount >= products[id],
-			Name:      p.Name,
-			Stock:     int32(p.Amount),
+			VariantId: id,
+			ProductId: s.ProductID,
+			Sku:       s.SKU,
+			Available: s.Amount >= variants[id],
+			Name:      s.Name,
+			Stock:     int32(s.Amount),
 		})
 	}
 
@@ -98,19 +113,205 @@ func (h *ProductGRPCHandler) ProductsAvailable(ctx context.Context, req *product
 	}, nil
 }
 
+// GetProductPrices returns the price of each variant and the product it
+// belongs to.
 func (h *ProductGRPCHandler) GetProductPrices(ctx context.Context, req *productProto.GetProductPricesRequest) (*productProto.GetProductPricesResponse, error) {
-	prices := make(map[string]float32)
+	prices := make(map[string]*moneypb.Money)
+	productIDs := make(map[string]string)
 
-	for _, id := range req.ProductIds {
-		price, err := h.repo.GetPriceByID(ctx, id)
+	for _, id := range req.VariantIds {
+		price, err := h.variants.GetPrice(ctx, id)
 		if err != nil {
+			if errors.Is(err, product.ErrVariantNotFound) {
+				return nil, status.Errorf(codes.NotFound, "variant %s not found", id)
+			}
+
 			return nil, err
 		}
 
-		prices[id] += float32(price)
+		prices[id] = price.Price.Proto()
+		productIDs[id] = price.ProductID
 	}
 
 	return &productProto.GetProductPricesResponse{
-		Prices: prices,
+		Prices:     prices,
+		ProductIds: productIDs,
 	}, nil
 }
+
+// ReserveStock holds stock for an order until the reservation is committed,
+// released or expires. Unlike UpdateProductStock only the offending items of
+// a failed reservation are reported as failed, so the order service can point
+// its client at them.
+func (h *ProductGRPCHandler) ReserveStock(ctx context.Context, req *productProto.ReserveStockRequest) (*productProto.ReserveStockResponse, error) {
+	if req.GetOrderId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order id is required")
+	}
+
+	ttl := product.DefaultReservationTTL
+	if req.GetTtlSeconds() > 0 {
+		ttl = time.Duration(req.GetTtlSeconds()) * time.Second
+	}
+
+	res := product.Reservation{
+		ID:        store.GenerateID(),
+		OrderID:   req.GetOrderId(),
+		ExpiresAt: time.Now().Add(ttl),
+		Items:     []product.ReservationItem{},
+	}
+
+	quantities := make(map[string]int)
+
+	for _, item := range req.Items {
+		if item.GetQuantity() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity for variant with id %s must be greater than 0", item.VariantId)
+		}
+
+		if _, ok := quantities[item.VariantId]; !ok {
+			res.Items = append(res.Items, product.ReservationItem{VariantID: item.VariantId})
+		}
+
+		quantities[item.VariantId] += int(item.GetQuantity())
+	}
+
+	for i := range res.Items {
+		res.Items[i].Quantity = quantities[res.Items[i].VariantID]
+	}
+
+	results, err := h.reservations.Reserve(ctx, res)
+	if errors.Is(err, product.ErrReservationExists) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil && !errors.Is(err, product.ErrVariantNotFound) && !errors.Is(err, product.ErrInsufficientAmount) {
+		return nil, err
+	}
+
+	resp := &productProto.ReserveStockResponse{
+		Success: err == nil,
+	}
+
+	resp.Results, resp.Message = stockResults(results, err)
+
+	for i, result := range results {
+		resp.Results[i].Success = result.Err == nil
+	}
+
+	if resp.Success {
+		resp.ReservationId = res.ID
+		resp.ExpiresAt = res.ExpiresAt.Unix()
+		resp.Message = fmt.Sprintf("stock reserved for order with id %s", res.OrderID)
+	}
+
+	return resp, nil
+}
+
+func (h *ProductGRPCHandler) CommitReservation(ctx context.Context, req *productProto.ReservationRequest) (*productProto.ReservationResponse, error) {
+	err := h.reservations.Commit(ctx, req.GetOrderId())
+
+	return reservationResponse(err, fmt.Sprintf("reservation for order with id %s committed", req.GetOrderId()))
+}
+
+func (h *ProductGRPCHandler) ReleaseReservation(ctx context.Context, req *productProto.ReservationRequest) (*productProto.ReservationResponse, error) {
+	err := h.reservations.Release(ctx, req.GetOrderId())
+
+	return reservationResponse(err, fmt.Sprintf("reservation for order with id %s released", req.GetOrderId()))
+}
+
+// ReturnReservation puts the units of a committed reservation back into
+// stock once, repeating it for the same order changes nothing.
+func (h *ProductGRPCHandler) ReturnReservation(ctx context.Context, req *productProto.ReservationRequest) (*productProto.ReservationResponse, error) {
+	err := h.reservations.Return(ctx, req.GetOrderId())
+
+	return reservationResponse(err, fmt.Sprintf("reservation for order with id %s returned", req.GetOrderId()))
+}
+
+// ReturnStock puts sold units back into stock once per return id, such as
+// the items of a refund. A variant that no longer exists fails the return
+// without changing anything.
+func (h *ProductGRPCHandler) ReturnStock(ctx context.Context, req *productProto.ReturnStockRequest) (*productProto.ReturnStockResponse, error) {
+	if req.GetReturnId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "return id is required")
+	}
+
+	updates := make([]product.StockUpdate, 0, len(req.Items))
+
+	for _, item := range req.Items {
+		if item.GetQuantity() <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quantity for variant with id %s must be greater than 0", item.VariantId)
+		}
+
+		updates = append(updates, product.StockUpdate{
+			VariantID: item.VariantId,
+			Delta:     int(item.GetQuantity()),
+		})
+	}
+
+	_, err := h.variants.ReturnStock(ctx, req.GetReturnId(), updates)
+	if errors.Is(err, product.ErrVariantNotFound) {
+		return &productProto.ReturnStockResponse{Success: false, Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &productProto.ReturnStockResponse{
+		Success: true,
+		Message: fmt.Sprintf("stock of return with id %s put back", req.GetReturnId()),
+	}, nil
+}
+
+func reservationResponse(err error, message string) (*productProto.ReservationResponse, error) {
+	var perr *product.ProductError
+
+	switch {
+	case errors.Is(err, product.ErrReservationNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &perr):
+		return &productProto.ReservationResponse{Success: false, Message: err.Error()}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &productProto.ReservationResponse{Success: true, Message: message}, nil
+}
+
+// stockResults converts repository results into their proto form along with
+// a summary message.
+func stockResults(results []product.StockResult, err error) ([]*productProto.UpdateProductResult, string) {
+	var message string
+
+	items := make([]*productProto.UpdateProductResult, 0, len(results))
+
+	for _, res := range results {
+		item := &productProto.UpdateProductResult{
+			VariantId: res.VariantID,
+			Success:   err == nil,
+			Stock:     int32(res.Stock),
+		}
+
+		switch {
+		case errors.Is(res.Err, product.ErrVariantNotFound):
+			item.Message = fmt.Sprintf("variant with id %s not found", res.VariantID)
+		case errors.Is(res.Err, product.ErrInsufficientAmount):
+			item.Message = fmt.Sprintf("not enough stock for variant with id %s", res.VariantID)
+		case err != nil:
+			item.Message = fmt.Sprintf("stock update for variant with id %s rolled back", res.VariantID)
+		case res.Delta >= 0:
+			item.Message = fmt.Sprintf("stock for variant with id %s incremented by %d", res.VariantID, res.Delta)
+		default:
+			item.Message = fmt.Sprintf("stock for variant with id %s decremented by %d", res.VariantID, -res.Delta)
+		}
+
+		if res.Err != nil && message == "" {
+			message = item.Message
+		}
+
+		items = append(items, item)
+	}
+
+	if err == nil {
+		message = fmt.Sprintf("stock updated for %d variants", len(items))
+	}
+
+	return items, message
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
@@ -14,22 +16,28 @@ import (
 
 type ProductHandler struct {
 	repo product.Repository
+
+	variants VariantHandler
 }
 
-func NewProductHandler(repo product.Repository) ProductHandler {
-	return ProductHandler{repo: repo}
+func NewProductHandler(repo product.Repository, variants VariantHandler) ProductHandler {
+	return ProductHandler{repo: repo, variants: variants}
 }
 
 func (h *ProductHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
+	admin := authz.Require(authz.Admin)
+
 	r.Get("/", h.listProducts)
-	r.Post("/", h.createProduct)
+	r.With(admin).Post("/", h.createProduct)
 
 	r.Route("/{id}", func(r chi.Router) {
 		r.Get("/", h.getProduct)
-		r.Put("/", h.updateProduct)
-		r.Delete("/", h.deleteProduct)
+		r.With(admin).Put("/", h.updateProduct)
+		r.With(admin).Delete("/", h.deleteProduct)
+
+		r.Mount("/variants", h.variants.Routes())
 	})
 
 	r.Get("/search", h.searchProduct)
@@ -38,15 +46,17 @@ func (h *ProductHandler) Routes() chi.Router {
 }
 
 //	@Summary		update products
-//	@Description	update product by id
+//	@Description	update product by id, the amount is the stock of its default variant. The currency can't change while variants have prices of their own
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
 //	@Param			id		path	string	true	"Product ID"
 //	@Param			body	body	request	true	"Product data"
 //	@Success		200
+//	@Failure		400	{array}		response.ErrorResponse
 //	@Failure		500
 //	@Failure		404	{string}	string
+//	@Failure		409	{string}	string
 //	@Router			/products/{id} [put]
 func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -69,7 +79,7 @@ func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
-		Category:    req.Category,
+		CategoryID:  req.CategoryID,
 		Amount:      req.Amount,
 		AddedAt:     store.OnlyDate(req.AddedAt),
 	})
@@ -79,6 +89,16 @@ func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, product.ErrCategoryNotFound) {
+			categoryNotFound(w, r, err)
+			return
+		}
+
+		if errors.Is(err, product.ErrVariantPrices) {
+			response.Conflict(w, r, err)
+			return
+		}
+
 		response.InternalServerError(w, r, err)
 		return
 	}
@@ -88,13 +108,14 @@ func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 //	@Summary		Create product
-//	@Description	create product
+//	@Description	create product with its default variant, which holds the amount and has the product id. The sku is made from the id when empty
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
 //	@Param			body	body		request	true	"Product data"
 //	@Success		200		{string}	string	"Product ID"
 //	@Failure		400		{array}		response.ErrorResponse
+//	@Failure		409		{string}	string
 //	@Failure		500
 //	@Router			/products [post]
 func (h *ProductHandler) createProduct(w http.ResponseWriter, r *http.Request) {
@@ -112,17 +133,33 @@ func (h *ProductHandler) createProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := h.repo.Create(r.Context(), product.Product{
+	p := product.Product{
 		ID:          store.GenerateID(),
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
-		Category:    req.Category,
+		CategoryID:  req.CategoryID,
 		Amount:      req.Amount,
 		AddedAt:     store.OnlyDate(req.AddedAt),
-	})
+	}
+
+	if req.SKU == "" {
+		req.SKU = product.DefaultSKU(p.ID)
+	}
+
+	id, err := h.repo.Create(r.Context(), p, req.SKU)
 
 	if err != nil {
+		if errors.Is(err, product.ErrCategoryNotFound) {
+			categoryNotFound(w, r, err)
+			return
+		}
+
+		if errors.Is(err, product.ErrVariantExists) {
+			response.Conflict(w, r, err)
+			return
+		}
+
 		response.InternalServerError(w, r, err)
 		return
 	}
@@ -183,67 +220,103 @@ func (h *ProductHandler) getProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 //	@Summary		Search product
-//	@Description	search product
+//	@Description	search products by text in their names and descriptions, tolerating typos, with field=value, field[in]=a,b, field[like]=text or field[range]=low,high filters combined with AND. Fields: name, description, category_id, currency, price, amount, in_stock. Facets count the matches per category, ignoring category_id filters
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
+//	@Param			q			query		string	false	"Text to search, like a web search: quoted phrases, or, -word"
 //	@Param			name		query		string	false	"Product name"
-//	@Param			category	query		string	false	"Product category"
-//	@Success		200			{array}		product.Product
-//	@Failure		404			{string}	string
+//	@Param			category_id	query		string	false	"Category ID, without its subcategories"
+//	@Param			price[range]	query	string	false	"Lowest and highest price, either may be empty: 10,50"
+//	@Param			in_stock	query		bool	false	"Only products in stock, or out of it"
+//	@Param			limit		query		int		false	"Page size, 20 by default and at most 100"
+//	@Param			sort		query		string	false	"Sort field: relevance (default with q, descending), name (default), price or amount"
+//	@Param			order		query		string	false	"Sort direction: asc (default) or desc"
+//	@Param			cursor		query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+//	@Success		200			{object}	searchResponse
+//	@Failure		400			{array}		response.ErrorResponse
 //	@Failure		500
 //	@Router			/products/search [get]
 func (h *ProductHandler) searchProduct(w http.ResponseWriter, r *http.Request) {
-	name := r.URL.Query().Get("name")
-	category := r.URL.Query().Get("category")
-
-	if name != "" {
-		p, err := h.repo.Search(r.Context(), "name", name)
-		if err != nil {
-			if errors.Is(err, product.ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
-
-			response.InternalServerError(w, r, err)
-			return
-		}
+	query := r.URL.Query()
 
-		render.JSON(w, r, p)
+	req, err := store.PageRequestFromQuery(query)
+	if err != nil {
+		queryError(w, r, err)
 		return
 	}
 
-	if category != "" {
-		p, err := h.repo.Search(r.Context(), "category", category)
-		if err != nil {
-			if errors.Is(err, product.ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
+	text := strings.TrimSpace(query.Get("q"))
 
-			response.InternalServerError(w, r, err)
-			return
-		}
+	filters, err := store.FiltersFromQuery(query, append(store.PageParams, "q")...)
+	if err == nil && text == "" && len(filters) == 0 {
+		err = &store.FilterError{Field: "query", Message: "empty query"}
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	res, err := h.repo.Search(r.Context(), text, filters, req)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	response.OK(w, r, searchResponse{
+		Page:   response.NewPage(res.Items, res.Next, res.Prev, res.Total),
+		Facets: res.Facets,
+	})
+}
 
-		render.JSON(w, r, p)
+// categoryNotFound answers products in a category that doesn't exist.
+func categoryNotFound(w http.ResponseWriter, r *http.Request, err error) {
+	response.BadRequest(w, r, []response.ErrorResponse{{
+		Message: err.Error(),
+		Field:   "category_id",
+	}})
+}
+
+// queryError answers filters and page requests the repository doesn't take
+// with 400.
+func queryError(w http.ResponseWriter, r *http.Request, err error) {
+	var filterErr *store.FilterError
+	if errors.As(err, &filterErr) {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: filterErr.Message,
+			Field:   filterErr.Field,
+		}})
 		return
 	}
+
+	response.InternalServerError(w, r, err)
 }
 
 //	@Summary		List products
-//	@Description	list all products
+//	@Description	list products a page at a time
 //	@Tags			products
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{array}	product.Product
+//	@Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+//	@Param			sort	query		string	false	"Sort field: name (default), price or amount"
+//	@Param			order	query		string	false	"Sort direction: asc (default) or desc"
+//	@Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+//	@Success		200		{object}	response.Page[product.Product]
+//	@Failure		400		{array}		response.ErrorResponse
 //	@Failure		500
 //	@Router			/products [get]
 func (h *ProductHandler) listProducts(w http.ResponseWriter, r *http.Request) {
-	p, err := h.repo.List(r.Context())
+	req, err := store.PageRequestFromQuery(r.URL.Query())
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
 		return
 	}
 
-	render.JSON(w, r, p)
+	p, err := h.repo.List(r.Context(), req)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
+
+	response.Paginated(w, r, p.Items, p.Next, p.Prev, p.Total)
 }
@@ -1,17 +1,113 @@
 package handler
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
 )
 
 type request struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	CategoryID  string      `json:"category_id"`
+	Amount      int         `json:"amount"`
+	AddedAt     string      `json:"added_at"`
+	// SKU of the default variant, only read on create
+	SKU string `json:"sku"`
+} // @name ProductRequest
+
+// maxSKULength is the size of the sku column.
+const maxSKULength = 64
+
+type variantRequest struct {
+	SKU     string          `json:"sku"`
+	Options product.Options `json:"options"`
+	// Price overrides the product price, without it the variant sells at
+	// the product price
+	Price  *money.Money `json:"price"`
+	Amount int          `json:"amount"`
+} // @name ProductVariantRequest
+
+func (r *variantRequest) Validate() []response.ErrorResponse {
+	var errs []response.ErrorResponse
+
+	r.SKU = strings.TrimSpace(r.SKU)
+
+	if r.SKU == "" || len(r.SKU) > maxSKULength {
+		errs = append(errs, response.ErrorResponse{
+			Message: fmt.Sprintf("sku is required and at most %d characters", maxSKULength),
+			Field:   "sku",
+		})
+	}
+
+	if r.Price != nil && !r.Price.IsPositive() {
+		errs = append(errs, response.ErrorResponse{
+			Message: "price must be greater than 0",
+			Field:   "price",
+		})
+	}
+
+	if r.Amount < 0 {
+		errs = append(errs, response.ErrorResponse{
+			Message: "amount can't be negative",
+			Field:   "amount",
+		})
+	}
+
+	return errs
+}
+
+type categoryRequest struct {
+	ParentID    *string `json:"parent_id"`
 	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
 	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Category    string  `json:"category"`
-	Amount      int     `json:"amount"`
-	AddedAt     string  `json:"added_at"`
-} // @name ProductRequest
+} // @name CategoryRequest
+
+// normalize makes a slug of the name when the request has none, and takes
+// an empty parent for no parent.
+func (r *categoryRequest) normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+
+	if r.Slug == "" {
+		r.Slug = product.Slugify(r.Name)
+	}
+
+	if r.ParentID != nil && *r.ParentID == "" {
+		r.ParentID = nil
+	}
+}
+
+func (r *categoryRequest) Validate() []response.ErrorResponse {
+	var errs []response.ErrorResponse
+
+	if r.Name == "" {
+		errs = append(errs, response.ErrorResponse{
+			Message: "name is required",
+			Field:   "name",
+		})
+	}
+
+	if !product.ValidSlug(r.Slug) {
+		errs = append(errs, response.ErrorResponse{
+			Message: "slug must be lower case letters and digits joined by hyphens",
+			Field:   "slug",
+		})
+	}
+
+	return errs
+}
+
+// searchResponse is a page of the matching products with the count of
+// matches in every category.
+type searchResponse struct {
+	response.Page[product.Product]
+	Facets []product.Facet `json:"facets"`
+} // @name ProductSearch
 
 func (r *request) Validate() []response.ErrorResponse {
 	var errs []response.ErrorResponse
@@ -23,17 +119,17 @@ func (r *request) Validate() []response.ErrorResponse {
 		})
 	}
 
-	if r.Price <= 0 {
+	if !r.Price.IsPositive() {
 		errs = append(errs, response.ErrorResponse{
 			Message: "price must be greater than 0",
 			Field:   "price",
 		})
 	}
 
-	if r.Category == "" {
+	if r.CategoryID == "" {
 		errs = append(errs, response.ErrorResponse{
-			Message: "category is required",
-			Field:   "category",
+			Message: "category_id is required",
+			Field:   "category_id",
 		})
 	}
 
@@ -44,5 +140,14 @@ func (r *request) Validate() []response.ErrorResponse {
 		})
 	}
 
+	r.SKU = strings.TrimSpace(r.SKU)
+
+	if len(r.SKU) > maxSKULength {
+		errs = append(errs, response.ErrorResponse{
+			Message: fmt.Sprintf("sku must be at most %d characters", maxSKULength),
+			Field:   "sku",
+		})
+	}
+
 	return errs
 }
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// VariantHandler serves the variants of a product, it is mounted under the
+// product routes.
+type VariantHandler struct {
+	repo     product.VariantRepository
+	products product.Repository
+}
+
+func NewVariantHandler(repo product.VariantRepository, products product.Repository) VariantHandler {
+	return VariantHandler{repo: repo, products: products}
+}
+
+func (h *VariantHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	admin := authz.Require(authz.Admin)
+
+	r.Get("/", h.listVariants)
+	r.With(admin).Post("/", h.createVariant)
+
+	r.Route("/{variantID}", func(r chi.Router) {
+		r.Get("/", h.getVariant)
+		r.With(admin).Put("/", h.updateVariant)
+		r.With(admin).Delete("/", h.deleteVariant)
+	})
+
+	return r
+}
+
+// @Summary		List product variants
+// @Description	list the variants of a product, the default variant with the product id first
+// @Tags			products
+// @Accept			json
+// @Produce		json
+// @Param			id	path	string	true	"Product ID"
+// @Success		200	{array}	product.Variant
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/products/{id}/variants [get]
+func (h *VariantHandler) listVariants(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if _, err := h.products.Get(r.Context(), id); err != nil {
+		if errors.Is(err, product.ErrNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	variants, err := h.repo.List(r.Context(), id)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, variants)
+}
+
+// @Summary		Create product variant
+// @Description	create a variant of a product with its own SKU, options and stock. Without a price it sells at the product price
+// @Tags			products
+// @Accept			json
+// @Produce		json
+// @Param			id		path		string			true	"Product ID"
+// @Param			body	body		variantRequest	true	"Variant data"
+// @Success		200		{string}	string			"Variant ID"
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		404		{string}	string
+// @Failure		409		{string}	string
+// @Failure		500
+// @Router			/products/{id}/variants [post]
+func (h *VariantHandler) createVariant(w http.ResponseWriter, r *http.Request) {
+	req := variantRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	id, err := h.repo.Create(r.Context(), product.Variant{
+		ID:        store.GenerateID(),
+		ProductID: chi.URLParam(r, "id"),
+		SKU:       req.SKU,
+		Options:   req.Options,
+		Price:     req.Price,
+		Amount:    req.Amount,
+	})
+	if err != nil {
+		variantWriteError(w, r, err)
+		return
+	}
+
+	render.PlainText(w, r, id)
+}
+
+// @Summary		Get product variant
+// @Description	get a variant of a product by id
+// @Tags			products
+// @Accept			json
+// @Produce		json
+// @Param			id			path		string	true	"Product ID"
+// @Param			variantID	path		string	true	"Variant ID"
+// @Success		200			{object}	product.Variant
+// @Failure		404			{string}	string
+// @Failure		500
+// @Router			/products/{id}/variants/{variantID} [get]
+func (h *VariantHandler) getVariant(w http.ResponseWriter, r *http.Request) {
+	v, err := h.variant(r)
+	if err != nil {
+		if errors.Is(err, product.ErrVariantNotFound) {
+			response.NotFound(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, v)
+}
+
+// @Summary		Update product variant
+// @Description	update a variant of a product by id, the product amount follows its stock
+// @Tags			products
+// @Accept			json
+// @Produce		json
+// @Param			id			path	string			true	"Product ID"
+// @Param			variantID	path	string			true	"Variant ID"
+// @Param			body		body	variantRequest	true	"Variant data"
+// @Success		200
+// @Failure		400	{array}		response.ErrorResponse
+// @Failure		404	{string}	string
+// @Failure		409	{string}	string
+// @Failure		500
+// @Router			/products/{id}/variants/{variantID} [put]
+func (h *VariantHandler) updateVariant(w http.ResponseWriter, r *http.Request) {
+	req := variantRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	if errs := req.Validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	err := h.repo.Update(r.Context(), chi.URLParam(r, "variantID"), product.Variant{
+		ProductID: chi.URLParam(r, "id"),
+		SKU:       req.SKU,
+		Options:   req.Options,
+		Price:     req.Price,
+		Amount:    req.Amount,
+	})
+	if err != nil {
+		variantWriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary		Delete product variant
+// @Description	delete a variant that was never ordered, the default variant only goes with its product
+// @Tags			products
+// @Accept			json
+// @Produce		json
+// @Param			id			path	string	true	"Product ID"
+// @Param			variantID	path	string	true	"Variant ID"
+// @Success		200
+// @Failure		404	{string}	string
+// @Failure		409	{string}	string
+// @Failure		500
+// @Router			/products/{id}/variants/{variantID} [delete]
+func (h *VariantHandler) deleteVariant(w http.ResponseWriter, r *http.Request) {
+	v, err := h.variant(r)
+	if err == nil {
+		err = h.repo.Delete(r.Context(), v.ID)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, product.ErrVariantNotFound):
+			response.NotFound(w, r, err)
+		case errors.Is(err, product.ErrDefaultVariant), errors.Is(err, product.ErrVariantInUse):
+			response.Conflict(w, r, err)
+		default:
+			response.InternalServerError(w, r, err)
+		}
+		return
+	}
+}
+
+// variant returns the variant of the request path, variants of other
+// products aren't found.
+func (h *VariantHandler) variant(r *http.Request) (product.Variant, error) {
+	v, err := h.repo.Get(r.Context(), chi.URLParam(r, "variantID"))
+	if err != nil {
+		return v, err
+	}
+
+	if v.ProductID != chi.URLParam(r, "id") {
+		return product.Variant{}, product.ErrVariantNotFound
+	}
+
+	return v, nil
+}
+
+// variantWriteError answers the errors of creating or updating a variant.
+func variantWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, product.ErrNotFound), errors.Is(err, product.ErrVariantNotFound):
+		response.NotFound(w, r, err)
+	case errors.Is(err, product.ErrVariantExists):
+		response.Conflict(w, r, err)
+	case errors.Is(err, money.ErrCurrencyMismatch):
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: "price must be in the currency of the product",
+			Field:   "price",
+		}})
+	default:
+		response.InternalServerError(w, r, err)
+	}
+}
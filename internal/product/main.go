@@ -8,15 +8,24 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
 	"github.com/erazr/ecommerce-microservices/internal/common/pb/product"
 	"github.com/erazr/ecommerce-microservices/internal/common/router"
 	"github.com/erazr/ecommerce-microservices/internal/common/server"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/product/docs"
 	"github.com/erazr/ecommerce-microservices/internal/product/handler"
 	"github.com/erazr/ecommerce-microservices/internal/product/repository"
+	"github.com/erazr/ecommerce-microservices/internal/product/sweeper"
 	"google.golang.org/grpc"
 )
 
+//	@title			E-commerce Microservices Product Service
+//	@version		1.0
+//	@description	Manages the product catalog, its categories and its stock.
+
 func main() {
 	db, err := store.New(os.Getenv("DB_URL"))
 	if err != nil {
@@ -24,17 +33,55 @@ func main() {
 	}
 
 	productRepository := repository.NewProductRepository(db.Client)
+	categoryRepository := repository.NewCategoryRepository(db.Client)
+	variantRepository := repository.NewVariantRepository(db.Client)
+	reservationRepository := repository.NewReservationRepository(db.Client)
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	go sweeper.New(reservationRepository, time.Minute).Run(background)
+
+	bus := events.NewPostgresBus(db.Client, os.Getenv("DB_URL"), "product")
+	handler.NewProductEventHandler(reservationRepository).Subscribe(bus)
 
-	grpcServer := grpc.NewServer()
-	grpcHandler := handler.NewProductGRPCHandler(productRepository)
-	product.RegisterProductsServer(grpcServer, grpcHandler)
+	relayConfigs := []func(*events.Relay){}
+	if retention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil {
+		relayConfigs = append(relayConfigs, events.WithRetention(retention))
+	}
 
-	productHandler := handler.NewProductHandler(productRepository)
+	go events.NewRelay(db.Client, bus, relayConfigs...).Run(background)
+	go func() {
+		if err := bus.Listen(background); err != nil {
+			fmt.Printf("Event listener stopped: %v\n", err)
+		}
+	}()
+
+	grpcTLS, err := server.LoadGRPCTLS(os.Getenv("GRPC_TLS_DIR"), "product")
+	if err != nil {
+		panic(err)
+	}
+
+	grpcHandler := handler.NewProductGRPCHandler(variantRepository, reservationRepository)
+
+	variantHandler := handler.NewVariantHandler(variantRepository, productRepository)
+	productHandler := handler.NewProductHandler(productRepository, variantHandler)
+	categoryHandler := handler.NewCategoryHandler(categoryRepository, productRepository)
 
 	r := router.New()
+	r.Use(authz.Identify)
 	r.Mount("/products", productHandler.Routes())
+	r.Mount("/categories", categoryHandler.Routes())
+	r.Get("/openapi.json", openapi.Handler(docs.OpenAPI))
 
-	server, err := server.New(server.WithHTTPServer(r, os.Getenv("PRODUCT_PORT")), server.WithGRPCServer(grpcServer, os.Getenv("PRODUCT_GRPC_PORT")))
+	registerGRPC := func(s *grpc.Server) {
+		product.RegisterProductsServer(s, grpcHandler)
+	}
+
+	server, err := server.New(
+		server.WithHTTPServer(r, os.Getenv("PRODUCT_PORT")),
+		server.WithGRPCServer(registerGRPC, os.Getenv("PRODUCT_GRPC_PORT"), server.WithGRPCTLS(grpcTLS), server.WithGRPCInsecure(os.Getenv("GRPC_INSECURE") == "true"), server.WithGRPCCallers(handler.GRPCCallers)),
+	)
 	if err != nil {
 		panic(err)
 	}
@@ -49,6 +96,8 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -56,8 +105,6 @@ func main() {
 		panic(err)
 	}
 
-	grpcServer.GracefulStop()
-
 	fmt.Println("Service stopped")
 
 }
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// subtree selects the ids of the category $1 and of all its descendants.
+const subtree = `
+	WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id = $1
+		UNION ALL
+		SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+	)
+	SELECT id FROM tree`
+
+type CategoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewCategoryRepository(db *sqlx.DB) *CategoryRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &CategoryRepository{
+		db: db,
+	}
+}
+
+// List orders categories by their depth in the tree, then by name.
+func (r *CategoryRepository) List(ctx context.Context) ([]product.Category, error) {
+	categories := []product.Category{}
+
+	q := `
+		WITH RECURSIVE tree AS (
+			SELECT id, parent_id, name, slug, description, 0 AS depth
+			FROM categories WHERE parent_id IS NULL
+			UNION ALL
+			SELECT c.id, c.parent_id, c.name, c.slug, c.description, tree.depth + 1
+			FROM categories c JOIN tree ON c.parent_id = tree.id
+		)
+		SELECT id, parent_id, name, slug, description FROM tree ORDER BY depth, name, id
+	`
+
+	if err := r.db.SelectContext(ctx, &categories, q); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (r *CategoryRepository) Get(ctx context.Context, id string) (product.Category, error) {
+	var c product.Category
+
+	err := r.db.GetContext(ctx, &c, "SELECT id, parent_id, name, slug, description FROM categories WHERE id = $1", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, product.ErrCategoryNotFound
+		}
+
+		return c, err
+	}
+
+	return c, nil
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, c product.Category) (string, error) {
+	q := "INSERT INTO categories (id, parent_id, name, slug, description) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+
+	err := r.db.QueryRowContext(ctx, q, c.ID, c.ParentID, c.Name, c.Slug, c.Description).Scan(&c.ID)
+	if err != nil {
+		return "", writeCategoryError(err)
+	}
+
+	return c.ID, nil
+}
+
+// Update refuses to move a category under itself or one of its
+// descendants. Moves are serialized, two of them could make a cycle
+// together that neither makes alone.
+func (r *CategoryRepository) Update(ctx context.Context, id string, c product.Category) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if c.ParentID != nil {
+		if _, err = tx.ExecContext(ctx, "LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+
+		var cycle bool
+
+		err = tx.GetContext(ctx, &cycle, "SELECT EXISTS (SELECT 1 FROM ("+subtree+") t WHERE t.id = $2)", id, *c.ParentID)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return product.ErrCategoryCycle
+		}
+	}
+
+	q := "UPDATE categories SET parent_id = $1, name = $2, slug = $3, description = $4 WHERE id = $5 RETURNING id"
+
+	err = tx.QueryRowContext(ctx, q, c.ParentID, c.Name, c.Slug, c.Description, id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrCategoryNotFound
+		}
+
+		return writeCategoryError(err)
+	}
+
+	return tx.Commit()
+}
+
+// Delete only removes categories without subcategories or products.
+func (r *CategoryRepository) Delete(ctx context.Context, id string) error {
+	err := r.db.QueryRowContext(ctx, "DELETE FROM categories WHERE id = $1 RETURNING id", id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrCategoryNotFound
+		}
+
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+			return product.ErrCategoryInUse
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// writeCategoryError maps the constraints a category insert or update
+// breaks to their errors, the only foreign key is the parent.
+func writeCategoryError(err error) error {
+	if err, ok := err.(*pq.Error); ok {
+		switch err.Code.Name() {
+		case "unique_violation":
+			return product.ErrCategoryExists
+		case "foreign_key_violation":
+			return product.ErrParentNotFound
+		}
+	}
+
+	return err
+}
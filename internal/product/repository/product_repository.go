@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strconv"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type ProductRepository struct {
@@ -23,21 +27,61 @@ func NewProductRepository(db *sqlx.DB) *ProductRepository {
 	}
 }
 
-func (r *ProductRepository) List(ctx context.Context) (products []product.Product, err error) {
-	products = []product.Product{}
+// productRow is a products row, the price currency is stored in its own
+// column and folded into Price by toProduct. Rank is the relevance of the
+// row to a search.
+type productRow struct {
+	product.Product
+	Currency string  `db:"currency"`
+	Rank     float64 `db:"rank"`
+}
+
+// productColumns are the columns of a productRow, products also have the
+// search vector nothing reads back.
+const productColumns = "id, name, description, price, currency, category_id, amount, added_at"
 
-	err = r.db.SelectContext(ctx, &products, "SELECT * FROM products")
+func (row productRow) toProduct() (product.Product, error) {
+	p := row.Product
+
+	price, err := p.Price.WithCurrency(row.Currency)
 	if err != nil {
-		return
+		return product.Product{}, err
 	}
 
-	return
+	p.Price = price
+
+	return p, nil
+}
+
+func toProducts(rows []productRow) ([]product.Product, error) {
+	products := make([]product.Product, 0, len(rows))
+
+	for _, row := range rows {
+		p, err := row.toProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, p)
+	}
+
+	return products, nil
+}
+
+func (r *ProductRepository) List(ctx context.Context, req store.PageRequest) (store.Page[product.Product], error) {
+	return r.page(ctx, "TRUE", "0", nil, nil, req)
+}
+
+// ListByCategory lists the products of a category and of all its
+// descendants.
+func (r *ProductRepository) ListByCategory(ctx context.Context, categoryID string, req store.PageRequest) (store.Page[product.Product], error) {
+	return r.page(ctx, "category_id IN ("+subtree+")", "0", []any{categoryID}, nil, req)
 }
 
 func (r *ProductRepository) Get(ctx context.Context, id string) (p product.Product, err error) {
-	p = product.Product{}
+	row := productRow{}
 
-	err = r.db.GetContext(ctx, &p, "SELECT * FROM products WHERE id = $1", id)
+	err = r.db.GetContext(ctx, &row, "SELECT "+productColumns+" FROM products WHERE id = $1", id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return p, product.ErrNotFound
@@ -45,56 +89,99 @@ func (r *ProductRepository) Get(ctx context.Context, id string) (p product.Produ
 		return
 	}
 
-	return
+	return row.toProduct()
 }
 
-func (r *ProductRepository) GetPriceByID(ctx context.Context, id string) (float64, error) {
-	var price float64
-
-	err := r.db.GetContext(ctx, &price, "SELECT price FROM products WHERE id = $1", id)
+// Create inserts the product together with its default variant.
+func (r *ProductRepository) Create(ctx context.Context, p product.Product, sku string) (id string, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, product.ErrNotFound
+		return
+	}
+	defer tx.Rollback()
+
+	q := "INSERT INTO products (id, name, description, price, currency, category_id, amount, added_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+
+	args := []any{p.ID, p.Name, p.Description, p.Price, p.Price.Currency, p.CategoryID, p.Amount, p.AddedAt}
+
+	if err = tx.QueryRowContext(ctx, q, args...).Scan(&id); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+			return "", product.ErrCategoryNotFound
 		}
 
-		return 0, err
+		return "", err
 	}
 
-	return price, nil
-}
+	q = "INSERT INTO product_variants (id, product_id, sku, amount) VALUES ($1, $1, $2, $3)"
 
-func (r *ProductRepository) Create(ctx context.Context, p product.Product) (string, error) {
-	q := "INSERT INTO products (id, name, description, price, category, amount, added_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	if _, err = tx.ExecContext(ctx, q, id, sku, p.Amount); err != nil {
+		return "", writeVariantError(err)
+	}
 
-	args := []any{p.ID, p.Name, p.Description, p.Price, p.Category, p.Amount, p.AddedAt}
+	return id, tx.Commit()
+}
 
-	err := r.db.QueryRowContext(ctx, q, args...).Scan(&p.ID)
+// Update changes the product and sets the stock of its default variant to
+// p.Amount through updateStock, so the change is recorded like any other.
+// The default variant is locked before the product, the order updateStock
+// locks them in. The currency can't change while variants have prices of
+// their own, they would be left in the old one.
+func (r *ProductRepository) Update(ctx context.Context, id string, p product.Product) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var amount int
+
+	if err = tx.GetContext(ctx, &amount, "SELECT amount FROM product_variants WHERE id = $1 FOR UPDATE", id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", product.ErrNotFound
+			return product.ErrNotFound
 		}
+		return
+	}
 
-		return p.ID, err
+	var currency string
+
+	if err = tx.GetContext(ctx, &currency, "SELECT currency FROM products WHERE id = $1 FOR UPDATE", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrNotFound
+		}
+		return
 	}
 
-	return p.ID, nil
-}
+	if currency != p.Price.Currency {
+		var priced bool
 
-func (r *ProductRepository) Update(ctx context.Context, id string, p product.Product) error {
-	q := `
-		UPDATE products SET name = $1, description = $2, price = $3, category = $4, amount = $5, added_at = $6
-		WHERE id = $7 RETURNING id
-	`
+		q := "SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1 AND price IS NOT NULL)"
 
-	args := []any{p.Name, p.Description, p.Price, p.Category, p.Amount, p.AddedAt, id}
+		if err = tx.GetContext(ctx, &priced, q, id); err != nil {
+			return
+		}
 
-	if err := r.db.QueryRowContext(ctx, q, args...).Scan(&id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return product.ErrNotFound
+		if priced {
+			return product.ErrVariantPrices
 		}
 	}
 
-	return nil
+	if _, err = updateStock(ctx, tx, []product.StockUpdate{{VariantID: id, Delta: p.Amount - amount}}); err != nil {
+		return
+	}
+
+	q := "UPDATE products SET name = $1, description = $2, price = $3, currency = $4, category_id = $5, added_at = $6 WHERE id = $7"
+
+	args := []any{p.Name, p.Description, p.Price, p.Price.Currency, p.CategoryID, p.AddedAt, id}
+
+	if _, err = tx.ExecContext(ctx, q, args...); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+			return product.ErrCategoryNotFound
+		}
+
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *ProductRepository) Delete(ctx context.Context, id string) error {
@@ -110,17 +197,146 @@ func (r *ProductRepository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *ProductRepository) Search(ctx context.Context, filter string, value string) (products []product.Product, err error) {
-	products = []product.Product{}
+// searchColumns are the fields products can be searched by.
+var searchColumns = store.Columns{
+	"name":        {Name: "name", Type: store.Text},
+	"description": {Name: "description", Type: store.Text},
+	"category_id": {Name: "category_id"},
+	"currency":    {Name: "currency"},
+	"price":       {Name: "price", Type: store.Number},
+	"amount":      {Name: "amount", Type: store.Number},
+	"in_stock":    {Name: "(amount > 0)", Type: store.Bool},
+}
+
+// sortKeys are the fields products can be sorted by. They page rows rather
+// than products, the cursor of a search keeps the rank of its last match.
+var sortKeys = store.Keyset[productRow]{
+	ID:   "id",
+	IDOf: func(row productRow) string { return row.ID },
+	Sorts: map[string]store.SortKey[productRow]{
+		"relevance": {Column: "rank", Type: store.Number, Value: func(row productRow) string { return strconv.FormatFloat(row.Rank, 'g', -1, 64) }},
+		"name":      {Column: "name", Value: func(row productRow) string { return row.Name }},
+		"price":     {Column: "price", Type: store.Number, Value: func(row productRow) string { return row.Price.Decimal() }},
+		"amount":    {Column: "amount", Type: store.Number, Value: func(row productRow) string { return strconv.Itoa(row.Amount) }},
+	},
+	Default: "name",
+}
+
+// match returns the condition of a text search, how to rank the matches
+// and its argument, always $1. The text matches the stemmed words of names
+// and descriptions, or names close enough to it by trigram similarity, so
+// typos still find something. An empty text matches every product.
+func match(text string) (cond, rank string, args []any) {
+	if text == "" {
+		return "TRUE", "0", nil
+	}
+
+	cond = "(search @@ websearch_to_tsquery('english', $1) OR name % $1)"
+	rank = "ts_rank(search, websearch_to_tsquery('english', $1)) + similarity(name, $1)"
+
+	return cond, rank, []any{text}
+}
+
+// Search sorts the matches of a text by relevance unless the request asks
+// for another sort.
+func (r *ProductRepository) Search(ctx context.Context, text string, filters []store.Filter, req store.PageRequest) (res product.SearchResult, err error) {
+	if text != "" && req.Sort == "" && req.Cursor == "" {
+		req.Sort, req.Desc = "relevance", true
+	}
+
+	cond, rank, args := match(text)
+
+	if res.Page, err = r.page(ctx, cond, rank, args, filters, req); err != nil {
+		return
+	}
+
+	res.Facets, err = r.facets(ctx, text, filters)
+
+	return
+}
+
+// page lists the products meeting cond and the filters a page at a time.
+// Cond and rank take the first arguments, the filters are numbered after
+// them.
+func (r *ProductRepository) page(ctx context.Context, cond, rank string, args []any, filters []store.Filter, req store.PageRequest) (page store.Page[product.Product], err error) {
+	where, whereArgs, err := searchColumns.Where(filters, len(args))
+	if err != nil {
+		return
+	}
+
+	args = append(args, whereArgs...)
 
-	err = r.db.SelectContext(ctx, &products, "SELECT * FROM products WHERE $1 = $2", filter, value)
+	after, orderBy, limit, afterArgs, err := sortKeys.Clause(req, len(args))
 	if err != nil {
 		return
 	}
 
-	if len(products) == 0 {
-		err = product.ErrNotFound
+	var total int
+
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM products WHERE "+cond+" AND "+where, args...)
+	if err != nil {
+		return
 	}
 
-	return
+	rows := []productRow{}
+
+	// The matches are ranked in a subquery so the cursor can compare ranks
+	q := `
+		SELECT * FROM (
+			SELECT ` + productColumns + `, ` + rank + ` AS rank
+			FROM products WHERE ` + cond + ` AND ` + where + `
+		) p
+		WHERE ` + after + ` ` + orderBy + ` ` + limit
+
+	err = r.db.SelectContext(ctx, &rows, q, append(args, afterArgs...)...)
+	if err != nil {
+		return
+	}
+
+	rowPage, err := sortKeys.Page(req, rows, total)
+	if err != nil {
+		return
+	}
+
+	products, err := toProducts(rowPage.Items)
+	if err != nil {
+		return
+	}
+
+	return store.Page[product.Product]{Items: products, Next: rowPage.Next, Prev: rowPage.Prev, Total: rowPage.Total}, nil
+}
+
+// facets counts the matches per category. Filters on the category are left
+// out, so picking one category still shows how many match in the others.
+func (r *ProductRepository) facets(ctx context.Context, text string, filters []store.Filter) ([]product.Facet, error) {
+	filters = slices.DeleteFunc(slices.Clone(filters), func(f store.Filter) bool {
+		return f.Field == "category_id"
+	})
+
+	cond, _, args := match(text)
+
+	where, whereArgs, err := searchColumns.Where(filters, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	facets := []product.Facet{}
+
+	// Matches are counted before joining the names, both tables have one
+	q := `
+		SELECT f.category_id, c.name, f.count
+		FROM (
+			SELECT category_id, COUNT(*) AS count
+			FROM products WHERE ` + cond + ` AND ` + where + `
+			GROUP BY category_id
+		) f
+		JOIN categories c ON c.id = f.category_id
+		ORDER BY f.count DESC, c.name
+	`
+
+	if err := r.db.SelectContext(ctx, &facets, q, append(args, whereArgs...)...); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
 }
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"github.com/jmoiron/sqlx"
+)
+
+type ReservationRepository struct {
+	db *sqlx.DB
+}
+
+func NewReservationRepository(db *sqlx.DB) *ReservationRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &ReservationRepository{
+		db: db,
+	}
+}
+
+// Reserve takes the reserved units out of stock and records the hold in the
+// same transaction, so either both happen or neither does.
+func (r *ReservationRepository) Reserve(ctx context.Context, res product.Reservation) (results []product.StockResult, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// Taking the order id first makes a concurrent reservation of the same
+	// order wait for this one and then find it
+	q := "INSERT INTO stock_reservations (id, order_id, status, expires_at) VALUES ($1, $2, $3, $4) ON CONFLICT (order_id) DO NOTHING"
+
+	inserted, err := tx.ExecContext(ctx, q, res.ID, res.OrderID, product.ReservationHeld, res.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	n, err := inserted.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if n == 0 {
+		err = product.ErrReservationExists
+		return
+	}
+
+	updates := make([]product.StockUpdate, 0, len(res.Items))
+	for _, item := range res.Items {
+		updates = append(updates, product.StockUpdate{
+			VariantID: item.VariantID,
+			Delta:     -item.Quantity,
+		})
+	}
+
+	if results, err = updateStock(ctx, tx, updates); err != nil {
+		return
+	}
+
+	for _, item := range res.Items {
+		q = "INSERT INTO stock_reservation_items (reservation_id, variant_id, quantity) VALUES ($1, $2, $3)"
+
+		if _, err = tx.ExecContext(ctx, q, res.ID, item.VariantID, item.Quantity); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// Commit turns the hold into a sale. A reservation that has already expired
+// is released instead and ErrReservationExpired is returned.
+func (r *ReservationRepository) Commit(ctx context.Context, orderID string) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := r.lock(ctx, tx, orderID)
+	if err != nil {
+		return
+	}
+
+	switch res.Status {
+	case product.ReservationCommitted:
+		return nil
+	case product.ReservationReleased:
+		return product.ErrReservationReleased
+	}
+
+	var expired bool
+
+	if err = tx.GetContext(ctx, &expired, "SELECT expires_at <= NOW() FROM stock_reservations WHERE id = $1", res.ID); err != nil {
+		return
+	}
+
+	if expired {
+		if err = r.release(ctx, tx, res); err != nil {
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			return
+		}
+
+		return product.ErrReservationExpired
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE stock_reservations SET status = $1 WHERE id = $2", product.ReservationCommitted, res.ID); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// Release puts the reserved units back into stock. Releasing an already
+// released reservation is a no-op.
+func (r *ReservationRepository) Release(ctx context.Context, orderID string) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := r.lock(ctx, tx, orderID)
+	if err != nil {
+		return
+	}
+
+	switch res.Status {
+	case product.ReservationReleased:
+		return nil
+	case product.ReservationCommitted:
+		return product.ErrReservationCommitted
+	}
+
+	if err = r.release(ctx, tx, res); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// Return puts the units of a committed reservation back into stock, for a
+// sale that was undone. The reservation is marked returned in the same
+// transaction, so returning it again is a no-op, as is returning a released
+// one. A reservation that is still held is released.
+func (r *ReservationRepository) Return(ctx context.Context, orderID string) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := r.lock(ctx, tx, orderID)
+	if err != nil {
+		return
+	}
+
+	switch res.Status {
+	case product.ReservationReturned, product.ReservationReleased:
+		return nil
+	case product.ReservationHeld:
+		if err = r.release(ctx, tx, res); err != nil {
+			return
+		}
+
+		return tx.Commit()
+	}
+
+	if err = r.restock(ctx, tx, res); err != nil {
+		return
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE stock_reservations SET status = $1 WHERE id = $2", product.ReservationReturned, res.ID); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseExpired releases every held reservation past its expiry and returns
+// how many were released.
+func (r *ReservationRepository) ReleaseExpired(ctx context.Context) (released int, err error) {
+	orderIDs := []string{}
+
+	q := "SELECT order_id FROM stock_reservations WHERE status = $1 AND expires_at <= NOW()"
+
+	if err = r.db.SelectContext(ctx, &orderIDs, q, product.ReservationHeld); err != nil {
+		return
+	}
+
+	for _, orderID := range orderIDs {
+		err = r.Release(ctx, orderID)
+		if errors.Is(err, product.ErrReservationCommitted) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		released++
+	}
+
+	return
+}
+
+func (r *ReservationRepository) lock(ctx context.Context, tx *sqlx.Tx, orderID string) (res product.Reservation, err error) {
+	q := "SELECT id, order_id, status, expires_at, created_at FROM stock_reservations WHERE order_id = $1 FOR UPDATE"
+
+	if err = tx.GetContext(ctx, &res, q, orderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = product.ErrReservationNotFound
+		}
+		return
+	}
+
+	q = "SELECT variant_id, quantity FROM stock_reservation_items WHERE reservation_id = $1"
+
+	res.Items = []product.ReservationItem{}
+	err = tx.SelectContext(ctx, &res.Items, q, res.ID)
+
+	return
+}
+
+func (r *ReservationRepository) release(ctx context.Context, tx *sqlx.Tx, res product.Reservation) error {
+	if err := r.restock(ctx, tx, res); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE stock_reservations SET status = $1 WHERE id = $2", product.ReservationReleased, res.ID)
+
+	return err
+}
+
+// restock adds the reserved units back to the stock of their variants.
+func (r *ReservationRepository) restock(ctx context.Context, tx *sqlx.Tx, res product.Reservation) error {
+	updates := make([]product.StockUpdate, 0, len(res.Items))
+	for _, item := range res.Items {
+		updates = append(updates, product.StockUpdate{
+			VariantID: item.VariantID,
+			Delta:     item.Quantity,
+		})
+	}
+
+	_, err := updateStock(ctx, tx, updates)
+
+	return err
+}
@@ -0,0 +1,432 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/events"
+	"github.com/erazr/ecommerce-microservices/internal/common/money"
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type VariantRepository struct {
+	db *sqlx.DB
+}
+
+func NewVariantRepository(db *sqlx.DB) *VariantRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &VariantRepository{
+		db: db,
+	}
+}
+
+// variantRow is a product_variants row with the currency of its product,
+// prices of variants are in the product currency.
+type variantRow struct {
+	product.Variant
+	Currency string `db:"currency"`
+}
+
+const variantColumns = "v.id, v.product_id, v.sku, v.options, v.price, v.amount, p.currency"
+
+func (row variantRow) toVariant() (product.Variant, error) {
+	v := row.Variant
+
+	if v.Price != nil {
+		price, err := v.Price.WithCurrency(row.Currency)
+		if err != nil {
+			return product.Variant{}, err
+		}
+
+		v.Price = &price
+	}
+
+	return v, nil
+}
+
+// List returns the variants of a product, the default variant first.
+func (r *VariantRepository) List(ctx context.Context, productID string) ([]product.Variant, error) {
+	rows := []variantRow{}
+
+	q := `
+		SELECT ` + variantColumns + `
+		FROM product_variants v JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = $1
+		ORDER BY v.id = v.product_id DESC, v.sku
+	`
+
+	if err := r.db.SelectContext(ctx, &rows, q, productID); err != nil {
+		return nil, err
+	}
+
+	variants := make([]product.Variant, 0, len(rows))
+
+	for _, row := range rows {
+		v, err := row.toVariant()
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, v)
+	}
+
+	return variants, nil
+}
+
+func (r *VariantRepository) Get(ctx context.Context, id string) (product.Variant, error) {
+	row := variantRow{}
+
+	q := "SELECT " + variantColumns + " FROM product_variants v JOIN products p ON p.id = v.product_id WHERE v.id = $1"
+
+	if err := r.db.GetContext(ctx, &row, q, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.Variant{}, product.ErrVariantNotFound
+		}
+
+		return product.Variant{}, err
+	}
+
+	return row.toVariant()
+}
+
+// GetPrice returns the price of the variant, or of its product when the
+// variant has none.
+func (r *VariantRepository) GetPrice(ctx context.Context, id string) (product.VariantPrice, error) {
+	row := struct {
+		ProductID string      `db:"product_id"`
+		Price     money.Money `db:"price"`
+		Currency  string      `db:"currency"`
+	}{}
+
+	q := `
+		SELECT v.product_id, COALESCE(v.price, p.price) AS price, p.currency
+		FROM product_variants v JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1
+	`
+
+	if err := r.db.GetContext(ctx, &row, q, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.VariantPrice{}, product.ErrVariantNotFound
+		}
+
+		return product.VariantPrice{}, err
+	}
+
+	price, err := row.Price.WithCurrency(row.Currency)
+	if err != nil {
+		return product.VariantPrice{}, err
+	}
+
+	return product.VariantPrice{ProductID: row.ProductID, Price: price}, nil
+}
+
+func (r *VariantRepository) GetStock(ctx context.Context, id string) (s product.VariantStock, err error) {
+	q := `
+		SELECT v.product_id, v.sku, p.name, v.amount
+		FROM product_variants v JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1
+	`
+
+	if err = r.db.GetContext(ctx, &s, q, id); errors.Is(err, sql.ErrNoRows) {
+		err = product.ErrVariantNotFound
+	}
+
+	return
+}
+
+// Create adds the stock of the variant to its product.
+func (r *VariantRepository) Create(ctx context.Context, v product.Variant) (id string, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	q := "INSERT INTO product_variants (id, product_id, sku, options, price, amount) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+
+	if err = tx.QueryRowContext(ctx, q, v.ID, v.ProductID, v.SKU, v.Options, v.Price, v.Amount).Scan(&id); err != nil {
+		return "", writeVariantError(err)
+	}
+
+	if err = checkCurrency(ctx, tx, v); err != nil {
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE products SET amount = amount + $1 WHERE id = $2", v.Amount, v.ProductID); err != nil {
+		return "", err
+	}
+
+	return id, tx.Commit()
+}
+
+// Update changes a variant of the product v.ProductID, its stock changes
+// through updateStock like any other.
+func (r *VariantRepository) Update(ctx context.Context, id string, v product.Variant) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var amount int
+
+	q := "SELECT amount FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE"
+
+	if err = tx.GetContext(ctx, &amount, q, id, v.ProductID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrVariantNotFound
+		}
+		return
+	}
+
+	if err = checkCurrency(ctx, tx, v); err != nil {
+		return
+	}
+
+	q = "UPDATE product_variants SET sku = $1, options = $2, price = $3 WHERE id = $4"
+
+	if _, err = tx.ExecContext(ctx, q, v.SKU, v.Options, v.Price, id); err != nil {
+		return writeVariantError(err)
+	}
+
+	if _, err = updateStock(ctx, tx, []product.StockUpdate{{VariantID: id, Delta: v.Amount - amount}}); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStock applies all updates in a single transaction, nothing is written
+// unless every variant exists and keeps a non-negative stock.
+func (r *VariantRepository) UpdateStock(ctx context.Context, updates []product.StockUpdate) (results []product.StockResult, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if results, err = updateStock(ctx, tx, updates); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// ReturnStock records the return id in the transaction that restocks, so a
+// repeated return finds it taken and leaves the stock alone.
+func (r *VariantRepository) ReturnStock(ctx context.Context, returnID string, updates []product.StockUpdate) (results []product.StockResult, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO stock_returns (id) VALUES ($1) ON CONFLICT (id) DO NOTHING", returnID)
+	if err != nil {
+		return
+	}
+
+	if inserted, _ := res.RowsAffected(); inserted == 0 {
+		return []product.StockResult{}, nil
+	}
+
+	if results, err = updateStock(ctx, tx, updates); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// Delete removes a variant that was never ordered along with its stock.
+func (r *VariantRepository) Delete(ctx context.Context, id string) (err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	v := product.Variant{}
+
+	if err = tx.GetContext(ctx, &v, "SELECT id, product_id, amount FROM product_variants WHERE id = $1 FOR UPDATE", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrVariantNotFound
+		}
+		return
+	}
+
+	if v.IsDefault() {
+		return product.ErrDefaultVariant
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM product_variants WHERE id = $1", id); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+			return product.ErrVariantInUse
+		}
+		return
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE products SET amount = amount - $1 WHERE id = $2", v.Amount, v.ProductID); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// checkCurrency makes sure the price of v is in the currency of its
+// product, which has to exist. The product stays locked until tx ends, so
+// its currency can't change under the variant's price. Callers lock the
+// variant first, the order updateStock locks them in.
+func checkCurrency(ctx context.Context, tx *sqlx.Tx, v product.Variant) error {
+	var currency string
+
+	if err := tx.GetContext(ctx, &currency, "SELECT currency FROM products WHERE id = $1 FOR NO KEY UPDATE", v.ProductID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return product.ErrNotFound
+		}
+
+		return err
+	}
+
+	if v.Price != nil && v.Price.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	return nil
+}
+
+// writeVariantError maps the constraints a variant insert or update breaks
+// to their errors, the only foreign key is the product.
+func writeVariantError(err error) error {
+	if err, ok := err.(*pq.Error); ok {
+		switch err.Code.Name() {
+		case "unique_violation":
+			return product.ErrVariantExists
+		case "foreign_key_violation":
+			return product.ErrNotFound
+		}
+	}
+
+	return err
+}
+
+// updateStock applies updates inside tx and records a StockChanged event for
+// every variant whose amount changed, the amounts of their products change
+// by as much. Variants are locked in id order, then their products, so
+// concurrent batches can't deadlock. If any update fails the results
+// describe every item and no row is written, the caller is expected to roll
+// back.
+func updateStock(ctx context.Context, tx *sqlx.Tx, updates []product.StockUpdate) (results []product.StockResult, err error) {
+	results = []product.StockResult{}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(updates))
+	for _, u := range updates {
+		ids = append(ids, u.VariantID)
+	}
+
+	q, args, err := sqlx.In("SELECT id, product_id, amount FROM product_variants WHERE id IN (?) ORDER BY id FOR UPDATE", ids)
+	if err != nil {
+		return
+	}
+
+	rows := []struct {
+		ID        string `db:"id"`
+		ProductID string `db:"product_id"`
+		Amount    int    `db:"amount"`
+	}{}
+
+	if err = tx.SelectContext(ctx, &rows, tx.Rebind(q), args...); err != nil {
+		return
+	}
+
+	stock := make(map[string]int, len(rows))
+	for _, row := range rows {
+		stock[row.ID] = row.Amount
+	}
+
+	for _, u := range updates {
+		res := product.StockResult{VariantID: u.VariantID, Delta: u.Delta}
+
+		amount, ok := stock[u.VariantID]
+
+		switch {
+		case !ok:
+			res.Err = product.ErrVariantNotFound
+		case amount+u.Delta < 0:
+			res.Stock = amount
+			res.Err = product.ErrInsufficientAmount
+		default:
+			stock[u.VariantID] = amount + u.Delta
+			res.Stock = amount + u.Delta
+		}
+
+		if res.Err != nil && err == nil {
+			err = res.Err
+		}
+
+		results = append(results, res)
+	}
+
+	if err != nil {
+		return
+	}
+
+	deltas := map[string]int{}
+
+	for _, row := range rows {
+		if stock[row.ID] == row.Amount {
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE product_variants SET amount = $1 WHERE id = $2", stock[row.ID], row.ID); err != nil {
+			return
+		}
+
+		deltas[row.ProductID] += stock[row.ID] - row.Amount
+
+		var e events.Event
+
+		e, err = events.New(events.StockChanged, row.ProductID, events.StockChangedPayload{
+			ProductID: row.ProductID,
+			VariantID: row.ID,
+			Delta:     stock[row.ID] - row.Amount,
+			Stock:     stock[row.ID],
+		})
+		if err != nil {
+			return
+		}
+
+		if err = events.Add(ctx, tx, e); err != nil {
+			return
+		}
+	}
+
+	productIDs := make([]string, 0, len(deltas))
+	for id := range deltas {
+		productIDs = append(productIDs, id)
+	}
+
+	slices.Sort(productIDs)
+
+	for _, id := range productIDs {
+		if _, err = tx.ExecContext(ctx, "UPDATE products SET amount = amount + $1 WHERE id = $2", deltas[id], id); err != nil {
+			return
+		}
+	}
+
+	return
+}
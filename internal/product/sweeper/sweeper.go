@@ -0,0 +1,50 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/product/domain/product"
+)
+
+// Sweeper periodically releases stock reservations that outlived their TTL.
+type Sweeper struct {
+	repo product.ReservationRepository
+
+	interval time.Duration
+}
+
+func New(repo product.ReservationRepository, interval time.Duration) *Sweeper {
+	if repo == nil {
+		panic("repo is required")
+	}
+
+	return &Sweeper{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run blocks until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := s.repo.ReleaseExpired(ctx)
+			if err != nil {
+				fmt.Printf("Releasing expired reservations failed: %v\n", err)
+				continue
+			}
+
+			if released > 0 {
+				fmt.Printf("Released %d expired reservations\n", released)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+var (
+	ErrInvalidRefreshToken = &UserError{"invalid refresh token"}
+	ErrRefreshTokenReused  = &UserError{"refresh token was already used"}
+)
+
+// RefreshToken is stored by the hash of its value only. Every refresh
+// revokes the token and issues a new one, presenting a revoked token again
+// revokes all tokens of the user as it was likely stolen.
+type RefreshToken struct {
+	ID        string       `db:"id"`
+	UserID    string       `db:"user_id"`
+	TokenHash string       `db:"token_hash"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	RevokedAt sql.NullTime `db:"revoked_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+type tokenStore interface {
+	Create(ctx context.Context, t RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (RefreshToken, error)
+	// Rotate revokes the token with the given id and stores next in its
+	// place. It returns ErrRefreshTokenReused if the token was revoked
+	// already.
+	Rotate(ctx context.Context, id string, next RefreshToken) error
+	Revoke(ctx context.Context, id string) error
+	RevokeAll(ctx context.Context, userID string) error
+}
+
+// newRefreshToken returns the value handed to the client and the record to
+// store.
+func newRefreshToken(userID string, ttl time.Duration) (string, RefreshToken, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return "", RefreshToken{}, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(value)
+
+	now := time.Now().UTC()
+
+	return token, RefreshToken{
+		ID:        store.GenerateID(),
+		UserID:    userID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+func hashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
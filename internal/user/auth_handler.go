@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type AuthHandler struct {
+	users  repository
+	tokens tokenStore
+
+	signer *auth.Signer
+
+	refreshTTL time.Duration
+
+	oidc       *oidcProvider
+	oidcStates oneTimeCache[oidcState]
+	oidcLinks  oneTimeCache[Identity]
+	identities identityStore
+}
+
+func newAuthHandler(users repository, tokens tokenStore, signer *auth.Signer, configs ...func(*AuthHandler)) *AuthHandler {
+	if users == nil || tokens == nil || signer == nil {
+		panic("users, tokens and signer are required")
+	}
+
+	h := &AuthHandler{
+		users:      users,
+		tokens:     tokens,
+		signer:     signer,
+		refreshTTL: 30 * 24 * time.Hour,
+	}
+
+	for _, cfg := range configs {
+		cfg(h)
+	}
+
+	return h
+}
+
+func withRefreshTTL(ttl time.Duration) func(*AuthHandler) {
+	return func(h *AuthHandler) {
+		h.refreshTTL = ttl
+	}
+}
+
+func (h *AuthHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Post("/register", h.register)
+	r.Post("/login", h.login)
+	r.Post("/refresh", h.refresh)
+	r.Post("/logout", h.logout)
+	r.Get("/jwks.json", h.jwks)
+
+	r.Get("/oidc/login", h.oidcLogin)
+	r.Get("/oidc/callback", h.oidcCallback)
+
+	return r
+}
+
+// @Summary		Register
+// @Description	create a client account and log it in
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		registerRequest	true	"Account data"
+// @Success		200		{object}	tokenResponse
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		409		{string}	string
+// @Failure		500
+// @Router			/auth/register [post]
+func (h *AuthHandler) register(w http.ResponseWriter, r *http.Request) {
+	req := registerRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	if errs := req.validate(); errs != nil {
+		response.BadRequest(w, r, errs)
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	// Admins are only made by other admins, never by signing up
+	u := User{
+		ID:               store.GenerateID(),
+		Name:             req.Name,
+		Email:            req.Email,
+		RegistrationDate: store.OnlyDate(time.Now().UTC().Format(store.DateLayout)),
+		Role:             authz.RoleClient,
+		PasswordHash:     hash,
+	}
+
+	if _, err := h.users.Create(r.Context(), u); err != nil {
+		if errors.Is(err, ErrExists) {
+			response.Conflict(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	h.issue(w, r, u)
+}
+
+// @Summary		Log in
+// @Description	exchange email and password for an access and a refresh token, confirms an external identity waiting to be linked to the account
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		loginRequest	true	"Credentials"
+// @Success		200		{object}	tokenResponse
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		401		{string}	string
+// @Failure		500
+// @Router			/auth/login [post]
+func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	req := loginRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	u, err := h.users.GetByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	// Unknown users and wrong passwords get the same answer
+	if err != nil || !checkPassword(u.PasswordHash, req.Password) {
+		response.Unauthorized(w, r, ErrInvalidCredentials)
+		return
+	}
+
+	if err := h.confirmOIDCLink(w, r, u); err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	h.issue(w, r, u)
+}
+
+// @Summary		Refresh tokens
+// @Description	exchange a refresh token for a new access and refresh token, the old refresh token stops working
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body		refreshRequest	true	"Refresh token"
+// @Success		200		{object}	tokenResponse
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		401		{string}	string
+// @Failure		500
+// @Router			/auth/refresh [post]
+func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request) {
+	req := refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	current, err := h.tokens.GetByHash(r.Context(), hashRefreshToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			response.Unauthorized(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		response.Unauthorized(w, r, ErrInvalidRefreshToken)
+		return
+	}
+
+	u, err := h.users.Get(r.Context(), current.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			response.Unauthorized(w, r, ErrInvalidRefreshToken)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	token, next, err := newRefreshToken(u.ID, h.refreshTTL)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := h.tokens.Rotate(r.Context(), current.ID, next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if err := h.tokens.RevokeAll(r.Context(), u.ID); err != nil {
+				response.InternalServerError(w, r, err)
+				return
+			}
+
+			response.Unauthorized(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	h.respond(w, r, u, token)
+}
+
+// @Summary		Log out
+// @Description	revoke a refresh token
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body	refreshRequest	true	"Refresh token"
+// @Success		200
+// @Failure		400	{array}	response.ErrorResponse
+// @Failure		500
+// @Router			/auth/logout [post]
+func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request) {
+	req := refreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: err.Error(),
+			Field:   "body",
+		}})
+		return
+	}
+
+	current, err := h.tokens.GetByHash(r.Context(), hashRefreshToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := h.tokens.Revoke(r.Context(), current.ID); err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// @Summary		Signing keys
+// @Description	public keys to verify access tokens with
+// @Tags			auth
+// @Produce		json
+// @Success		200	{object}	auth.JWKS
+// @Router			/auth/jwks.json [get]
+func (h *AuthHandler) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	render.JSON(w, r, h.signer.JWKS())
+}
+
+// issue starts a new session for the user.
+func (h *AuthHandler) issue(w http.ResponseWriter, r *http.Request, u User) {
+	token, refreshToken, err := newRefreshToken(u.ID, h.refreshTTL)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := h.tokens.Create(r.Context(), refreshToken); err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	h.respond(w, r, u, token)
+}
+
+func (h *AuthHandler) respond(w http.ResponseWriter, r *http.Request, u User, refreshToken string) {
+	accessToken, err := h.signer.Sign(u.ID, u.Role)
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	response.OK(w, r, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.signer.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
@@ -0,0 +1,35 @@
+// Command oidcstub is a minimal OpenID Connect provider for trying the
+// external sign in locally. It approves every authorization request right
+// away, signing in the user named by the login_hint parameter or the
+// -email flag.
+//
+//	go run ./cmd/oidcstub -addr :9000 -issuer http://localhost:9000
+//
+// and run the user service with OIDC_ISSUER=http://localhost:9000 and
+// OIDC_CLIENT_ID=stub.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/erazr/ecommerce-microservices/internal/user/oidcstub"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL as seen by the user service")
+	clientID := flag.String("client-id", "stub", "accepted client id")
+	email := flag.String("email", "stub.user@example.com", "email of the user signing in without a login_hint")
+	name := flag.String("name", "Stub User", "name of the user signing in")
+	flag.Parse()
+
+	stub := oidcstub.New(*issuer, *clientID, oidcstub.WithEmail(*email), oidcstub.WithName(*name))
+
+	fmt.Printf("OIDC stub for client %s started on %s\n", *clientID, *addr)
+
+	if err := http.ListenAndServe(*addr, stub); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gatewaydocs "github.com/erazr/ecommerce-microservices/internal/api-gateway/docs"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
+	"github.com/erazr/ecommerce-microservices/internal/user/docs"
+)
+
+// contractDocument merges the user document into the gateway's, as the
+// gateway does for the paths it routes to the user service.
+func contractDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+
+	doc, err := openapi.Parse(gatewaydocs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := openapi.Parse(docs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Merge("user", service, isUserPath); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func isUserPath(path string) bool {
+	return strings.HasPrefix(path, "/users") || strings.HasPrefix(path, "/auth")
+}
+
+// refreshToken stores a refresh token of the user and returns its value.
+func (s *testService) refreshToken(t *testing.T, userID string) string {
+	t.Helper()
+
+	token, stored, err := newRefreshToken(userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.tokens.tokens[stored.ID] = stored
+
+	return token
+}
+
+func TestContract(t *testing.T) {
+	s := newTestService(t)
+
+	contract := openapi.NewContract(contractDocument(t), s.router)
+
+	const (
+		client = authz.RoleClient
+		admin  = authz.RoleAdmin
+	)
+
+	refresh := s.refreshToken(t, "user1")
+	logout := s.refreshToken(t, "user1")
+
+	userBody := `{"name":"New","email":"new@example.com","role":"client","registration_date":"2024-01-02"}`
+
+	// The OIDC routes answer 404 without a provider, oidc_test signs in
+	// with one
+	tests := []struct {
+		method string
+		target string
+		userID string
+		role   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/auth/register", "", "", `{"name":"Someone","email":"someone@example.com","password":"password1"}`, http.StatusOK},
+		{http.MethodPost, "/auth/login", "", "", `{"email":"user1@example.com","password":"password1"}`, http.StatusOK},
+		{http.MethodPost, "/auth/refresh", "", "", `{"refresh_token":"` + refresh + `"}`, http.StatusOK},
+		{http.MethodPost, "/auth/logout", "", "", `{"refresh_token":"` + logout + `"}`, http.StatusOK},
+		{http.MethodGet, "/auth/jwks.json", "", "", "", http.StatusOK},
+		{http.MethodGet, "/auth/oidc/login", "", "", "", http.StatusNotFound},
+		{http.MethodGet, "/auth/oidc/callback?state=x&code=y", "", "", "", http.StatusNotFound},
+		{http.MethodGet, "/users", "admin1", admin, "", http.StatusOK},
+		{http.MethodPost, "/users", "admin1", admin, userBody, http.StatusOK},
+		{http.MethodGet, "/users/search?email=user1@example.com", "admin1", admin, "", http.StatusOK},
+		{http.MethodGet, "/users/user1", "user1", client, "", http.StatusOK},
+		{http.MethodPut, "/users/user1", "user1", client, strings.Replace(userBody, "new@", "user1@", 1), http.StatusOK},
+		{http.MethodDelete, "/users/user1", "admin1", admin, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec, err := contract.Do(newRequest(tt.method, tt.target, tt.userID, tt.role, tt.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+		}
+	}
+
+	if unserved := contract.Unserved(isUserPath); len(unserved) > 0 {
+		t.Errorf("operations without a test: %v", unserved)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/go-chi/chi/v5"
@@ -28,35 +29,50 @@ func newUserHandler(repo repository) *UserHandler {
 func (h *UserHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", h.list)
-	r.Post("/", h.create)
+	admin := authz.Require(authz.Admin)
+	self := authz.Require(authz.Self("id"))
 
-	r.Get("/search", h.search)
+	r.With(admin).Get("/", h.list)
+	r.With(admin).Post("/", h.create)
+
+	r.With(admin).Get("/search", h.search)
 
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", h.get)
-		r.Put("/", h.update)
-		r.Delete("/", h.delete)
+		r.With(self).Get("/", h.get)
+		r.With(self).Put("/", h.update)
+		r.With(admin).Delete("/", h.delete)
 	})
 
 	return r
 }
 
 // @Summary		Get users
-// @Description	list all users
+// @Description	list users a page at a time
 // @Tags			users
 // @Accept			json
 // @Produce		json
-// @Success		200	{array}	User
+// @Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort	query		string	false	"Sort field: name (default), email or registration_date"
+// @Param			order	query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[User]
+// @Failure		400		{array}		response.ErrorResponse
 // @Failure		500
 // @Router			/users [get]
 func (h *UserHandler) list(w http.ResponseWriter, r *http.Request) {
-	users, err := h.repo.List(r.Context())
+	req, err := store.PageRequestFromQuery(r.URL.Query())
 	if err != nil {
-		response.InternalServerError(w, r, err)
+		queryError(w, r, err)
+		return
+	}
+
+	users, err := h.repo.List(r.Context(), req)
+	if err != nil {
+		queryError(w, r, err)
+		return
 	}
 
-	response.OK(w, r, users)
+	response.Paginated(w, r, users.Items, users.Next, users.Prev, users.Total)
 }
 
 // @Summary		Create user
@@ -109,6 +125,7 @@ func (h *UserHandler) create(w http.ResponseWriter, r *http.Request) {
 // @Param			body	body	request	true	"User data"
 // @Success		200
 // @Failure		400	{array}	response.ErrorResponse
+// @Failure		403	{string}	string
 // @Failure		500
 // @Failure		404	{string}	string
 // @Router			/users/{id} [put]
@@ -129,6 +146,12 @@ func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only admins hand out roles
+	if p := authz.FromContext(r.Context()); !p.IsAdmin() && req.Role != p.Role {
+		response.Forbidden(w, r, authz.ErrForbidden)
+		return
+	}
+
 	u := User{
 		Name:             req.Name,
 		Email:            req.Email,
@@ -157,6 +180,7 @@ func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Param			id	path		string	true	"User ID"
 // @Success		200	{object}	User
+// @Failure		403	{string}	string
 // @Failure		404	{string}	string
 // @Failure		500
 // @Router			/users/{id} [get]
@@ -205,56 +229,58 @@ func (h *UserHandler) delete(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary		Search users
-// @Description	search users by name or email
+// @Description	search users with field=value, field[in]=a,b, field[like]=text or field[range]=low,high filters combined with AND. Fields: name, email, role, registration_date
 // @Tags			users
 // @Accept			json
 // @Produce		json
 // @Param			name	query		string	false	"User name"
 // @Param			email	query		string	false	"User email"
-// @Success		200		{array}		User
-// @Failure		404		{string}	string
+// @Param			limit	query		int		false	"Page size, 20 by default and at most 100"
+// @Param			sort	query		string	false	"Sort field: name (default), email or registration_date"
+// @Param			order	query		string	false	"Sort direction: asc (default) or desc"
+// @Param			cursor	query		string	false	"Cursor of the next or previous page, it keeps the sort of its request"
+// @Success		200		{object}	response.Page[User]
 // @Failure		500
 // @Failure		400	{array}	response.ErrorResponse
+// @Router			/users/search [get]
 func (h *UserHandler) search(w http.ResponseWriter, r *http.Request) {
-	name := r.URL.Query().Get("name")
-	email := r.URL.Query().Get("email")
+	query := r.URL.Query()
 
-	if name == "" && email == "" {
-		response.BadRequest(w, r, []response.ErrorResponse{{
-			Message: "empty query",
-			Field:   "query",
-		}})
+	req, err := store.PageRequestFromQuery(query)
+	if err != nil {
+		queryError(w, r, err)
 		return
 	}
 
-	if name != "" {
-		users, err := h.repo.Search(r.Context(), "name", name)
-		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
-
-			response.InternalServerError(w, r, err)
-			return
-		}
-
-		response.OK(w, r, users)
+	filters, err := store.FiltersFromQuery(query, store.PageParams...)
+	if err == nil && len(filters) == 0 {
+		err = &store.FilterError{Field: "query", Message: "empty query"}
+	}
+	if err != nil {
+		queryError(w, r, err)
+		return
 	}
 
-	if email != "" {
-		users, err := h.repo.Search(r.Context(), "email", email)
-		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				response.NotFound(w, r, err)
-				return
-			}
+	users, err := h.repo.Search(r.Context(), filters, req)
+	if err != nil {
+		queryError(w, r, err)
+		return
+	}
 
-			response.InternalServerError(w, r, err)
-			return
-		}
+	response.Paginated(w, r, users.Items, users.Next, users.Prev, users.Total)
+}
 
-		response.OK(w, r, users)
+// queryError answers filters and page requests the repository doesn't take
+// with 400.
+func queryError(w http.ResponseWriter, r *http.Request, err error) {
+	var filterErr *store.FilterError
+	if errors.As(err, &filterErr) {
+		response.BadRequest(w, r, []response.ErrorResponse{{
+			Message: filterErr.Message,
+			Field:   filterErr.Field,
+		}})
+		return
 	}
 
+	response.InternalServerError(w, r, err)
 }
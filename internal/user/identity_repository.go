@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type identityRepository struct {
+	db *sqlx.DB
+}
+
+func newIdentityRepository(db *sqlx.DB) *identityRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &identityRepository{
+		db: db,
+	}
+}
+
+func (r *identityRepository) Get(ctx context.Context, provider, subject string) (id Identity, err error) {
+	q := "SELECT * FROM user_identities WHERE provider = $1 AND subject = $2"
+
+	if err = r.db.GetContext(ctx, &id, q, provider, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+		}
+	}
+
+	return
+}
+
+func (r *identityRepository) Link(ctx context.Context, id Identity) error {
+	return r.link(ctx, r.db, id)
+}
+
+func (r *identityRepository) Provision(ctx context.Context, u User, id Identity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := `
+		INSERT INTO users (id, name, email, registration_date, role, password_hash)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err = tx.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.RegistrationDate, u.Role, u.PasswordHash)
+	if err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+			return ErrExists
+		}
+		return err
+	}
+
+	if err = r.link(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *identityRepository) link(ctx context.Context, e sqlx.ExecerContext, id Identity) error {
+	q := `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := e.ExecContext(ctx, q, id.Provider, id.Subject, id.UserID, id.Email, id.CreatedAt)
+	if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+		return ErrExists
+	}
+
+	return err
+}
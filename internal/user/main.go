@@ -2,17 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/openapi"
 	"github.com/erazr/ecommerce-microservices/internal/common/router"
 	"github.com/erazr/ecommerce-microservices/internal/common/server"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/user/docs"
 )
 
+//	@title			E-commerce Microservices User Service
+//	@version		1.0
+//	@description	Manages users and signs them in.
+
 func main() {
 	db, err := store.New(os.Getenv("DB_URL"))
 	if err != nil {
@@ -21,11 +32,62 @@ func main() {
 
 	userRepository := newUserRepository(db.Client)
 
+	tokenRepository := newTokenRepository(db.Client)
+
 	userHandler := newUserHandler(userRepository)
 
+	key, err := signingKey(os.Getenv("JWT_PRIVATE_KEY_FILE"))
+	if err != nil {
+		panic(err)
+	}
+
+	signerConfigs := []func(*auth.Signer){auth.WithIssuer(os.Getenv("JWT_ISSUER"))}
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL")); err == nil {
+		signerConfigs = append(signerConfigs, auth.WithTTL(ttl))
+	}
+
+	authConfigs := []func(*AuthHandler){}
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_REFRESH_TTL")); err == nil {
+		authConfigs = append(authConfigs, withRefreshTTL(ttl))
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		providerConfigs := []func(*oidcProvider){}
+		if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+			providerConfigs = append(providerConfigs, withOIDCScopes(strings.Fields(scopes)...))
+		}
+
+		// Identities are linked by provider name, so it must not change
+		name := os.Getenv("OIDC_PROVIDER")
+		if name == "" {
+			name = "oidc"
+		}
+
+		provider := newOIDCProvider(
+			name,
+			issuer,
+			os.Getenv("OIDC_CLIENT_ID"),
+			os.Getenv("OIDC_CLIENT_SECRET"),
+			os.Getenv("OIDC_REDIRECT_URL"),
+			providerConfigs...,
+		)
+
+		states := store.NewPostgresCache[oidcState](db.Client, "oidc_states", 10*time.Minute)
+		links := store.NewPostgresCache[Identity](db.Client, "oidc_links", 10*time.Minute)
+
+		authConfigs = append(authConfigs, withOIDC(provider, states, links, newIdentityRepository(db.Client)))
+
+		fmt.Printf("Signing in with %s at %s\n", name, issuer)
+	}
+
+	authHandler := newAuthHandler(userRepository, tokenRepository, auth.NewSigner(key, signerConfigs...), authConfigs...)
+
 	r := router.New()
+	r.Use(authz.Identify)
 
 	r.Mount("/users", userHandler.Routes())
+	r.Mount("/auth", authHandler.Routes())
+	r.Get("/openapi.json", openapi.Handler(docs.OpenAPI))
 
 	server, err := server.New(server.WithHTTPServer(r, os.Getenv("USER_PORT")))
 	if err != nil {
@@ -51,3 +113,21 @@ func main() {
 
 	fmt.Println("Service stopped")
 }
+
+// signingKey reads the key access tokens are signed with. Without one a key
+// is generated, tokens then stop working on restart and can't be shared
+// between replicas.
+func signingKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		fmt.Println("JWT_PRIVATE_KEY_FILE is not set, using a temporary signing key")
+
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.ParsePrivateKey(data)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/router"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// memoryUsers keeps users in memory, emails are unique like in the
+// users table.
+type memoryUsers struct {
+	users map[string]User
+}
+
+func (r *memoryUsers) page(keep func(User) bool) store.Page[User] {
+	page := store.Page[User]{Items: []User{}}
+
+	for _, u := range r.users {
+		if keep(u) {
+			page.Items = append(page.Items, u)
+		}
+	}
+
+	page.Total = len(page.Items)
+
+	return page
+}
+
+func (r *memoryUsers) List(ctx context.Context, req store.PageRequest) (store.Page[User], error) {
+	return r.page(func(User) bool { return true }), nil
+}
+
+func (r *memoryUsers) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[User], error) {
+	return r.page(func(u User) bool {
+		for _, f := range filters {
+			if f.Field == "email" && u.Email != f.Values[0] {
+				return false
+			}
+		}
+
+		return true
+	}), nil
+}
+
+func (r *memoryUsers) Create(ctx context.Context, u User) (string, error) {
+	if _, err := r.GetByEmail(ctx, u.Email); err == nil {
+		return "", ErrExists
+	}
+
+	r.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id string) (User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (r *memoryUsers) Update(ctx context.Context, id string, u User) error {
+	existing, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	u.ID = id
+	u.PasswordHash = existing.PasswordHash
+	r.users[id] = u
+
+	return nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, id string) error {
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.users, id)
+
+	return nil
+}
+
+// memoryTokens keeps refresh tokens in memory.
+type memoryTokens struct {
+	tokens map[string]RefreshToken
+}
+
+func (r *memoryTokens) Create(ctx context.Context, t RefreshToken) error {
+	r.tokens[t.ID] = t
+
+	return nil
+}
+
+func (r *memoryTokens) GetByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == hash {
+			return t, nil
+		}
+	}
+
+	return RefreshToken{}, ErrInvalidRefreshToken
+}
+
+func (r *memoryTokens) Rotate(ctx context.Context, id string, next RefreshToken) error {
+	if r.tokens[id].RevokedAt.Valid {
+		return ErrRefreshTokenReused
+	}
+
+	if err := r.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	return r.Create(ctx, next)
+}
+
+func (r *memoryTokens) Revoke(ctx context.Context, id string) error {
+	t := r.tokens[id]
+	t.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.tokens[id] = t
+
+	return nil
+}
+
+func (r *memoryTokens) RevokeAll(ctx context.Context, userID string) error {
+	for id, t := range r.tokens {
+		if t.UserID == userID {
+			if err := r.Revoke(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// testService is the user service wired to in-memory repositories.
+type testService struct {
+	router chi.Router
+	users  *memoryUsers
+	tokens *memoryTokens
+}
+
+// newTestService serves the client user1 and the admin admin1, both with the
+// password "password1".
+func newTestService(t *testing.T, configs ...func(*AuthHandler)) *testService {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testService{
+		users: &memoryUsers{users: map[string]User{
+			"user1":  {ID: "user1", Name: "User", Email: "user1@example.com", RegistrationDate: "2024-01-02", Role: authz.RoleClient, PasswordHash: hash},
+			"admin1": {ID: "admin1", Name: "Admin", Email: "admin1@example.com", RegistrationDate: "2024-01-02", Role: authz.RoleAdmin, PasswordHash: hash},
+		}},
+		tokens: &memoryTokens{tokens: make(map[string]RefreshToken)},
+	}
+
+	r := router.New()
+	r.Use(authz.Identify)
+	r.Mount("/users", newUserHandler(s.users).Routes())
+	r.Mount("/auth", newAuthHandler(s.users, s.tokens, auth.NewSigner(key), configs...).Routes())
+
+	s.router = r
+
+	return s
+}
+
+func newRequest(method, target, userID, role, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if userID != "" {
+		req.Header.Set(auth.UserIDHeader, userID)
+		req.Header.Set(auth.UserRoleHeader, role)
+	}
+
+	return req
+}
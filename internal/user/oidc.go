@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+var (
+	ErrOIDCDisabled     = &UserError{"external sign in is not configured"}
+	ErrInvalidOIDCState = &UserError{"invalid or expired sign in state"}
+	ErrInvalidIDToken   = &UserError{"invalid id token"}
+	ErrConfirmOIDCLink  = &UserError{"log in with your password to link the external identity"}
+)
+
+// Identity links the subject of an external identity provider to a user.
+type Identity struct {
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	UserID    string    `db:"user_id"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type identityStore interface {
+	Get(ctx context.Context, provider, subject string) (Identity, error)
+	Link(ctx context.Context, id Identity) error
+	// Provision creates the user together with its first identity.
+	Provision(ctx context.Context, u User, id Identity) error
+}
+
+// oneTimeCache hands every value out once, so a replayed key finds nothing.
+type oneTimeCache[T any] interface {
+	Set(key string, value T)
+	store.Taker[T]
+}
+
+// oidcState is what the login remembers for the callback, keyed by the state
+// parameter.
+type oidcState struct {
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// idTokenClaims are the ID token claims the sign in relies on.
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience is a single string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider signs users in with the authorization code flow and PKCE.
+// The discovery document is fetched on first use, so the provider doesn't
+// have to be up when the service starts.
+type oidcProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      *auth.RemoteKeySet
+}
+
+func newOIDCProvider(name, issuer, clientID, clientSecret, redirectURL string, configs ...func(*oidcProvider)) *oidcProvider {
+	p := &oidcProvider{
+		name:         name,
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       []string{"openid", "email", "profile"},
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, cfg := range configs {
+		cfg(p)
+	}
+
+	return p
+}
+
+func withOIDCScopes(scopes ...string) func(*oidcProvider) {
+	return func(p *oidcProvider) {
+		p.scopes = scopes
+	}
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery: unexpected status %d", resp.StatusCode)
+	}
+
+	d := &oidcDiscovery{}
+	if err := json.NewDecoder(resp.Body).Decode(d); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q doesn't match %q", d.Issuer, p.issuer)
+	}
+
+	p.discovery = d
+	p.keys = auth.NewRemoteKeySet(d.JWKSURI, auth.WithKeySetClient(p.client))
+
+	return d, nil
+}
+
+// authCodeURL starts a sign in, it returns where to send the user and the
+// state to keep until the callback.
+func (p *oidcProvider) authCodeURL(ctx context.Context) (string, string, oidcState, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", "", oidcState{}, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", oidcState{}, err
+	}
+
+	s := oidcState{ExpiresAt: time.Now().Add(10 * time.Minute)}
+
+	if s.Nonce, err = randomString(); err != nil {
+		return "", "", oidcState{}, err
+	}
+
+	if s.CodeVerifier, err = randomString(); err != nil {
+		return "", "", oidcState{}, err
+	}
+
+	challenge := sha256.Sum256([]byte(s.CodeVerifier))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {s.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return d.AuthorizationEndpoint + separator + query.Encode(), state, s, nil
+}
+
+// exchange redeems the authorization code and returns the verified claims
+// of the ID token.
+func (p *oidcProvider) exchange(ctx context.Context, code string, s oidcState) (idTokenClaims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {s.CodeVerifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+	defer resp.Body.Close()
+
+	token := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return idTokenClaims{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return idTokenClaims{}, fmt.Errorf("%w: token endpoint answered %d %s %s", ErrInvalidIDToken, resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	claims := idTokenClaims{}
+	if err := auth.ParseSigned(ctx, p.keys, token.IDToken, &claims); err != nil {
+		return idTokenClaims{}, errors.Join(ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer,
+		!claims.Audience.contains(p.clientID),
+		time.Now().Unix() >= claims.ExpiresAt,
+		claims.Nonce != s.Nonce,
+		claims.Subject == "":
+		return idTokenClaims{}, ErrInvalidIDToken
+	}
+
+	return claims, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
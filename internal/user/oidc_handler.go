@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcLinkCookie  = "oidc_link"
+)
+
+// withOIDC enables the external sign in. States keeps the logins waiting
+// for their callback, links the identities waiting for a password login to
+// confirm them.
+func withOIDC(provider *oidcProvider, states oneTimeCache[oidcState], links oneTimeCache[Identity], identities identityStore) func(*AuthHandler) {
+	return func(h *AuthHandler) {
+		h.oidc = provider
+		h.oidcStates = states
+		h.oidcLinks = links
+		h.identities = identities
+	}
+}
+
+// @Summary		Sign in with the identity provider
+// @Description	redirect to the external identity provider, which sends the user back to the callback
+// @Tags			auth
+// @Success		302
+// @Failure		404	{string}	string
+// @Failure		500
+// @Router			/auth/oidc/login [get]
+func (h *AuthHandler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		response.NotFound(w, r, ErrOIDCDisabled)
+		return
+	}
+
+	redirect, state, s, err := h.oidc.authCodeURL(r.Context())
+	if err != nil {
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	h.oidcStates.Set(state, s)
+
+	// Binds the sign in to this browser, a callback with someone else's
+	// state is rejected
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  s.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// @Summary		Identity provider callback
+// @Description	finish the sign in, users signing in for the first time get a client account. An admin account with the same email is only linked once its password login confirms it
+// @Tags			auth
+// @Produce		json
+// @Param			code	query		string	true	"authorization code"
+// @Param			state	query		string	true	"state"
+// @Success		200		{object}	tokenResponse
+// @Failure		400		{array}		response.ErrorResponse
+// @Failure		401		{string}	string
+// @Failure		404		{string}	string
+// @Failure		409		{string}	string
+// @Failure		500
+// @Router			/auth/oidc/callback [get]
+func (h *AuthHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		response.NotFound(w, r, ErrOIDCDisabled)
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		response.Unauthorized(w, r, ErrInvalidOIDCState)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	// Taking the state makes it single use, a replayed callback finds nothing
+	s, has := h.oidcStates.Take(state)
+	if !has || time.Now().After(s.ExpiresAt) {
+		response.Unauthorized(w, r, ErrInvalidOIDCState)
+		return
+	}
+
+	if reason := query.Get("error"); reason != "" {
+		response.Unauthorized(w, r, errors.New(reason+": "+query.Get("error_description")))
+		return
+	}
+
+	claims, err := h.oidc.exchange(r.Context(), query.Get("code"), s)
+	if err != nil {
+		if errors.Is(err, ErrInvalidIDToken) {
+			response.Unauthorized(w, r, err)
+			return
+		}
+
+		response.InternalServerError(w, r, err)
+		return
+	}
+
+	u, err := h.oidcUser(w, r, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrExists), errors.Is(err, ErrConfirmOIDCLink):
+			response.Conflict(w, r, err)
+		case errors.Is(err, ErrNotFound):
+			response.BadRequest(w, r, []response.ErrorResponse{{
+				Message: "identity provider didn't share an email address",
+				Field:   "email",
+			}})
+		default:
+			response.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	h.issue(w, r, u)
+}
+
+// oidcUser finds the user of an external identity. An unknown identity is
+// linked to the client with the same email if the provider verified it, and
+// gets a new client account if there is no such user. An admin with the
+// same email has to confirm the link by logging in with the password.
+func (h *AuthHandler) oidcUser(w http.ResponseWriter, r *http.Request, claims idTokenClaims) (User, error) {
+	ctx := r.Context()
+
+	identity, err := h.identities.Get(ctx, h.oidc.name, claims.Subject)
+	if err == nil {
+		return h.users.Get(ctx, identity.UserID)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return User{}, err
+	}
+
+	if claims.Email == "" {
+		return User{}, ErrNotFound
+	}
+
+	identity = Identity{
+		Provider:  h.oidc.name,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	u, err := h.users.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		// Taking over an account needs the provider to vouch for the email
+		if !claims.EmailVerified {
+			return User{}, ErrExists
+		}
+
+		identity.UserID = u.ID
+
+		// A verified email at the provider isn't enough to take over an admin
+		if u.Role == authz.RoleAdmin {
+			return User{}, h.pendOIDCLink(w, r, identity)
+		}
+
+		return u, h.identities.Link(ctx, identity)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return User{}, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	u = User{
+		ID:               store.GenerateID(),
+		Name:             name,
+		Email:            claims.Email,
+		RegistrationDate: store.OnlyDate(time.Now().UTC().Format(store.DateLayout)),
+		Role:             authz.RoleClient,
+	}
+
+	identity.UserID = u.ID
+
+	return u, h.identities.Provision(ctx, u, identity)
+}
+
+// pendOIDCLink keeps the identity until a password login of its user
+// confirms it, in the same browser.
+func (h *AuthHandler) pendOIDCLink(w http.ResponseWriter, r *http.Request, identity Identity) error {
+	key, err := randomString()
+	if err != nil {
+		return err
+	}
+
+	h.oidcLinks.Set(key, identity)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLinkCookie,
+		Value:    key,
+		Path:     "/auth",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return ErrConfirmOIDCLink
+}
+
+// confirmOIDCLink links the identity pending in the browser of the user
+// that just logged in with the password. A link waiting for another account
+// is dropped.
+func (h *AuthHandler) confirmOIDCLink(w http.ResponseWriter, r *http.Request, u User) error {
+	if h.oidcLinks == nil {
+		return nil
+	}
+
+	cookie, err := r.Cookie(oidcLinkCookie)
+	if err != nil {
+		return nil
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcLinkCookie, Path: "/auth", MaxAge: -1})
+
+	identity, has := h.oidcLinks.Take(cookie.Value)
+	if !has || identity.UserID != u.ID {
+		return nil
+	}
+
+	// Linked already by an earlier confirmation
+	if err := h.identities.Link(r.Context(), identity); err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
+	"github.com/erazr/ecommerce-microservices/internal/user/oidcstub"
+)
+
+// memoryIdentities keeps identities in memory next to memoryUsers.
+type memoryIdentities struct {
+	users      *memoryUsers
+	identities map[string]Identity
+}
+
+func (r *memoryIdentities) Get(ctx context.Context, provider, subject string) (Identity, error) {
+	id, ok := r.identities[provider+"/"+subject]
+	if !ok {
+		return Identity{}, ErrNotFound
+	}
+
+	return id, nil
+}
+
+func (r *memoryIdentities) Link(ctx context.Context, id Identity) error {
+	if _, ok := r.identities[id.Provider+"/"+id.Subject]; ok {
+		return ErrExists
+	}
+
+	r.identities[id.Provider+"/"+id.Subject] = id
+
+	return nil
+}
+
+func (r *memoryIdentities) Provision(ctx context.Context, u User, id Identity) error {
+	if _, err := r.users.Create(ctx, u); err != nil {
+		return err
+	}
+
+	return r.Link(ctx, id)
+}
+
+// oidcService is the user service signing in with oidcstub.
+type oidcService struct {
+	*testService
+	states     *store.InMemoryIdempotencyCache[oidcState]
+	identities *memoryIdentities
+	client     *http.Client
+}
+
+func newOIDCService(t *testing.T) *oidcService {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(nil)
+	issuer := "http://" + srv.Listener.Addr().String()
+	srv.Config.Handler = oidcstub.New(issuer, "stub")
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	s := &oidcService{
+		states: store.NewInMemoryIdempotencyCache[oidcState](10 * time.Minute),
+		// Stops at the redirect back to the user service
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+
+	provider := newOIDCProvider("stub", issuer, "stub", "", "http://users.example.com/auth/oidc/callback")
+	links := store.NewInMemoryIdempotencyCache[Identity](10 * time.Minute)
+
+	s.identities = &memoryIdentities{identities: make(map[string]Identity)}
+	s.testService = newTestService(t, func(h *AuthHandler) {
+		withOIDC(provider, s.states, links, s.identities)(h)
+	})
+	s.identities.users = s.users
+
+	return s
+}
+
+// callback is a callback the provider sent back to the browser, with the
+// cookies the login set.
+type callback struct {
+	query   url.Values
+	cookies []*http.Cookie
+}
+
+// authorize logs in at the user service and lets the stub sign in email.
+func (s *oidcService) authorize(t *testing.T, email string) callback {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := authorize.Query()
+	query.Set("login_hint", email)
+	authorize.RawQuery = query.Encode()
+
+	resp, err := s.client.Get(authorize.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	redirect, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: got status %d without a redirect", resp.StatusCode)
+	}
+
+	return callback{query: redirect.Query(), cookies: rec.Result().Cookies()}
+}
+
+func (s *oidcService) callback(c callback) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+c.query.Encode(), nil)
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func (s *oidcService) linkedUser(t *testing.T, email string) string {
+	t.Helper()
+
+	for _, id := range s.identities.identities {
+		if id.Email == email {
+			return id.UserID
+		}
+	}
+
+	return ""
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	s := newOIDCService(t)
+
+	rec := s.callback(s.authorize(t, "new@example.com"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	u, err := s.users.GetByEmail(context.Background(), "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Role != authz.RoleClient {
+		t.Errorf("got role %s of a provisioned user, want %s", u.Role, authz.RoleClient)
+	}
+
+	if got := s.linkedUser(t, "new@example.com"); got != u.ID {
+		t.Errorf("got identity of user %q, want %q", got, u.ID)
+	}
+
+	// Signing in again finds the identity instead of provisioning
+	if rec := s.callback(s.authorize(t, "new@example.com")); rec.Code != http.StatusOK {
+		t.Fatalf("second sign in: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	if len(s.users.users) != 3 {
+		t.Errorf("got %d users, want 3", len(s.users.users))
+	}
+}
+
+func TestOIDCState(t *testing.T) {
+	t.Run("mismatch", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		c := s.authorize(t, "user1@example.com")
+		other := s.authorize(t, "user1@example.com")
+		c.cookies = other.cookies
+
+		if rec := s.callback(c); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+	})
+
+	t.Run("without cookie", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		c := s.authorize(t, "user1@example.com")
+		c.cookies = nil
+
+		if rec := s.callback(c); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		c := s.authorize(t, "user1@example.com")
+		if rec := s.callback(c); rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+
+		if _, has := s.states.Get(c.query.Get("state")); has {
+			t.Error("state kept after the callback")
+		}
+
+		if rec := s.callback(c); rec.Code != http.StatusUnauthorized {
+			t.Errorf("replay: got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		c := s.authorize(t, "user1@example.com")
+		c.query.Del("code")
+		c.query.Set("error", "access_denied")
+
+		if rec := s.callback(c); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+
+		// The state is used up by the failed sign in too
+		if _, has := s.states.Get(c.query.Get("state")); has {
+			t.Error("state kept after the callback")
+		}
+	})
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	s := newOIDCService(t)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, has := s.states.Get(authorize.Query().Get("state"))
+	if !has {
+		t.Fatal("login didn't keep the state")
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+	if got := authorize.Query().Get("code_challenge"); got != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		t.Errorf("got code challenge %q, not the S256 of the verifier", got)
+	}
+
+	// A code redeemed with another verifier is refused by the provider
+	c := s.authorize(t, "user1@example.com")
+	key := c.query.Get("state")
+
+	stolen, _ := s.states.Get(key)
+	stolen.CodeVerifier = "someone-elses-verifier"
+	s.states.Set(key, stolen)
+
+	if rec := s.callback(c); rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+func TestOIDCEmailLinking(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		if rec := s.callback(s.authorize(t, "user1@example.com")); rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+
+		if got := s.linkedUser(t, "user1@example.com"); got != "user1" {
+			t.Errorf("got identity of user %q, want user1", got)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		s := newOIDCService(t)
+
+		rec := s.callback(s.authorize(t, "admin1@example.com"))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+		}
+
+		if got := s.linkedUser(t, "admin1@example.com"); got != "" {
+			t.Fatalf("admin linked to %q without a password login", got)
+		}
+
+		pending := rec.Result().Cookies()
+
+		login := func(email string) {
+			t.Helper()
+
+			req := newRequest(http.MethodPost, "/auth/login", "", "", `{"email":"`+email+`","password":"password1"}`)
+			for _, cookie := range pending {
+				req.AddCookie(cookie)
+			}
+
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("login: got status %d: %s", rec.Code, rec.Body)
+			}
+		}
+
+		// Another account's login drops the pending link
+		login("user1@example.com")
+		if got := s.linkedUser(t, "admin1@example.com"); got != "" {
+			t.Fatalf("admin identity linked to %q by another account", got)
+		}
+
+		rec = s.callback(s.authorize(t, "admin1@example.com"))
+		pending = rec.Result().Cookies()
+
+		login("admin1@example.com")
+		if got := s.linkedUser(t, "admin1@example.com"); got != "admin1" {
+			t.Fatalf("got identity of user %q, want admin1", got)
+		}
+
+		if rec := s.callback(s.authorize(t, "admin1@example.com")); rec.Code != http.StatusOK {
+			t.Errorf("sign in after confirming: got status %d: %s", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+// Package oidcstub is a minimal OpenID Connect provider for trying and
+// testing the external sign in. It approves every authorization request
+// right away, signing in the user named by the login_hint parameter or the
+// default email.
+package oidcstub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/erazr/ecommerce-microservices/internal/common/auth"
+)
+
+type grant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	expiresAt     time.Time
+}
+
+// Stub serves the discovery document, the authorization and token
+// endpoints and the signing keys under its issuer URL.
+type Stub struct {
+	issuer   string
+	clientID string
+	email    string
+	name     string
+
+	signer  *auth.Signer
+	handler http.Handler
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func New(issuer, clientID string, configs ...func(*Stub)) *Stub {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Stub{
+		issuer:   issuer,
+		clientID: clientID,
+		email:    "stub.user@example.com",
+		name:     "Stub User",
+		signer:   auth.NewSigner(key),
+		grants:   make(map[string]grant),
+	}
+
+	for _, cfg := range configs {
+		cfg(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /jwks.json", s.jwks)
+
+	s.handler = mux
+
+	return s
+}
+
+// WithEmail sets the email of the user signing in without a login_hint.
+func WithEmail(email string) func(*Stub) {
+	return func(s *Stub) {
+		s.email = email
+	}
+}
+
+// WithName sets the name of the user signing in.
+func WithName(name string) func(*Stub) {
+	return func(s *Stub) {
+		s.name = name
+	}
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Stub) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Stub) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("client_id") != s.clientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported authorization request", http.StatusBadRequest)
+		return
+	}
+
+	email := q.Get("login_hint")
+	if email == "" {
+		email = s.email
+	}
+
+	code := randomString()
+
+	s.mu.Lock()
+	s.grants[code] = grant{
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		email:         email,
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", q.Get("state"))
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Stub) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	// Codes are single use
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !ok || time.Now().After(g.expiresAt),
+		g.clientID != r.PostForm.Get("client_id"),
+		g.redirectURI != r.PostForm.Get("redirect_uri"),
+		g.codeChallenge != base64.RawURLEncoding.EncodeToString(verifier[:]):
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	subject := sha256.Sum256([]byte(g.email))
+	now := time.Now()
+
+	idToken, err := s.signer.SignClaims(map[string]any{
+		"iss":            s.issuer,
+		"sub":            hex.EncodeToString(subject[:8]),
+		"aud":            g.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": true,
+		"name":           s.name,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Stub) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.signer.JWKS())
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
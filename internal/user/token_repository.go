@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type tokenRepository struct {
+	db *sqlx.DB
+}
+
+func newTokenRepository(db *sqlx.DB) *tokenRepository {
+	if db == nil {
+		panic("db is required")
+	}
+
+	return &tokenRepository{
+		db: db,
+	}
+}
+
+func (r *tokenRepository) Create(ctx context.Context, t RefreshToken) error {
+	q := `
+		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(ctx, q, t.ID, t.UserID, t.TokenHash, t.ExpiresAt, t.CreatedAt)
+
+	return err
+}
+
+func (r *tokenRepository) GetByHash(ctx context.Context, hash string) (t RefreshToken, err error) {
+	if err = r.db.GetContext(ctx, &t, "SELECT * FROM refresh_tokens WHERE token_hash = $1", hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrInvalidRefreshToken
+		}
+	}
+
+	return
+}
+
+func (r *tokenRepository) Rotate(ctx context.Context, id string, next RefreshToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := "UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL RETURNING id"
+
+	if err = tx.QueryRowContext(ctx, q, id).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRefreshTokenReused
+		}
+
+		return err
+	}
+
+	q = `
+		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	if _, err = tx.ExecContext(ctx, q, next.ID, next.UserID, next.TokenHash, next.ExpiresAt, next.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *tokenRepository) Revoke(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+
+	return err
+}
+
+func (r *tokenRepository) RevokeAll(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+
+	return err
+}
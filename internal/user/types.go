@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/authz"
 	"github.com/erazr/ecommerce-microservices/internal/common/server/response"
 	"github.com/erazr/ecommerce-microservices/internal/common/store"
 )
@@ -26,7 +27,7 @@ func (u *request) validate() []response.ErrorResponse {
 		errs = append(errs, response.ErrorResponse{Message: "invalid email address", Field: "email"})
 	}
 
-	if u.Role != "admin" && u.Role != "client" {
+	if u.Role != authz.RoleAdmin && u.Role != authz.RoleClient {
 		errs = append(errs, response.ErrorResponse{Message: "invalid role", Field: "role"})
 	}
 
@@ -36,3 +37,43 @@ func (u *request) validate() []response.ErrorResponse {
 
 	return errs
 }
+
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+} // @name RegisterRequest
+
+func (u *registerRequest) validate() []response.ErrorResponse {
+	var errs []response.ErrorResponse
+
+	if u.Name == "" {
+		errs = append(errs, response.ErrorResponse{Message: "name is required", Field: "name"})
+	}
+
+	if ok, _ := regexp.MatchString(`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`, u.Email); !ok {
+		errs = append(errs, response.ErrorResponse{Message: "invalid email address", Field: "email"})
+	}
+
+	if len(u.Password) < 8 || len(u.Password) > 128 {
+		errs = append(errs, response.ErrorResponse{Message: "password must be 8 to 128 characters long", Field: "password"})
+	}
+
+	return errs
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+} // @name LoginRequest
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+} // @name RefreshRequest
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+} // @name TokenResponse
@@ -12,12 +12,15 @@ type User struct {
 	Email            string
 	RegistrationDate store.OnlyDate `db:"registration_date"`
 	Role             string
+	PasswordHash     string `db:"password_hash" json:"-"`
 } // @name User
 
 var (
 	ErrExists   = &UserError{"user already exists"}
 	ErrNotFound = &UserError{"user not found"}
 	ErrSearch   = &UserError{"user search error"}
+
+	ErrInvalidCredentials = &UserError{"invalid email or password"}
 )
 
 type UserError struct {
@@ -33,10 +36,11 @@ func (e *UserError) Is(err error) bool {
 }
 
 type repository interface {
-	List(ctx context.Context) ([]User, error)
-	Search(ctx context.Context, filter, value string) ([]User, error)
+	List(ctx context.Context, req store.PageRequest) (store.Page[User], error)
+	Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (store.Page[User], error)
 	Create(context.Context, User) (string, error)
 	Get(ctx context.Context, id string) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
 	Update(ctx context.Context, id string, u User) error
 	Delete(ctx context.Context, id string) error
 }
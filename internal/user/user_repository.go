@@ -6,6 +6,7 @@ import (
 
 	"database/sql"
 
+	"github.com/erazr/ecommerce-microservices/internal/common/store"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -26,11 +27,11 @@ func newUserRepository(db *sqlx.DB) *userRepository {
 
 func (r *userRepository) Create(ctx context.Context, u User) (id string, err error) {
 	q := `
-		INSERT INTO users (id, name, email, registration_date, role)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id
+		INSERT INTO users (id, name, email, registration_date, role, password_hash)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
 	`
 
-	args := []any{u.ID, u.Name, u.Email, u.RegistrationDate, u.Role}
+	args := []any{u.ID, u.Name, u.Email, u.RegistrationDate, u.Role, u.PasswordHash}
 
 	err = r.db.QueryRowContext(ctx, q, args...).Scan(&id)
 	if err != nil {
@@ -78,6 +79,23 @@ func (r *userRepository) Get(ctx context.Context, id string) (u User, err error)
 	return
 }
 
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (u User, err error) {
+	u = User{}
+
+	q := `
+	SELECT * FROM users WHERE email = $1
+	`
+
+	if err = r.db.GetContext(ctx, &u, q, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotFound
+			return
+		}
+	}
+
+	return
+}
+
 func (r *userRepository) Delete(ctx context.Context, id string) (err error) {
 	q := `
 	DELETE FROM users WHERE id = $1 RETURNING id
@@ -93,33 +111,56 @@ func (r *userRepository) Delete(ctx context.Context, id string) (err error) {
 	return
 }
 
-func (r *userRepository) List(ctx context.Context) (users []User, err error) {
-	users = []User{}
+func (r *userRepository) List(ctx context.Context, req store.PageRequest) (store.Page[User], error) {
+	return r.Search(ctx, nil, req)
+}
+
+// searchColumns are the fields users can be searched by.
+var searchColumns = store.Columns{
+	"name":              {Name: "name", Type: store.Text},
+	"email":             {Name: "email", Type: store.Text},
+	"role":              {Name: "role"},
+	"registration_date": {Name: "registration_date", Type: store.Date},
+}
 
-	q := "SELECT * FROM users"
+// sortKeys are the fields users can be sorted by.
+var sortKeys = store.Keyset[User]{
+	ID:   "id",
+	IDOf: func(u User) string { return u.ID },
+	Sorts: map[string]store.SortKey[User]{
+		"name":              {Column: "name", Value: func(u User) string { return u.Name }},
+		"email":             {Column: "email", Value: func(u User) string { return u.Email }},
+		"registration_date": {Column: "registration_date", Type: store.Date, Value: func(u User) string { return string(u.RegistrationDate) }},
+	},
+	Default: "name",
+}
 
-	err = r.db.SelectContext(ctx, &users, q)
+func (r *userRepository) Search(ctx context.Context, filters []store.Filter, req store.PageRequest) (page store.Page[User], err error) {
+	where, args, err := searchColumns.Where(filters, 0)
 	if err != nil {
 		return
 	}
 
-	return
-}
-
-func (r *userRepository) Search(ctx context.Context, filter, value string) (users []User, err error) {
-	users = []User{}
+	after, orderBy, limit, afterArgs, err := sortKeys.Clause(req, len(args))
+	if err != nil {
+		return
+	}
 
-	q := "SELECT * FROM users WHERE $1 = $2"
+	var total int
 
-	err = r.db.SelectContext(ctx, &users, q, value)
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users WHERE "+where, args...)
 	if err != nil {
 		return
 	}
 
-	if len(users) == 0 {
-		err = ErrNotFound
+	users := []User{}
+
+	q := "SELECT * FROM users WHERE " + where + " AND " + after + " " + orderBy + " " + limit
+
+	err = r.db.SelectContext(ctx, &users, q, append(args, afterArgs...)...)
+	if err != nil {
 		return
 	}
 
-	return
+	return sortKeys.Page(req, users, total)
 }
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS stock_reservation_items;
+DROP TABLE IF EXISTS stock_reservations;
\ No newline at end of file
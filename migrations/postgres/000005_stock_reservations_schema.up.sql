@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS stock_reservations (
+  id VARCHAR(24) PRIMARY KEY,
+  order_id VARCHAR(24) UNIQUE NOT NULL,
+  status VARCHAR(255) NOT NULL CHECK (status IN ('held', 'committed', 'released')),
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_status_expires_at ON stock_reservations (status, expires_at);
+
+CREATE TABLE IF NOT EXISTS stock_reservation_items (
+  reservation_id VARCHAR(24) REFERENCES stock_reservations(id) ON DELETE CASCADE,
+  product_id VARCHAR(24) REFERENCES products(id) ON DELETE CASCADE,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  PRIMARY KEY (reservation_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservation_items_product_id ON stock_reservation_items (product_id);
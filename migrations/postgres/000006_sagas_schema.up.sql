@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS sagas (
+  id VARCHAR(24) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  status VARCHAR(255) NOT NULL CHECK (status IN ('running', 'compensating', 'completed', 'compensated')),
+  step INT NOT NULL DEFAULT 0,
+  data JSONB NOT NULL DEFAULT '{}',
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sagas_status_updated_at ON sagas (status, updated_at);
+
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check CHECK (status IN ('pending', 'success', 'failed'));
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('new', 'pending', 'completed', 'failed'));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS outbox_offsets;
+DROP TABLE IF EXISTS outbox;
+DROP SEQUENCE IF EXISTS outbox_published_seq;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE SEQUENCE IF NOT EXISTS outbox_published_seq;
+
+CREATE TABLE IF NOT EXISTS outbox (
+  id VARCHAR(24) PRIMARY KEY,
+  seq BIGSERIAL UNIQUE,
+  type VARCHAR(255) NOT NULL,
+  aggregate_id VARCHAR(24) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  published_seq BIGINT UNIQUE,
+  published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (seq) WHERE published_seq IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_type_published_seq ON outbox (type, published_seq);
+
+CREATE TABLE IF NOT EXISTS outbox_offsets (
+  consumer VARCHAR(255) PRIMARY KEY,
+  position BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS order_status_history;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+UPDATE orders SET status = 'pending' WHERE status = 'awaiting_payment';
+UPDATE orders SET status = 'completed' WHERE status IN ('paid', 'shipped', 'delivered');
+UPDATE orders SET status = 'failed' WHERE status IN ('cancelled', 'refunded');
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('new', 'pending', 'completed', 'failed'));
\ No newline at end of file
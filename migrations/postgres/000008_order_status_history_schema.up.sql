@@ -0,0 +1,23 @@
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+UPDATE orders SET status = 'awaiting_payment' WHERE status = 'pending';
+UPDATE orders SET status = 'paid' WHERE status = 'completed';
+UPDATE orders SET status = 'cancelled' WHERE status = 'failed';
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('new', 'awaiting_payment', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+  id BIGSERIAL PRIMARY KEY,
+  order_id VARCHAR(24) REFERENCES orders(id) ON DELETE CASCADE,
+  from_status VARCHAR(255) NOT NULL DEFAULT '',
+  to_status VARCHAR(255) NOT NULL,
+  actor VARCHAR(255) NOT NULL DEFAULT '',
+  reason TEXT NOT NULL DEFAULT '',
+  changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history (order_id);
+
+INSERT INTO order_status_history (order_id, to_status, reason)
+SELECT id, status, 'status before history was recorded' FROM orders;
@@ -0,0 +1,7 @@
+ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_quantity_check;
+
+ALTER TABLE order_products
+  DROP COLUMN IF EXISTS line_total,
+  DROP COLUMN IF EXISTS unit_price;
+
+ALTER TABLE order_products RENAME COLUMN quantity TO amount;
\ No newline at end of file
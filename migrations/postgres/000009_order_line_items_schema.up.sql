@@ -0,0 +1,13 @@
+ALTER TABLE order_products RENAME COLUMN amount TO quantity;
+
+ALTER TABLE order_products
+  ADD COLUMN IF NOT EXISTS unit_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS line_total DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+-- Orders placed before prices were snapshotted get the current product price.
+UPDATE order_products op
+SET unit_price = p.price, line_total = p.price * op.quantity
+FROM products p
+WHERE p.id = op.product_id;
+
+ALTER TABLE order_products ADD CONSTRAINT order_products_quantity_check CHECK (quantity > 0);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE orders DROP COLUMN IF EXISTS currency;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_payments_transaction_id;
+
+ALTER TABLE payments
+  DROP COLUMN IF EXISTS transaction_id,
+  DROP COLUMN IF EXISTS provider;
\ No newline at end of file
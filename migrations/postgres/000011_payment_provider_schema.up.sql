@@ -0,0 +1,5 @@
+ALTER TABLE payments
+  ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS transaction_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_payments_transaction_id ON payments (provider, transaction_id);
\ No newline at end of file
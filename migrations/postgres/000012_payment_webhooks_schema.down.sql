@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payment_webhook_deliveries;
+DROP TABLE IF EXISTS payment_webhook_events;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+  id BIGSERIAL PRIMARY KEY,
+  provider VARCHAR(32) NOT NULL,
+  transaction_id VARCHAR(255) NOT NULL DEFAULT '',
+  status VARCHAR(32) NOT NULL DEFAULT '',
+  verified BOOLEAN NOT NULL DEFAULT FALSE,
+  payload TEXT NOT NULL,
+  outcome VARCHAR(32) NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_webhook_events_transaction ON payment_webhook_events (provider, transaction_id);
+
+CREATE TABLE IF NOT EXISTS payment_webhook_deliveries (
+  provider VARCHAR(32) NOT NULL,
+  transaction_id VARCHAR(255) NOT NULL,
+  status VARCHAR(32) NOT NULL,
+  claimed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (provider, transaction_id, status)
+);
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
+
+UPDATE payments SET status = 'success' WHERE status IN ('partially_refunded', 'refunded');
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check CHECK (status IN ('pending', 'success', 'failed'));
+
+UPDATE orders SET status = 'refunded' WHERE status = 'partially_refunded';
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('new', 'awaiting_payment', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
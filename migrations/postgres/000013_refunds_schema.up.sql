@@ -0,0 +1,26 @@
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('new', 'awaiting_payment', 'paid', 'shipped', 'delivered', 'cancelled', 'partially_refunded', 'refunded'));
+
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+  CHECK (status IN ('pending', 'success', 'failed', 'partially_refunded', 'refunded'));
+
+CREATE TABLE IF NOT EXISTS refunds (
+  id VARCHAR(24) PRIMARY KEY,
+  payment_id VARCHAR(24) NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+  amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+  currency CHAR(3) NOT NULL DEFAULT 'KZT',
+  reason TEXT NOT NULL DEFAULT '',
+  status VARCHAR(32) NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds (payment_id);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+  refund_id VARCHAR(24) NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+  product_id VARCHAR(24) NOT NULL,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  PRIMARY KEY (refund_id, product_id)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_name_id;
+DROP INDEX IF EXISTS idx_payments_user_id_payment_date_id;
+DROP INDEX IF EXISTS idx_payments_payment_date_id;
+DROP INDEX IF EXISTS idx_orders_user_id_ordered_date_id;
+DROP INDEX IF EXISTS idx_orders_ordered_date_id;
+DROP INDEX IF EXISTS idx_products_price_id;
+DROP INDEX IF EXISTS idx_products_name_id;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_products_name_id ON products (name, id);
+CREATE INDEX IF NOT EXISTS idx_products_price_id ON products (price, id);
+CREATE INDEX IF NOT EXISTS idx_orders_ordered_date_id ON orders (ordered_date, id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_ordered_date_id ON orders (user_id, ordered_date, id);
+CREATE INDEX IF NOT EXISTS idx_payments_payment_date_id ON payments (payment_date, id);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id_payment_date_id ON payments (user_id, payment_date, id);
+CREATE INDEX IF NOT EXISTS idx_users_name_id ON users (name, id);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_products_name_trgm;
+DROP INDEX IF EXISTS idx_products_search;
+
+ALTER TABLE products DROP COLUMN IF EXISTS search;
\ No newline at end of file
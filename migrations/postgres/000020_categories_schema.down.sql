@@ -0,0 +1,12 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(255);
+
+UPDATE products p SET category = c.name FROM categories c WHERE c.id = p.category_id;
+
+ALTER TABLE products ALTER COLUMN category SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_products_category ON products (category);
+
+DROP INDEX IF EXISTS idx_products_category_id;
+ALTER TABLE products DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS categories;
\ No newline at end of file
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS categories (
+  id VARCHAR(24) PRIMARY KEY,
+  parent_id VARCHAR(24) REFERENCES categories (id),
+  name VARCHAR(255) NOT NULL,
+  slug VARCHAR(255) NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+-- Every category products had becomes a top level category, names that
+-- only differ in case or punctuation share one
+INSERT INTO categories (id, name, slug)
+SELECT DISTINCT ON (slug) substr(md5(slug), 1, 24), category, slug
+FROM (
+  SELECT category, coalesce(nullif(trim(both '-' from lower(regexp_replace(category, '[^a-zA-Z0-9]+', '-', 'g'))), ''), 'uncategorized') AS slug
+  FROM products
+) p
+ORDER BY slug, category
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id VARCHAR(24) REFERENCES categories (id);
+
+UPDATE products
+SET category_id = substr(md5(coalesce(nullif(trim(both '-' from lower(regexp_replace(category, '[^a-zA-Z0-9]+', '-', 'g'))), ''), 'uncategorized')), 1, 24);
+
+ALTER TABLE products ALTER COLUMN category_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id);
+
+DROP INDEX IF EXISTS idx_products_category;
+ALTER TABLE products DROP COLUMN IF EXISTS category;
\ No newline at end of file
@@ -0,0 +1,45 @@
+-- Lines of variants of one product are merged back into a line of the
+-- product, at the average price of the merged lines
+ALTER TABLE refund_items DROP CONSTRAINT IF EXISTS refund_items_pkey;
+
+UPDATE refund_items r SET variant_id = v.product_id FROM product_variants v WHERE v.id = r.variant_id;
+
+WITH merged AS (
+  DELETE FROM refund_items RETURNING refund_id, variant_id, quantity
+)
+INSERT INTO refund_items (refund_id, variant_id, quantity)
+SELECT refund_id, variant_id, sum(quantity) FROM merged GROUP BY refund_id, variant_id;
+
+ALTER TABLE refund_items RENAME COLUMN variant_id TO product_id;
+ALTER TABLE refund_items ADD PRIMARY KEY (refund_id, product_id);
+
+ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_pkey;
+ALTER TABLE order_products DROP COLUMN IF EXISTS variant_id;
+
+WITH merged AS (
+  DELETE FROM order_products RETURNING order_id, product_id, quantity, line_total
+)
+INSERT INTO order_products (order_id, product_id, quantity, unit_price, line_total)
+SELECT order_id, product_id, sum(quantity), round(sum(line_total) / sum(quantity), 2), sum(line_total)
+FROM merged GROUP BY order_id, product_id;
+
+ALTER TABLE order_products ADD PRIMARY KEY (order_id, product_id);
+
+ALTER TABLE stock_reservation_items DROP CONSTRAINT IF EXISTS stock_reservation_items_variant_id_fkey;
+ALTER TABLE stock_reservation_items DROP CONSTRAINT IF EXISTS stock_reservation_items_pkey;
+
+UPDATE stock_reservation_items i SET variant_id = v.product_id FROM product_variants v WHERE v.id = i.variant_id;
+
+WITH merged AS (
+  DELETE FROM stock_reservation_items RETURNING reservation_id, variant_id, quantity
+)
+INSERT INTO stock_reservation_items (reservation_id, variant_id, quantity)
+SELECT reservation_id, variant_id, sum(quantity) FROM merged GROUP BY reservation_id, variant_id;
+
+ALTER TABLE stock_reservation_items RENAME COLUMN variant_id TO product_id;
+ALTER TABLE stock_reservation_items ADD PRIMARY KEY (reservation_id, product_id);
+ALTER TABLE stock_reservation_items ADD CONSTRAINT stock_reservation_items_product_id_fkey
+  FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+ALTER INDEX IF EXISTS idx_stock_reservation_items_variant_id RENAME TO idx_stock_reservation_items_product_id;
+
+DROP TABLE IF EXISTS product_variants;
\ No newline at end of file
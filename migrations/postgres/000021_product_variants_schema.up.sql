@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS product_variants (
+  id VARCHAR(24) PRIMARY KEY,
+  product_id VARCHAR(24) NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+  sku VARCHAR(64) NOT NULL UNIQUE,
+  options JSONB NOT NULL DEFAULT '{}',
+  price DECIMAL(10, 2) CHECK (price > 0),
+  amount INT NOT NULL CHECK (amount >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants (product_id);
+
+-- Every product gets a default variant with the product's id and its stock,
+-- so the orders, reservations and refunds of products point at variants.
+-- products.amount stays as the stock of all variants together
+INSERT INTO product_variants (id, product_id, sku, amount)
+SELECT id, id, 'SKU-' || upper(id), greatest(amount, 0) FROM products
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE stock_reservation_items DROP CONSTRAINT IF EXISTS stock_reservation_items_product_id_fkey;
+ALTER TABLE stock_reservation_items RENAME COLUMN product_id TO variant_id;
+ALTER TABLE stock_reservation_items ADD CONSTRAINT stock_reservation_items_variant_id_fkey
+  FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE CASCADE;
+ALTER INDEX IF EXISTS idx_stock_reservation_items_product_id RENAME TO idx_stock_reservation_items_variant_id;
+
+-- Variants that were ordered can't be deleted on their own, their lines
+-- only go with the whole product
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS variant_id VARCHAR(24) REFERENCES product_variants (id);
+
+UPDATE order_products SET variant_id = product_id;
+
+ALTER TABLE order_products ALTER COLUMN variant_id SET NOT NULL;
+ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_pkey;
+ALTER TABLE order_products ADD PRIMARY KEY (order_id, variant_id);
+
+CREATE INDEX IF NOT EXISTS idx_order_products_variant_id ON order_products (variant_id);
+
+ALTER TABLE refund_items RENAME COLUMN product_id TO variant_id;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- Each order has at most one payment in flight, a second checkout of the
+-- order fails instead of charging again. Leftover duplicates of earlier
+-- double checkouts are failed first, keeping the newest
+UPDATE payments p SET status = 'failed'
+WHERE status = 'pending' AND EXISTS (
+  SELECT 1 FROM payments q WHERE q.order_id = p.order_id AND q.status = 'pending' AND q.id > p.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_id_pending ON payments (order_id) WHERE status = 'pending';
\ No newline at end of file
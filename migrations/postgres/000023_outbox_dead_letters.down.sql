@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS outbox_dead_letters;
+
+ALTER TABLE outbox_offsets DROP COLUMN IF EXISTS attempts;
\ No newline at end of file
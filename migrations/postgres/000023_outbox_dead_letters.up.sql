@@ -0,0 +1,15 @@
+-- Failed attempts at the event after the position of a consumer
+ALTER TABLE outbox_offsets ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+
+-- Events a consumer gave up on after too many failed attempts
+CREATE TABLE IF NOT EXISTS outbox_dead_letters (
+  consumer VARCHAR(255) NOT NULL,
+  event_id VARCHAR(24) NOT NULL,
+  type VARCHAR(255) NOT NULL,
+  aggregate_id VARCHAR(24) NOT NULL,
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL,
+  error TEXT NOT NULL,
+  failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (consumer, event_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS payment_orders;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- Orders as the payment service learns them from OrderPlaced events
+CREATE TABLE IF NOT EXISTS payment_orders (
+  id VARCHAR(24) PRIMARY KEY,
+  user_id VARCHAR(24) NOT NULL,
+  total DECIMAL(10, 2) NOT NULL,
+  currency CHAR(3) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+UPDATE stock_reservations SET status = 'released' WHERE status = 'returned';
+
+ALTER TABLE stock_reservations DROP CONSTRAINT IF EXISTS stock_reservations_status_check;
+ALTER TABLE stock_reservations ADD CONSTRAINT stock_reservations_status_check
+  CHECK (status IN ('held', 'committed', 'released'));
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Committed reservations whose sale was undone are returned, their units
+-- are back in stock and returning them again does nothing
+ALTER TABLE stock_reservations DROP CONSTRAINT IF EXISTS stock_reservations_status_check;
+ALTER TABLE stock_reservations ADD CONSTRAINT stock_reservations_status_check
+  CHECK (status IN ('held', 'committed', 'released', 'returned'));
\ No newline at end of file
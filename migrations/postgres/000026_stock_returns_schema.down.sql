@@ -0,0 +1 @@
+DROP TABLE IF EXISTS stock_returns;
\ No newline at end of file
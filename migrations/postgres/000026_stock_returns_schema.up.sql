@@ -0,0 +1,6 @@
+-- Returns of sold units, such as refunded items, already put back into
+-- stock. A retried return finds its id here and does nothing
+CREATE TABLE IF NOT EXISTS stock_returns (
+  id VARCHAR(24) PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_dead_letters_failed_at;
+DROP INDEX IF EXISTS idx_outbox_published_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Lets the relay find the events and dead letters past their retention
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at) WHERE published_seq IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_dead_letters_failed_at ON outbox_dead_letters (failed_at);
\ No newline at end of file